@@ -6,10 +6,16 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
 
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/handler"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/mailer"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
@@ -18,6 +24,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/migration"
@@ -25,13 +32,28 @@ import (
 
 func main() {
 	cfg := config.LoadConfig()
-	ctx := context.Background()
 
-	dbPool, err := pgxpool.New(ctx, cfg.DBUrl)
+	// ctx is cancelled on SIGINT/SIGTERM and only bounds startup and the
+	// wait for a signal; request handlers use c.Request.Context() instead.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers get their own context so they keep running while
+	// in-flight requests drain, and are only stopped after that.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.DBUrl)
+	if err != nil {
+		log.Fatalf("invalid database url: %v", err)
+	}
+	poolConfig.MinConns = cfg.DBMinConns
+
+	dbPool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		log.Fatalf("unable to connect to database: %v", err)
 	}
-	defer dbPool.Close()
 
 	if err := dbPool.Ping(ctx); err != nil {
 		log.Fatalf("unable to ping database: %v", err)
@@ -42,7 +64,6 @@ func main() {
 		Addr: fmt.Sprintf("%s:%s", cfg.RedisHost, cfg.RedisPort),
 		DB:   0,
 	})
-	defer redisClient.Close()
 
 	if err := redisClient.Ping(ctx).Err(); err != nil {
 		log.Fatalf("Unable to connect to Redis: %v", err)
@@ -50,94 +71,337 @@ func main() {
 	log.Println("Connected to Redis")
 
 	log.Println("running migrations")
-	if err := migration.AutoMigrate(cfg.DBUrl); err != nil {
+	if err := migration.AutoMigrate(cfg.DBUrl, cfg.MigrationLockTimeout); err != nil {
 		log.Fatalf("migration failed: %v", err)
 	}
 	log.Println("migrations applied successfully")
 
+	expectedVersion, err := migration.ExpectedVersion()
+	if err != nil {
+		log.Fatalf("unable to determine expected schema version: %v", err)
+	}
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		log.Fatalf("invalid TLS configuration: %v", err)
+	}
+	if err := cfg.CheckAdminAddr(); err != nil {
+		log.Fatalf("invalid ADMIN_ADDR: %v", err)
+	}
+	if err := cfg.CheckIntervals(); err != nil {
+		log.Fatalf("invalid interval: %v", err)
+	}
+
+	defaultSender, err := mailer.ParseSender(cfg.SMTPFrom, cfg.SMTPReplyTo)
+	if err != nil {
+		log.Fatalf("invalid SMTP sender: %v", err)
+	}
+	verificationSender, err := mailer.ParseSender(cfg.SMTPVerificationFrom, cfg.SMTPVerificationReplyTo)
+	if err != nil {
+		log.Fatalf("invalid SMTP verification sender: %v", err)
+	}
+	supportSender, err := mailer.ParseSender(cfg.SMTPSupportFrom, cfg.SMTPSupportReplyTo)
+	if err != nil {
+		log.Fatalf("invalid SMTP support sender: %v", err)
+	}
+
+	publicBaseURL, err := mailer.ParseBaseURL(cfg.PublicBaseURL)
+	if err != nil {
+		log.Fatalf("invalid PUBLIC_BASE_URL: %v", err)
+	}
+
+	switch cfg.PasswordResetMode {
+	case service.PasswordResetLink, service.PasswordResetCode:
+	default:
+		log.Fatalf("unsupported PASSWORD_RESET_MODE %q", cfg.PasswordResetMode)
+	}
+
+	switch cfg.BlacklistFailurePolicy {
+	case middleware.BlacklistFailOpen, middleware.BlacklistFailClosed:
+	default:
+		log.Fatalf("unsupported BLACKLIST_FAILURE_POLICY %q", cfg.BlacklistFailurePolicy)
+	}
+
+	switch cfg.ErrorFormat {
+	case middleware.ErrorFormatCustom, middleware.ErrorFormatProblem:
+	default:
+		log.Fatalf("unsupported ERROR_FORMAT %q", cfg.ErrorFormat)
+	}
+
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		log.Fatalf("BCRYPT_COST must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cfg.BcryptCost)
+	}
+
+	capExempt, err := mailer.ParseEmailTypes(cfg.EmailCapExempt)
+	if err != nil {
+		log.Fatalf("invalid EMAIL_CAP_EXEMPT: %v", err)
+	}
+
 	render := mailer.NewTemplateRender("internal/mailer/templates")
+	unsubscribeSigner := mailer.NewUnsubscribeSigner([]byte(cfg.UnsubscribeSecret))
 
 	smtp := mailer.SMTPMailer{
-		Host:    cfg.SMTPHost,
-		Port:    cfg.SMTPPort,
-		User:    cfg.SMTPUser,
-		Pass:    cfg.SMPTPass,
-		From:    cfg.SMTPFrom,
-		BaseURL: "localhost:" + cfg.Port,
+		Host: cfg.SMTPHost,
+		Port: cfg.SMTPPort,
+		User: cfg.SMTPUser,
+		Pass: cfg.SMPTPass,
+		From: defaultSender,
+		Senders: map[mailer.EmailType]mailer.Sender{
+			mailer.EmailVerification: verificationSender,
+			mailer.EmailSupport:      supportSender,
+		},
+		BaseURL: publicBaseURL,
 		Render:  render,
+
+		DialTimeout: cfg.SMTPDialTimeout,
+		SendTimeout: cfg.SMTPSendTimeout,
+		TLSConfig:   tlsConfig,
+
+		Cap: mailer.NewRecipientCap(redisClient, cfg.EmailDailyCap, capExempt),
+
+		Unsubscribe: unsubscribeSigner,
 	}
 
 	userRepo := repository.NewUserRepository(dbPool)
-	tokenManager := jwt.NewTokenManager(cfg.JWTSecret)
+	smtp.Preferences = userRepo
+	tokenManager := jwt.NewTokenManager(cfg.JWTSecret, cfg.JWTAccessMaxAge)
 	emailRepo := repository.NewEmailVerificationRepository(dbPool)
 	sessionRepo := repository.NewSessionRepository(dbPool)
+	resetRepo := repository.NewPasswordResetRepository(dbPool)
+	trustedDeviceRepo := repository.NewTrustedDeviceRepository(dbPool)
+	apiTokenRepo := repository.NewAPITokenRepository(dbPool)
+	reportRepo := repository.NewReportRepository(dbPool)
 
-	minioService := service.NewMinioService(cfg)
-	authService := service.NewAuthService(userRepo, tokenManager, sessionRepo, emailRepo, &smtp, redisClient)
+	minioService := service.NewMinioService(ctx, cfg, tlsConfig)
+	apiTokenService := service.NewAPITokenService(apiTokenRepo)
+	reportService := service.NewReportService(reportRepo, userRepo, redisClient, cfg.ReportRateLimit, cfg.ReportRateWindow)
+	authService := service.NewAuthService(userRepo, tokenManager, sessionRepo, emailRepo, resetRepo, trustedDeviceRepo, &smtp, redisClient, &workers, cfg)
 
-	minioHandler := handler.NewMinioHandler(minioService, userRepo)
-	authHandler := handler.NewAuthHandler(authService)
+	locker := service.NewRedisLocker(redisClient)
+	accountPurger := service.NewAccountPurger(userRepo, minioService, &smtp, locker,
+		cfg.AccountDeletionGrace, cfg.AccountDeletionReminder, cfg.AccountPurgeInterval)
+	onboardingSteps, err := service.ParseOnboardingSequence(cfg.OnboardingSequence)
+	if err != nil {
+		log.Fatalf("invalid ONBOARDING_SEQUENCE: %v", err)
+	}
+	for _, step := range onboardingSteps {
+		if err := smtp.CheckOnboardingTemplates(step.Template); err != nil {
+			log.Fatalf("invalid ONBOARDING_SEQUENCE: %v", err)
+		}
+	}
+	onboarding := service.NewOnboarding(userRepo, &smtp, locker, onboardingSteps, cfg.OnboardingInterval)
+	storageReconciler := service.NewStorageReconciler(userRepo, minioService, locker,
+		cfg.StorageReconcileInterval, cfg.StorageReconcileMinAge, cfg.StorageReconcileDryRun)
+
+	minioHandler := handler.NewMinioHandler(minioService, userRepo, locker, service.StorageQuota{
+		Default: cfg.StorageQuotaBytes,
+		Plans:   cfg.StoragePlanQuotas,
+	}, cfg.AvatarRetainedVersions, cfg.AvatarMaxPixels)
+	authHandler := handler.NewAuthHandler(authService, cfg.AuthMinimalUser)
 	userHandler := handler.NewUserHandler(userRepo)
 	emailHandler := handler.NewEmailVerificationHandler(authService)
+	passwordResetHandler := handler.NewPasswordResetHandler(authService)
+	unsubscribeHandler := handler.NewUnsubscribeHandler(userRepo, unsubscribeSigner)
+	bodyLogger := middleware.NewBodyLogger(cfg.DebugBodySampleRate, cfg.DebugBodyAllowedIPs)
+	readOnly := middleware.NewReadOnly(redisClient, cfg.ReadOnlyMode, "/api/v1/admin/read-only", "/api/v1/auth/verify-token")
+	adminHandler := handler.NewAdminHandler(userRepo, sessionRepo, bodyLogger, readOnly)
+	apiTokenHandler := handler.NewAPITokenHandler(apiTokenService)
+	reportHandler := handler.NewReportHandler(reportService)
+	healthHandler := handler.NewHealthHandler(dbPool, redisClient, minioService, expectedVersion, cfg.ReadinessInterval)
+
+	diagnosticsHandler := handler.NewDiagnosticsHandler(healthHandler, cfg)
+
+	if cfg.WarmupEnabled {
+		if err := warmup(ctx, dbPool, redisClient, minioService, render, cfg.BcryptCost); err != nil {
+			log.Fatalf("warmup failed: %v", err)
+		}
+	}
+
+	workers.Go(func() { healthHandler.Run(workersCtx) })
+	workers.Go(func() { accountPurger.Run(workersCtx) })
+	workers.Go(func() { storageReconciler.Run(workersCtx) })
+	workers.Go(func() { onboarding.Run(workersCtx) })
 
 	router := gin.Default()
+	// Client IPs gate debug capture and key rate limits, so forwarding
+	// headers only count when they come from a known proxy.
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// CORS configuration
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
+	corsConfig := cors.Config{
+		AllowOrigins:     cfg.CORSAllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
-
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":   "healthy",
-			"service":  "user-service",
-			"database": "connected",
-		})
-	})
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Device-ID", "X-Device-Secret"},
+		ExposeHeaders:    []string{"Content-Length", "Location"},
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}
+	uploadCORS := corsConfig
+	uploadCORS.AllowMethods = []string{"POST", "OPTIONS"}
+	uploadCORS.AllowHeaders = append(slices.Clone(corsConfig.AllowHeaders), cfg.CORSUploadHeaders...)
 
-	router.GET("/verify-email", emailHandler.VerifyEmail)
+	corsMiddleware, err := middleware.CORS(corsConfig,
+		middleware.CORSRule{PathPrefix: "/api/v1/users/upload-avatar", Config: uploadCORS},
+	)
+	if err != nil {
+		log.Fatalf("invalid CORS configuration: %v", err)
+	}
+	router.Use(middleware.ProblemJSON(cfg.ErrorFormat, cfg.ProblemTypeBase))
+	router.Use(corsMiddleware)
+	router.Use(bodyLogger.Middleware())
+	router.Use(readOnly.Middleware())
+	router.Use(middleware.IdentityHeaderGuard([]byte(cfg.GatewaySigningKey), cfg.GatewaySignatureMaxSkew, cfg.RejectUntrustedIdentity))
+
+	adminRouter := opsRouter(router, cfg, healthHandler, diagnosticsHandler)
+
+	router.GET("/verify-email", middleware.NoStore(), emailHandler.ConfirmVerification)
+	router.POST("/verify-email", middleware.NoStore(), emailHandler.VerifyEmail)
+	router.GET("/reset-password", middleware.NoStore(), passwordResetHandler.ResetPasswordPage)
+	router.POST("/reset-password", middleware.NoStore(), passwordResetHandler.ResetPassword)
+	router.GET("/unsubscribe", middleware.NoStore(), unsubscribeHandler.UnsubscribePage)
+	router.POST("/unsubscribe", middleware.NoStore(), unsubscribeHandler.Unsubscribe)
 
 	v1 := router.Group("/api/v1")
 	{
 		auth := v1.Group("/auth")
+		auth.Use(middleware.NoStore())
 		{
 			auth.POST("/register", authHandler.Register)
+			auth.POST("/register/validate", authHandler.ValidateRegistration)
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/logout", authHandler.Logout)
 			auth.POST("/refresh", authHandler.RefreshToken)
+			auth.POST("/verify-token", authHandler.VerifyToken)
+			auth.POST("/resend-verification-public", emailHandler.ResendVerification)
+			auth.POST("/forgot-password", passwordResetHandler.ForgotPassword)
+			auth.POST("/reactivate", authHandler.ReactivateAccount)
+			auth.POST("/reset-password", passwordResetHandler.ResetPassword)
 		}
+
+		v1.GET("/avatars/:userID/:hash", minioHandler.GetImmutableAvatar)
+		v1.GET("/users/:id/avatar", minioHandler.GetUserAvatar)
 	}
 
 	protected := v1.Group("")
-	protected.Use(middleware.AuthMiddleware(tokenManager, redisClient))
+	protected.Use(middleware.AuthMiddleware(tokenManager, redisClient, apiTokenService, cfg.BlacklistFailurePolicy))
+	requireVerified := middleware.RequireVerified(userRepo, cfg.RequireEmailVerification)
 	{
 		auth := protected.Group("/auth")
+		auth.Use(middleware.NoStore(), middleware.RequireSession())
 		{
 			auth.POST("/logout-all", authHandler.LogoutAll)
 			auth.GET("/sessions", authHandler.GetActiveSessions)
+			auth.GET("/sessions/current", authHandler.GetCurrentSession)
+			auth.GET("/sessions/export", authHandler.ExportSessions)
+			auth.POST("/devices/trust", authHandler.TrustDevice)
+			auth.GET("/devices", authHandler.ListTrustedDevices)
+			auth.DELETE("/devices/:id", authHandler.UntrustDevice)
+			auth.POST("/tokens", requireVerified, apiTokenHandler.Create)
+			auth.GET("/tokens", apiTokenHandler.List)
+			auth.GET("/tokens/:id", apiTokenHandler.Get)
+			auth.DELETE("/tokens/:id", apiTokenHandler.Revoke)
 		}
 
 		users := protected.Group("/users")
 		{
-			users.POST("/upload-avatar", minioHandler.UploadAvatar)
+			users.GET("", userHandler.ListUsers)
+			users.POST("/upload-avatar", requireVerified, minioHandler.UploadAvatar)
 			users.GET("/get-avatar", minioHandler.GetAvatar)
+			users.DELETE("/me/avatar", minioHandler.DeleteAvatar)
+			users.POST("/avatars/batch", minioHandler.GetAvatarBatch)
 			users.GET("/me", userHandler.GetMe)
+			users.GET("/me/storage", minioHandler.GetStorage)
 			users.PUT("/me", userHandler.UpdateMe)
+			users.DELETE("/me", middleware.RequireSession(), authHandler.DeleteAccount)
+			users.POST("/me/password", middleware.RequireSession(), authHandler.ChangePassword)
 			users.GET("/:id", userHandler.GetUserByID)
+			users.POST("/:id/report", requireVerified, reportHandler.ReportUser)
 		}
+
+		admin := protected.Group("/admin")
+		admin.Use(middleware.RequireRole(userRepo, models.RoleAdmin))
+		{
+			admin.GET("/users/:id", adminHandler.GetUser)
+			admin.GET("/users/:id/sessions/export", adminHandler.ExportUserSessions)
+			admin.POST("/users/:id/verify-email", adminHandler.VerifyUserEmail)
+			admin.GET("/reports", reportHandler.ListReports)
+			admin.POST("/reports/:id/resolve", reportHandler.ResolveReport)
+			admin.GET("/diagnostics", diagnosticsHandler.Diagnostics)
+			admin.GET("/debug/body-logging", adminHandler.GetBodyLogging)
+			admin.PUT("/debug/body-logging", adminHandler.SetBodyLogging)
+			admin.GET("/read-only", adminHandler.GetReadOnlyMode)
+			admin.PUT("/read-only", adminHandler.SetReadOnlyMode)
+		}
+	}
+
+	// Service-to-service endpoints. They must not be exposed publicly; the
+	// gateway should not proxy /internal/*.
+	internal := router.Group("/internal")
+	internal.Use(middleware.InternalAuth(cfg.InternalServiceTokens))
+	{
+		internal.GET("/users/:id", userHandler.GetUserByID)
 	}
 
 	srv := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: router,
+		Addr:      ":" + cfg.Port,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+
+	go func() {
+		log.Printf("user service starting on port %s", cfg.Port)
+		var err error
+		if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("failed to start server: %v", err)
+		}
+	}()
+
+	var adminSrv *http.Server
+	if cfg.AdminAddr != "" {
+		adminSrv = &http.Server{
+			Addr:    cfg.AdminAddr,
+			Handler: adminRouter,
+		}
+		go func() {
+			log.Printf("admin listener starting on %s", cfg.AdminAddr)
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("failed to start admin listener: %v", err)
+			}
+		}()
 	}
 
-	log.Printf("user service starting on port %s", cfg.Port)
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("failed to start server: %v", err)
+	<-ctx.Done()
+	log.Println("shutting down user service")
+
+	// Shutdown order matters: stop accepting requests and drain the
+	// in-flight ones (which may still send email or hit the DB), then stop
+	// background workers, and only then close the connections they share.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown error: %v", err)
+	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("admin listener shutdown error: %v", err)
+		}
+	}
+
+	stopWorkers()
+	workers.Wait()
+	log.Println("background workers stopped")
+
+	if err := redisClient.Close(); err != nil {
+		log.Printf("redis close error: %v", err)
 	}
+	dbPool.Close()
+	log.Println("user service stopped")
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/handler"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+)
+
+// opsRouter registers probes, scraping and diagnostics. With an admin
+// listener configured they all move to the returned router, which is bound
+// to a private address. Otherwise the probes stay on the public router,
+// /metrics there takes an internal service token, and /diagnostics is only
+// reachable through the admin API.
+func opsRouter(public *gin.Engine, cfg *config.Config, health *handler.HealthHandler, diagnostics *handler.DiagnosticsHandler) *gin.Engine {
+	metrics := gin.WrapH(promhttp.Handler())
+
+	if cfg.AdminAddr == "" {
+		public.GET("/health", health.Health)
+		public.GET("/readiness", health.Readiness)
+		public.GET("/metrics", middleware.InternalAuth(cfg.InternalServiceTokens), metrics)
+		return nil
+	}
+
+	admin := gin.New()
+	admin.Use(gin.Recovery())
+	admin.GET("/health", health.Health)
+	admin.GET("/readiness", health.Readiness)
+	admin.GET("/metrics", metrics)
+	admin.GET("/diagnostics", diagnostics.Diagnostics)
+	return admin
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/handler"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+var opsPaths = []string{"/health", "/readiness", "/metrics", "/diagnostics"}
+
+func hasRoute(r *gin.Engine, path string) bool {
+	for _, route := range r.Routes() {
+		if route.Method == http.MethodGet && route.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func newOpsRouters(cfg *config.Config) (public, admin *gin.Engine) {
+	health := handler.NewHealthHandler(nil, nil, nil, 0, 0)
+	public = gin.New()
+	admin = opsRouter(public, cfg, health, handler.NewDiagnosticsHandler(health, cfg))
+	return public, admin
+}
+
+func TestOpsRoutesOnlyOnAdminListener(t *testing.T) {
+	public, admin := newOpsRouters(&config.Config{AdminAddr: "127.0.0.1:9090"})
+	if admin == nil {
+		t.Fatal("no admin router with ADMIN_ADDR set")
+	}
+
+	for _, path := range opsPaths {
+		if hasRoute(public, path) {
+			t.Errorf("%s is served on the public port", path)
+		}
+		if !hasRoute(admin, path) {
+			t.Errorf("%s is missing from the admin port", path)
+		}
+	}
+}
+
+func TestOpsRoutesWithoutAdminListener(t *testing.T) {
+	public, admin := newOpsRouters(&config.Config{
+		InternalServiceTokens: map[string]string{"prometheus": "scrape-secret"},
+	})
+	if admin != nil {
+		t.Fatal("admin router built without ADMIN_ADDR")
+	}
+	if hasRoute(public, "/diagnostics") {
+		t.Error("/diagnostics is served on the public port")
+	}
+
+	get := func(path string, header http.Header) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header = header
+		w := httptest.NewRecorder()
+		public.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := get("/health", http.Header{}); code != http.StatusOK {
+		t.Errorf("/health status = %d, want 200", code)
+	}
+	if code := get("/metrics", http.Header{}); code != http.StatusUnauthorized {
+		t.Errorf("/metrics without a token: status = %d, want 401", code)
+	}
+	if code := get("/metrics", http.Header{"X-Internal-Token": {"wrong"}}); code != http.StatusForbidden {
+		t.Errorf("/metrics with a wrong token: status = %d, want 403", code)
+	}
+	if code := get("/metrics", http.Header{"X-Internal-Token": {"scrape-secret"}}); code != http.StatusOK {
+		t.Errorf("/metrics with the token: status = %d, want 200", code)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/mailer"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// warmup does the work the first requests after a deploy would otherwise
+// pay for: parsing email templates, opening the pool's minimum database
+// connections, touching Redis and MinIO, and running bcrypt once. It runs
+// before the server starts listening, so readiness can't report ready
+// until it's done.
+func warmup(ctx context.Context, dbPool *pgxpool.Pool, redisClient *redis.Client, minioService *service.Minio, render *mailer.TemplateRender, bcryptCost int) error {
+	start := time.Now()
+
+	n, err := render.Preload()
+	if err != nil {
+		return fmt.Errorf("parse email templates: %w", err)
+	}
+
+	conns := make([]*pgxpool.Conn, 0, dbPool.Config().MinConns)
+	defer func() {
+		for _, conn := range conns {
+			conn.Release()
+		}
+	}()
+	for range dbPool.Config().MinConns {
+		conn, err := dbPool.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("open database connections: %w", err)
+		}
+		conns = append(conns, conn)
+	}
+
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("ping redis: %w", err)
+	}
+	if _, err := minioService.MinioClient.BucketExists(ctx, service.BucketName); err != nil {
+		return fmt.Errorf("reach minio: %w", err)
+	}
+
+	_, _ = bcrypt.GenerateFromPassword([]byte("warmup"), bcryptCost)
+
+	log.Printf("warmup done in %s: %d templates, %d database connections", time.Since(start), n, len(conns))
+	return nil
+}
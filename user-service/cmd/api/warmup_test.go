@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/handler"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/mailer"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/s3test"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// copyTemplates copies the email templates to a temporary directory the
+// test can break or remove.
+func copyTemplates(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths, err := filepath.Glob(filepath.Join("..", "..", "internal", "mailer", "templates", "*.html"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no templates found: %v", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(path)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+type warmupEnv struct {
+	db     *pgxpool.Pool
+	redis  *redis.Client
+	minio  *service.Minio
+	render *mailer.TemplateRender
+}
+
+func newWarmupEnv(t *testing.T, minConns int32) *warmupEnv {
+	t.Helper()
+
+	poolConfig := testdb.New(t).Config()
+	poolConfig.MinConns = minConns
+	db, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	_, client := s3test.New(t)
+
+	return &warmupEnv{
+		db:     db,
+		redis:  redisClient,
+		minio:  &service.Minio{MinioClient: client},
+		render: mailer.NewTemplateRender(copyTemplates(t)),
+	}
+}
+
+func TestWarmupBeforeReadiness(t *testing.T) {
+	e := newWarmupEnv(t, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	health := handler.NewHealthHandler(e.db, e.redis, e.minio, 0, time.Hour)
+	router := gin.New()
+	router.GET("/readiness", health.Readiness)
+	readiness := func() int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readiness", nil))
+		return w.Code
+	}
+
+	if code := readiness(); code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness before warmup = %d, want 503", code)
+	}
+
+	if err := warmup(ctx, e.db, e.redis, e.minio, e.render, bcrypt.MinCost); err != nil {
+		t.Fatalf("warmup: %v", err)
+	}
+
+	if n := e.db.Stat().TotalConns(); n < 3 {
+		t.Errorf("warmup left %d database connections open, want the 3 minimum", n)
+	}
+	// Templates were parsed during warmup, so rendering no longer needs
+	// the files.
+	if err := os.RemoveAll(e.render.BaseDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.render.RenderTemplate("verify_email.html", map[string]any{}); err != nil {
+		t.Errorf("template not parsed by warmup: %v", err)
+	}
+
+	// main starts the readiness checks once warmup has returned.
+	go health.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for readiness() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("not ready after warmup")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWarmupFailsOnBrokenTemplate(t *testing.T) {
+	e := newWarmupEnv(t, 1)
+	if err := os.WriteFile(filepath.Join(e.render.BaseDir, "broken.html"), []byte("{{ .Unclosed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := warmup(context.Background(), e.db, e.redis, e.minio, e.render, bcrypt.MinCost); err == nil {
+		t.Fatal("warmup succeeded with a broken template")
+	}
+}
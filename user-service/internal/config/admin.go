@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+// CheckAdminAddr makes sure AdminAddr, if set, binds to a loopback or
+// private address. The admin listener serves diagnostics without auth, so
+// it must never be reachable from the internet.
+func (cfg *Config) CheckAdminAddr() error {
+	if cfg.AdminAddr == "" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(cfg.AdminAddr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("host %q is not an IP address", host)
+	}
+	if !ip.IsLoopback() && !ip.IsPrivate() {
+		return fmt.Errorf("%s is not a loopback or private address", ip)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestCheckAdminAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{addr: "", ok: true},
+		{addr: "127.0.0.1:9090", ok: true},
+		{addr: "[::1]:9090", ok: true},
+		{addr: "localhost:9090", ok: true},
+		{addr: "10.1.2.3:9090", ok: true},
+		{addr: "192.168.0.10:9090", ok: true},
+		{addr: ":9090", ok: false},
+		{addr: "0.0.0.0:9090", ok: false},
+		{addr: "203.0.113.5:9090", ok: false},
+		{addr: "admin.example.com:9090", ok: false},
+		{addr: "127.0.0.1", ok: false},
+	}
+	for _, tt := range tests {
+		cfg := &Config{AdminAddr: tt.addr}
+		if err := cfg.CheckAdminAddr(); (err == nil) != tt.ok {
+			t.Errorf("CheckAdminAddr(%q) = %v, want ok=%v", tt.addr, err, tt.ok)
+		}
+	}
+}
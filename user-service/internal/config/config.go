@@ -3,9 +3,17 @@ package config
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// DefaultJWTSecret is only meant for local development.
+const DefaultJWTSecret = "user-service-secret-word"
+
 type Config struct {
 	Port         string
 	DBHost       string
@@ -21,16 +29,196 @@ type Config struct {
 	SMTPUser     string
 	SMPTPass     string
 	SMTPFrom     string
+	SMTPReplyTo  string
 	MinioHost    string
 	MinioApiPort string
 	MinioUser    string
 	MinioPass    string
 	JWTSecret    string
+
+	// Per email type sender overrides; empty falls back to SMTPFrom and
+	// SMTPReplyTo.
+	SMTPVerificationFrom    string
+	SMTPVerificationReplyTo string
+	SMTPSupportFrom         string
+	SMTPSupportReplyTo      string
+
+	SMTPDialTimeout time.Duration
+	SMTPSendTimeout time.Duration
+
+	// PublicBaseURL is the absolute URL, scheme included, that links in
+	// emails point at, e.g. "https://api.example.com". It is required.
+	PublicBaseURL string
+
+	// EmailDailyCap is how many emails one recipient may get per day (0
+	// disables the cap); EmailCapExempt lists email types it doesn't cover,
+	// by default the verification and password reset emails a user asked
+	// for and can't do without.
+	EmailDailyCap  int
+	EmailCapExempt []string
+
+	// A user may file at most ReportRateLimit reports per ReportRateWindow
+	// (0 disables the limit).
+	ReportRateLimit  int
+	ReportRateWindow time.Duration
+
+	StorageQuotaBytes int64
+	StoragePlanQuotas map[string]int64
+
+	// AvatarRetainedVersions is how many avatar versions are kept per user,
+	// the current one included.
+	AvatarRetainedVersions int
+	// AvatarMaxPixels caps width × height of avatars that are cropped or
+	// rotated, since those are decoded in memory.
+	AvatarMaxPixels int64
+
+	// The storage reconciler deletes objects no user references. Objects
+	// younger than StorageReconcileMinAge are skipped; in dry-run mode
+	// orphans are only reported.
+	StorageReconcileInterval time.Duration
+	StorageReconcileMinAge   time.Duration
+	StorageReconcileDryRun   bool
+
+	// AdminAddr, if set (e.g. "127.0.0.1:9090"), moves /health, /readiness,
+	// /metrics and /diagnostics off the public port onto a plain HTTP
+	// listener, which must be bound to a loopback or private address.
+	// Without it /metrics takes an internal service token.
+	AdminAddr string
+
+	CORSAllowedOrigins   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+	// CORSUploadHeaders are extra request headers allowed on avatar uploads.
+	CORSUploadHeaders []string
+
+	// DebugBodySampleRate is the fraction of requests whose bodies are
+	// logged; DebugBodyAllowedIPs may force capture with "X-Debug: true".
+	DebugBodySampleRate float64
+	DebugBodyAllowedIPs []string
+
+	// TrustedProxies are the addresses or CIDRs whose X-Forwarded-For is
+	// believed when working out a client's IP. With none set the TCP peer
+	// is the client.
+	TrustedProxies []string
+
+	// TLS settings. The HTTP server terminates TLS only when both the cert
+	// and key files are set.
+	TLSMinVersion   string
+	TLSCipherSuites []string
+	TLSCertFile     string
+	TLSKeyFile      string
+	MinioUseTLS     bool
+
+	// GatewaySigningKey authenticates X-User-* headers set by the gateway.
+	GatewaySigningKey       string
+	GatewaySignatureMaxSkew time.Duration
+	RejectUntrustedIdentity bool
+
+	// BlacklistFailurePolicy is "open" or "closed": whether access tokens
+	// are accepted when Redis is down and revocation can't be checked.
+	BlacklistFailurePolicy string
+
+	// ErrorFormat is "custom" ({error, message}) or "problem" (RFC 7807
+	// problem+json). Clients can ask for problem+json per request with
+	// their Accept header either way. Problem types are ProblemTypeBase
+	// followed by the error code.
+	ErrorFormat     string
+	ProblemTypeBase string
+
+	// InternalServiceTokens maps trusted service names to shared secrets.
+	InternalServiceTokens map[string]string
+
+	JWTRefreshTTL    time.Duration
+	JWTAccessMaxAge  time.Duration
+	JWTRememberMeTTL time.Duration
+
+	// RefreshRaceWindow is the grace period during which a just-rotated
+	// refresh token still returns the pair it was rotated into.
+	RefreshRaceWindow time.Duration
+
+	// With SessionSliding each refresh pushes the session's expiry out by
+	// its refresh TTL again; without it the expiry set at login is kept.
+	// Either way a session never outlives SessionMaxLifetime after login
+	// (0 means no ceiling).
+	SessionSliding     bool
+	SessionMaxLifetime time.Duration
+
+	// RefreshSingleUse records each refresh token's jti in Redis when it is
+	// used, so a second use is caught even before the session row shows
+	// the rotation.
+	RefreshSingleUse bool
+
+	PasswordMinLength     int
+	PasswordMaxLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+
+	RegistrationEmailDomains []string
+
+	VerificationResendInterval time.Duration
+
+	// PasswordResetMode selects how resets are delivered: "link" emails a
+	// reset link, "code" a six-digit code to enter along with the email.
+	PasswordResetMode string
+	PasswordResetTTL  time.Duration
+
+	// ReadOnlyMode keeps this instance rejecting writes. Admins can also
+	// turn read-only mode on for every instance at runtime.
+	ReadOnlyMode bool
+
+	// Deleted accounts are purged AccountDeletionGrace after the request; a
+	// reminder goes out AccountDeletionReminder before that.
+	AccountDeletionGrace    time.Duration
+	AccountDeletionReminder time.Duration
+	AccountPurgeInterval    time.Duration
+
+	// OnboardingSequence lists the onboarding emails new users get, as
+	// "template:delay[:incomplete]" items; see service.ParseOnboardingSequence.
+	OnboardingSequence []string
+	OnboardingInterval time.Duration
+
+	// UnsubscribeSecret signs unsubscribe links; it defaults to JWTSecret.
+	// Changing it invalidates links in emails already sent.
+	UnsubscribeSecret string
+
+	// RequireEmailVerification withholds tokens from users who haven't
+	// verified their email: registration returns no tokens and login is
+	// refused. Routes guarded by RequireVerified reject them as well.
+	RequireEmailVerification bool
+
+	// A client IP may call verify-token at most VerifyTokenRateLimit times
+	// per VerifyTokenRateWindow; zero disables the limit.
+	VerifyTokenRateLimit  int
+	VerifyTokenRateWindow time.Duration
+
+	// LoginAlertsEnabled emails users on logins from devices they haven't
+	// marked as trusted.
+	LoginAlertsEnabled bool
+
+	// AuthMinimalUser makes login, register, refresh and reactivate return
+	// only id, username, avatar_url and is_verified for the user. Clients
+	// can override it per request with ?user=full or ?user=minimal.
+	AuthMinimalUser bool
+
+	DBMinConns    int32
+	WarmupEnabled bool
+
+	MaxConcurrentHashes  int
+	MigrationLockTimeout time.Duration
+	ReadinessInterval    time.Duration
+	ShutdownTimeout      time.Duration
+
+	// BcryptCost is the cost of new password hashes. Raising it upgrades
+	// existing hashes as their users log in.
+	BcryptCost int
 }
 
 func LoadConfig() *Config {
 	cfg := &Config{
 		Port:         getEnv("HTTP_PORT", "8080"),
+		AdminAddr:    getEnv("ADMIN_ADDR", ""),
 		DBHost:       getEnv("USER_DB_HOST", "localhost"),
 		DBPort:       getEnv("USER_DB_PORT", "5432"),
 		DBUser:       getEnv("USER_DB_USER", "user-service"),
@@ -42,12 +230,131 @@ func LoadConfig() *Config {
 		SMTPPort:     getEnvInt("SMTP_PORT", 587),
 		SMTPUser:     getEnv("SMTP_USER", "user-service@gmail.com"),
 		SMPTPass:     getEnv("SMTP_PASSWORD", "smtp-service"),
-		SMTPFrom:     getEnv("SMTP_FROM", "<nonreplay>@example.com"),
+		SMTPFrom:     getEnv("SMTP_FROM", "noreply@example.com"),
+		SMTPReplyTo:  getEnv("SMTP_REPLY_TO", ""),
 		MinioHost:    getEnv("MINIO_HOST", "localhost"),
 		MinioApiPort: getEnv("MINIO_API_PORT", "9000"),
 		MinioUser:    getEnv("MINIO_USER", "admin"),
 		MinioPass:    getEnv("MINIO_PASS", "admin123"),
-		JWTSecret:    getEnv("JWT_SECRET", "user-service-secret-word"),
+		JWTSecret:    getEnv("JWT_SECRET", DefaultJWTSecret),
+
+		SMTPVerificationFrom:    getEnv("SMTP_VERIFICATION_FROM", ""),
+		SMTPVerificationReplyTo: getEnv("SMTP_VERIFICATION_REPLY_TO", ""),
+		SMTPSupportFrom:         getEnv("SMTP_SUPPORT_FROM", ""),
+		SMTPSupportReplyTo:      getEnv("SMTP_SUPPORT_REPLY_TO", ""),
+
+		SMTPDialTimeout: getEnvDuration("SMTP_DIAL_TIMEOUT", 10*time.Second),
+		SMTPSendTimeout: getEnvDuration("SMTP_SEND_TIMEOUT", 30*time.Second),
+
+		PublicBaseURL: getEnv("PUBLIC_BASE_URL", ""),
+
+		EmailDailyCap:  getEnvInt("EMAIL_DAILY_CAP", 20),
+		EmailCapExempt: getEnvList("EMAIL_CAP_EXEMPT"),
+
+		ReportRateLimit:  getEnvInt("REPORT_RATE_LIMIT", 5),
+		ReportRateWindow: getEnvDuration("REPORT_RATE_WINDOW", time.Hour),
+
+		StorageQuotaBytes: getEnvInt64("STORAGE_QUOTA_BYTES", 10<<20),
+		StoragePlanQuotas: getEnvInt64Map("STORAGE_PLAN_QUOTAS"),
+
+		AvatarRetainedVersions: getEnvInt("AVATAR_RETAINED_VERSIONS", 1),
+		AvatarMaxPixels:        getEnvInt64("AVATAR_MAX_PIXELS", 40_000_000),
+
+		StorageReconcileInterval: getEnvDuration("STORAGE_RECONCILE_INTERVAL", 24*time.Hour),
+		StorageReconcileMinAge:   getEnvDuration("STORAGE_RECONCILE_MIN_AGE", time.Hour),
+		StorageReconcileDryRun:   getEnvBool("STORAGE_RECONCILE_DRY_RUN", true),
+
+		CORSAllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS"),
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           getEnvDuration("CORS_MAX_AGE", 12*time.Hour),
+		CORSUploadHeaders:    getEnvList("CORS_UPLOAD_HEADERS"),
+
+		DebugBodySampleRate: getEnvFloat("DEBUG_BODY_SAMPLE_RATE", 0),
+		DebugBodyAllowedIPs: getEnvList("DEBUG_BODY_ALLOWED_IPS"),
+
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+
+		TLSMinVersion:   getEnv("TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites: getEnvList("TLS_CIPHER_SUITES"),
+		TLSCertFile:     getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:      getEnv("TLS_KEY_FILE", ""),
+		MinioUseTLS:     getEnvBool("MINIO_USE_TLS", false),
+
+		GatewaySigningKey:       getEnv("GATEWAY_SIGNING_KEY", ""),
+		GatewaySignatureMaxSkew: getEnvDuration("GATEWAY_SIGNATURE_MAX_SKEW", 5*time.Minute),
+		RejectUntrustedIdentity: getEnvBool("REJECT_UNTRUSTED_IDENTITY_HEADERS", false),
+
+		BlacklistFailurePolicy: getEnv("BLACKLIST_FAILURE_POLICY", "open"),
+		ErrorFormat:            getEnv("ERROR_FORMAT", "custom"),
+		ProblemTypeBase:        getEnv("PROBLEM_TYPE_BASE", "urn:apex:problem:"),
+
+		InternalServiceTokens: getEnvMap("INTERNAL_SERVICE_TOKENS"),
+
+		JWTRefreshTTL:    getEnvDuration("JWT_REFRESH_TTL", 7*24*time.Hour),
+		JWTAccessMaxAge:  getEnvDuration("JWT_ACCESS_MAX_AGE", 0),
+		JWTRememberMeTTL: getEnvDuration("JWT_REMEMBER_ME_REFRESH_TTL", 30*24*time.Hour),
+
+		RefreshRaceWindow: getEnvDuration("REFRESH_RACE_WINDOW", 10*time.Second),
+
+		SessionSliding:     getEnvBool("SESSION_SLIDING_EXPIRATION", true),
+		SessionMaxLifetime: getEnvDuration("SESSION_MAX_LIFETIME", 90*24*time.Hour),
+		RefreshSingleUse:   getEnvBool("REFRESH_SINGLE_USE", true),
+
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:     getEnvInt("PASSWORD_MAX_LENGTH", 32),
+		PasswordRequireUpper:  getEnvBool("PASSWORD_REQUIRE_UPPER", false),
+		PasswordRequireLower:  getEnvBool("PASSWORD_REQUIRE_LOWER", false),
+		PasswordRequireDigit:  getEnvBool("PASSWORD_REQUIRE_DIGIT", false),
+		PasswordRequireSymbol: getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+
+		RegistrationEmailDomains: getEnvList("REGISTRATION_EMAIL_DOMAINS"),
+
+		VerificationResendInterval: getEnvDuration("VERIFICATION_RESEND_INTERVAL", time.Minute),
+
+		PasswordResetMode: getEnv("PASSWORD_RESET_MODE", "link"),
+		PasswordResetTTL:  getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+
+		ReadOnlyMode: getEnvBool("READ_ONLY_MODE", false),
+
+		AccountDeletionGrace:    getEnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		AccountDeletionReminder: getEnvDuration("ACCOUNT_DELETION_REMINDER", 3*24*time.Hour),
+		AccountPurgeInterval:    getEnvDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
+
+		OnboardingSequence: getEnvList("ONBOARDING_SEQUENCE"),
+		OnboardingInterval: getEnvDuration("ONBOARDING_INTERVAL", 15*time.Minute),
+
+		UnsubscribeSecret: getEnv("UNSUBSCRIBE_SECRET", ""),
+
+		RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", false),
+
+		VerifyTokenRateLimit:  getEnvInt("VERIFY_TOKEN_RATE_LIMIT", 30),
+		VerifyTokenRateWindow: getEnvDuration("VERIFY_TOKEN_RATE_WINDOW", time.Minute),
+
+		LoginAlertsEnabled: getEnvBool("LOGIN_ALERTS_ENABLED", false),
+		AuthMinimalUser:    getEnvBool("AUTH_MINIMAL_USER", false),
+
+		DBMinConns:    int32(getEnvInt("DB_MIN_CONNS", 2)),
+		WarmupEnabled: getEnvBool("WARMUP_ENABLED", true),
+
+		MaxConcurrentHashes:  getEnvInt("MAX_CONCURRENT_HASHES", runtime.GOMAXPROCS(0)),
+		MigrationLockTimeout: getEnvDuration("MIGRATION_LOCK_TIMEOUT", 5*time.Minute),
+		ReadinessInterval:    getEnvDuration("READINESS_CHECK_INTERVAL", 2*time.Second),
+		ShutdownTimeout:      getEnvDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+
+		BcryptCost: getEnvInt("BCRYPT_COST", bcrypt.DefaultCost),
+	}
+
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		cfg.CORSAllowedOrigins = []string{"*"}
+	}
+	if cfg.UnsubscribeSecret == "" {
+		cfg.UnsubscribeSecret = cfg.JWTSecret
+	}
+	if len(cfg.EmailCapExempt) == 0 {
+		cfg.EmailCapExempt = []string{"verification", "password_reset"}
+	}
+	if len(cfg.OnboardingSequence) == 0 {
+		cfg.OnboardingSequence = []string{"welcome:0s", "tips:72h:incomplete"}
 	}
 
 	cfg.DBUrl = cfg.getDBUrl()
@@ -73,6 +380,91 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		valueInt, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return defaultValue
+		}
+		return valueInt
+	}
+	return defaultValue
+}
+
+// getEnvList parses a comma-separated list, dropping empty items.
+func getEnvList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvMap parses "key=value,key=value"; malformed pairs are skipped.
+func getEnvMap(key string) map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" || value == "" {
+			continue
+		}
+		result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return result
+}
+
+// getEnvInt64Map parses "key=value,key=value"; malformed pairs are skipped.
+func getEnvInt64Map(key string) map[string]int64 {
+	result := map[string]int64{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		valueInt, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		result[strings.TrimSpace(name)] = valueInt
+	}
+	return result
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		valueFloat, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return defaultValue
+		}
+		return valueFloat
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		valueBool, err := strconv.ParseBool(value)
+		if err != nil {
+			return defaultValue
+		}
+		return valueBool
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		valueDuration, err := time.ParseDuration(value)
+		if err != nil {
+			return defaultValue
+		}
+		return valueDuration
+	}
+	return defaultValue
+}
+
 func (cfg *Config) getDBUrl() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEmailCapExemptDefault(t *testing.T) {
+	t.Setenv("EMAIL_CAP_EXEMPT", "")
+	if got := LoadConfig().EmailCapExempt; !slices.Equal(got, []string{"verification", "password_reset"}) {
+		t.Errorf("default EmailCapExempt = %v, want the security emails", got)
+	}
+
+	t.Setenv("EMAIL_CAP_EXEMPT", "login_alert")
+	if got := LoadConfig().EmailCapExempt; !slices.Equal(got, []string{"login_alert"}) {
+		t.Errorf("EmailCapExempt = %v, want the configured list", got)
+	}
+}
+
+func TestPasswordPolicyDefaults(t *testing.T) {
+	for _, key := range []string{"PASSWORD_MIN_LENGTH", "PASSWORD_MAX_LENGTH", "PASSWORD_REQUIRE_UPPER",
+		"PASSWORD_REQUIRE_LOWER", "PASSWORD_REQUIRE_DIGIT", "PASSWORD_REQUIRE_SYMBOL"} {
+		t.Setenv(key, "")
+	}
+
+	// The defaults keep the length-only 8-32 rule registration always had.
+	cfg := LoadConfig()
+	if cfg.PasswordMinLength != 8 || cfg.PasswordMaxLength != 32 {
+		t.Errorf("default length = %d-%d, want 8-32", cfg.PasswordMinLength, cfg.PasswordMaxLength)
+	}
+	if cfg.PasswordRequireUpper || cfg.PasswordRequireLower || cfg.PasswordRequireDigit || cfg.PasswordRequireSymbol {
+		t.Error("default policy requires character classes")
+	}
+}
+
+func TestAvatarRetainedVersionsDefault(t *testing.T) {
+	t.Setenv("AVATAR_RETAINED_VERSIONS", "")
+	if got := LoadConfig().AvatarRetainedVersions; got != 1 {
+		t.Errorf("default AvatarRetainedVersions = %d, want 1 (only the current avatar)", got)
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CheckIntervals makes sure the intervals background jobs tick at are
+// positive; time.NewTicker panics otherwise.
+func (cfg *Config) CheckIntervals() error {
+	intervals := []struct {
+		env   string
+		value time.Duration
+	}{
+		{"READINESS_CHECK_INTERVAL", cfg.ReadinessInterval},
+		{"ACCOUNT_PURGE_INTERVAL", cfg.AccountPurgeInterval},
+		{"ONBOARDING_INTERVAL", cfg.OnboardingInterval},
+		{"STORAGE_RECONCILE_INTERVAL", cfg.StorageReconcileInterval},
+	}
+	for _, interval := range intervals {
+		if interval.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", interval.env, interval.value)
+		}
+	}
+	return nil
+}
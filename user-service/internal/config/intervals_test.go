@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckIntervals(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			ReadinessInterval:        2 * time.Second,
+			AccountPurgeInterval:     time.Hour,
+			OnboardingInterval:       15 * time.Minute,
+			StorageReconcileInterval: 24 * time.Hour,
+		}
+	}
+	if err := valid().CheckIntervals(); err != nil {
+		t.Fatalf("valid intervals: %v", err)
+	}
+
+	for _, d := range []time.Duration{0, -time.Minute} {
+		cfg := valid()
+		cfg.StorageReconcileInterval = d
+		err := cfg.CheckIntervals()
+		if err == nil || !strings.Contains(err.Error(), "STORAGE_RECONCILE_INTERVAL") {
+			t.Errorf("reconcile interval %s: err = %v, want it named", d, err)
+		}
+	}
+}
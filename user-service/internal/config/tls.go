@@ -0,0 +1,44 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig builds the TLS settings shared by every TLS surface of the
+// service: the HTTP server when it terminates TLS, and the SMTP and MinIO
+// clients. Cipher suites only apply up to TLS 1.2; TLS 1.3 suites are not
+// configurable in Go.
+func (cfg *Config) TLSConfig() (*tls.Config, error) {
+	minVersion, ok := tlsVersions[cfg.TLSMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS_MIN_VERSION %q", cfg.TLSMinVersion)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: minVersion}
+
+	if len(cfg.TLSCipherSuites) > 0 {
+		byName := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			byName[suite.Name] = suite.ID
+		}
+
+		for _, name := range cfg.TLSCipherSuites {
+			id, ok := byName[strings.ToUpper(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSMinVersionRejectsOlderHandshakes(t *testing.T) {
+	cfg := &Config{TLSMinVersion: "1.2"}
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	handshake := func(maxVersion uint16) error {
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS10,
+			MaxVersion:         maxVersion,
+		})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	if err := handshake(tls.VersionTLS11); err == nil {
+		t.Error("TLS 1.1 handshake succeeded against a 1.2 minimum")
+	}
+	if err := handshake(tls.VersionTLS12); err != nil {
+		t.Errorf("TLS 1.2 handshake: %v", err)
+	}
+}
+
+func TestTLSConfigRejectsUnknownSettings(t *testing.T) {
+	if _, err := (&Config{TLSMinVersion: "1.4"}).TLSConfig(); err == nil {
+		t.Error("accepted TLS_MIN_VERSION 1.4")
+	}
+
+	// Insecure suites aren't in tls.CipherSuites, so they can't be selected.
+	cfg := &Config{TLSMinVersion: "1.2", TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}
+	if _, err := cfg.TLSConfig(); err == nil {
+		t.Error("accepted an insecure cipher suite")
+	}
+
+	cfg.TLSCipherSuites = []string{"tls_ecdhe_rsa_with_aes_128_gcm_sha256"}
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tlsConfig.CipherSuites) != 1 || tlsConfig.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("cipher suites = %v", tlsConfig.CipherSuites)
+	}
+}
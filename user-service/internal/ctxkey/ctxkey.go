@@ -0,0 +1,27 @@
+// Package ctxkey defines the keys request-scoped values are stored under in
+// the gin context. The key type is unexported, so values set here can't
+// collide with plain string keys set by other middleware.
+package ctxkey
+
+import "github.com/gin-gonic/gin"
+
+type key string
+
+const (
+	UserID         key = "user_id"
+	Username       key = "username"
+	Email          key = "email"
+	Entitlements   key = "entitlements"
+	EmailVerified  key = "email_verified"
+	APITokenScopes key = "api_token_scopes"
+	Service        key = "service"
+	ReadOnly       key = "read_only"
+)
+
+// Get returns the value stored under k, or the zero value of T if it's
+// missing or was stored with a different type.
+func Get[T any](c *gin.Context, k key) T {
+	value, _ := c.Get(k)
+	typed, _ := value.(T)
+	return typed
+}
@@ -0,0 +1,43 @@
+package ctxkey
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGet(t *testing.T) {
+	c := &gin.Context{}
+	c.Set(UserID, int64(42))
+	c.Set(Username, "alice")
+
+	if got := Get[int64](c, UserID); got != 42 {
+		t.Errorf("UserID = %d, want 42", got)
+	}
+	if got := Get[string](c, Username); got != "alice" {
+		t.Errorf("Username = %q, want alice", got)
+	}
+
+	// A value stored with another type reads as the zero value instead of
+	// panicking.
+	c.Set(Email, 7)
+	if got := Get[string](c, Email); got != "" {
+		t.Errorf("Email stored as int = %q, want empty", got)
+	}
+	if got := Get[int64](c, Service); got != 0 {
+		t.Errorf("missing key = %d, want 0", got)
+	}
+}
+
+func TestKeysDontCollideWithStrings(t *testing.T) {
+	c := &gin.Context{}
+	c.Set("user_id", "spoofed")
+	c.Set(UserID, int64(42))
+
+	if got := Get[int64](c, UserID); got != 42 {
+		t.Errorf("UserID = %d, want 42", got)
+	}
+	if got, _ := c.Get("user_id"); got != "spoofed" {
+		t.Errorf(`plain "user_id" = %v, want it untouched`, got)
+	}
+}
@@ -1,42 +1,209 @@
 package dto
 
-import "github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+import (
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
 
 type RegisterUserRequest struct {
-	Username    string `json:"username" binding:"required,min=3,max=50"`
-	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=8,max=32"`
-	DisplayName string `json:"display_name,omitempty" binding:"max=50"`
+	Username    string `json:"username" form:"username" binding:"required,min=3,max=50"`
+	Email       string `json:"email" form:"email" binding:"required,email,max=255"`
+	Password    string `json:"password" form:"password" binding:"required"`
+	DisplayName string `json:"display_name,omitempty" form:"display_name" binding:"max=50"`
 }
 
 type LoginRequest struct {
-	Login    string `json:"login" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Login      string `json:"login" form:"login" binding:"required"`
+	Password   string `json:"password" form:"password" binding:"required"`
+	RememberMe bool   `json:"remember_me" form:"remember_me"`
+	// DeviceID and DeviceSecret are alternatives to the X-Device-ID and
+	// X-Device-Secret headers.
+	DeviceID     string `json:"device_id,omitempty" form:"device_id"`
+	DeviceSecret string `json:"device_secret,omitempty" form:"device_secret"`
 }
 
 type AuthResponse struct {
-	AccessToken  string       `json:"access_token"`
-	RefreshToken string       `json:"refresh_token"`
-	ExpiresIn    int64        `json:"expires_in"`
-	User         *models.User `json:"user"`
+	AccessToken      string       `json:"access_token"`
+	RefreshToken     string       `json:"refresh_token"`
+	ExpiresIn        int64        `json:"expires_in"`
+	RefreshExpiresIn int64        `json:"refresh_expires_in"`
+	User             *models.User `json:"user"`
+}
+
+// MinimalUser is the subset of a user returned by the token endpoints when
+// the full record isn't wanted; clients fetch /users/me for the rest.
+type MinimalUser struct {
+	ID         int64   `json:"id"`
+	Username   string  `json:"username"`
+	AvatarURL  *string `json:"avatar_url,omitempty"`
+	IsVerified bool    `json:"is_verified"`
+}
+
+// MinimalAuthResponse is an AuthResponse whose user is trimmed to a
+// MinimalUser. The outer User field shadows the embedded one when encoded.
+type MinimalAuthResponse struct {
+	*AuthResponse
+	User *MinimalUser `json:"user"`
+}
+
+func NewMinimalAuthResponse(resp *AuthResponse) *MinimalAuthResponse {
+	return &MinimalAuthResponse{AuthResponse: resp, User: NewMinimalUser(resp.User)}
+}
+
+func NewMinimalUser(u *models.User) *MinimalUser {
+	if u == nil {
+		return nil
+	}
+	return &MinimalUser{
+		ID:         u.ID,
+		Username:   u.Username,
+		AvatarURL:  u.AvatarURL,
+		IsVerified: u.IsVerified,
+	}
+}
+
+// RegistrationPendingResponse answers a registration that must verify its
+// email before it gets a session. User is a *models.User or *MinimalUser.
+type RegistrationPendingResponse struct {
+	Message              string `json:"message"`
+	VerificationRequired bool   `json:"verification_required"`
+	User                 any    `json:"user"`
+}
+
+type AdminUserResponse struct {
+	*models.User
+	ActiveSessions int `json:"active_sessions"`
 }
 
 type UpdateUserRequest struct {
 	DisplayName *string `json:"display_name,omitempty" binding:"omitempty,max=100"`
 	Bio         *string `json:"bio,omitempty" binding:"omitempty,max=500"`
-	Status      *string `json:"status,omitempty" binding:"omitempty,oneof=online offline away busy"`
+	Status      *string `json:"status,omitempty"`
+	// EmailPreferences is "all" or "essential".
+	EmailPreferences *string `json:"email_preferences,omitempty"`
 }
 
+// TokensRequest is the logout body. AccessToken may be omitted when it is
+// sent in the Authorization header instead.
 type TokensRequest struct {
-	AccessToken  string `json:"access_token" binding:"required"`
-	RefreshToken string `json:"refresh_token" binding:"required"`
+	AccessToken  string `json:"access_token" form:"access_token"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" form:"email" binding:"required,email"`
 }
 
 type RefreshTokenRequest struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token" binding:"required"`
+}
+
+// VerifyTokenRequest carries the access token to check; it may be sent in
+// the Authorization header instead.
+type VerifyTokenRequest struct {
+	Token string `json:"token" form:"token"`
+}
+
+// VerifyTokenResponse reports whether an access token is usable. Invalid
+// tokens only carry a Reason.
+type VerifyTokenResponse struct {
+	Valid     bool       `json:"valid"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UserID    int64      `json:"user_id,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes,omitempty"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" binding:"omitempty,min=1,max=365"`
+}
+
+// CreateAPITokenResponse is the only response that ever carries the
+// plaintext token.
+type CreateAPITokenResponse struct {
+	*models.APIToken
+	Token string `json:"token"`
 }
 
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	Error   string            `json:"error"`
+	Message string            `json:"message,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// AvatarTransformRequest holds the optional transform fields of an avatar
+// upload. The crop is either given in full or not at all.
+type AvatarTransformRequest struct {
+	CropX  *int `form:"crop_x" binding:"omitempty,min=0"`
+	CropY  *int `form:"crop_y" binding:"omitempty,min=0"`
+	CropW  *int `form:"crop_w" binding:"omitempty,min=1"`
+	CropH  *int `form:"crop_h" binding:"omitempty,min=1"`
+	Rotate int  `form:"rotate"`
+}
+
+type AvatarBatchRequest struct {
+	UserIDs []int64 `json:"user_ids" binding:"required,min=1,max=100,dive,min=1"`
+}
+
+type AvatarBatchResponse struct {
+	Avatars map[int64]string `json:"avatars"`
+}
+
+type BodyLoggingRequest struct {
+	SampleRate float64 `json:"sample_rate" binding:"min=0,max=1"`
+}
+
+type ReadOnlyModeRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+type ListUsersResponse struct {
+	Users      []*models.PublicUser `json:"users"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+	Limit      int                  `json:"limit"`
+	Offset     int                  `json:"offset,omitempty"`
+	// Total is the number of matches, only reported for searches.
+	Total *int `json:"total,omitempty"`
+}
+
+// VerificationExpiredResponse tells the client the link was valid but too
+// old, so it can offer to resend it right away.
+type VerificationExpiredResponse struct {
+	ErrorResponse
+	ExpiredAt       *time.Time `json:"expired_at,omitempty"`
+	ResendAvailable bool       `json:"resend_available"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" form:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest carries either the token from a reset link or, in
+// code mode, the email and the code sent to it.
+type ResetPasswordRequest struct {
+	Token       string `json:"token,omitempty" form:"token" binding:"required_without=Code"`
+	Email       string `json:"email,omitempty" form:"email" binding:"required_with=Code,omitempty,email"`
+	Code        string `json:"code,omitempty" form:"code" binding:"required_without=Token,omitempty,len=6,numeric"`
+	NewPassword string `json:"new_password" form:"new_password" binding:"required"`
+}
+
+type TrustDeviceRequest struct {
+	Label *string `json:"label" binding:"omitempty,max=100"`
+}
+
+type ReportUserRequest struct {
+	Reason  string  `json:"reason" binding:"required"`
+	Details *string `json:"details" binding:"omitempty,max=1000"`
+}
+
+type ResolveReportRequest struct {
+	Status string  `json:"status" binding:"required,oneof=resolved dismissed"`
+	Note   *string `json:"note" binding:"omitempty,max=1000"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" form:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" form:"new_password" binding:"required"`
 }
@@ -0,0 +1,68 @@
+package dto
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+func encodeUser(t *testing.T, v any) map[string]any {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		AccessToken string         `json:"access_token"`
+		User        map[string]any `json:"user"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.AccessToken != "access" {
+		t.Errorf("access_token = %q, want the embedded response's token", body.AccessToken)
+	}
+	return body.User
+}
+
+func TestMinimalAuthResponseShadowsUser(t *testing.T) {
+	avatar, name := "https://cdn.example.com/a.png", "Alice"
+	resp := &AuthResponse{
+		AccessToken: "access",
+		User: &models.User{
+			ID: 7, Username: "alice", Email: "alice@example.com", PasswordHash: "hash",
+			DisplayName: &name, AvatarURL: &avatar, Role: "user", Plan: "free", IsVerified: true,
+		},
+	}
+
+	minimal := encodeUser(t, NewMinimalAuthResponse(resp))
+	var keys []string
+	for k := range minimal {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if want := []string{"avatar_url", "id", "is_verified", "username"}; !slices.Equal(keys, want) {
+		t.Errorf("minimal user keys = %v, want %v", keys, want)
+	}
+
+	full := encodeUser(t, resp)
+	for _, k := range []string{"email", "display_name", "role", "plan", "created_at"} {
+		if _, ok := full[k]; !ok {
+			t.Errorf("full user is missing %s", k)
+		}
+	}
+	if _, ok := full["password_hash"]; ok {
+		t.Error("full user leaks the password hash")
+	}
+}
+
+func TestNewMinimalUserNil(t *testing.T) {
+	if NewMinimalUser(nil) != nil {
+		t.Error("NewMinimalUser(nil) != nil")
+	}
+	if got := encodeUser(t, NewMinimalAuthResponse(&AuthResponse{AccessToken: "access"})); got != nil {
+		t.Errorf("user = %v, want null", got)
+	}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+type AdminHandler struct {
+	userRepo    *repository.UserRepository
+	sessionRepo *repository.SessionRepository
+	bodyLogger  *middleware.BodyLogger
+	readOnly    *middleware.ReadOnly
+}
+
+func NewAdminHandler(userRepo *repository.UserRepository, sessionRepo *repository.SessionRepository, bodyLogger *middleware.BodyLogger, readOnly *middleware.ReadOnly) *AdminHandler {
+	return &AdminHandler{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		bodyLogger:  bodyLogger,
+		readOnly:    readOnly,
+	}
+}
+
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	var uriParam struct {
+		ID int64 `uri:"id" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindUri(&uriParam); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), uriParam.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "user_not_found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	activeSessions, err := h.sessionRepo.CountActiveByUserID(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.AdminUserResponse{
+		User:           user,
+		ActiveSessions: activeSessions,
+	})
+}
+
+// VerifyUserEmail marks a user's email verified without a token, for users
+// whose verification emails never arrive. Verifying a verified user is a
+// no-op.
+func (h *AdminHandler) VerifyUserEmail(c *gin.Context) {
+	var uriParam struct {
+		ID int64 `uri:"id" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindUri(&uriParam); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), uriParam.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "user_not_found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	if user.IsVerified {
+		c.JSON(http.StatusOK, gin.H{
+			"message":          "Email is already verified",
+			"already_verified": true,
+		})
+		return
+	}
+
+	if err := h.userRepo.MarkVerified(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	log.Printf("audit: admin %d manually verified email of user %d", middleware.GetUserID(c), user.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Email verified",
+		"already_verified": false,
+	})
+}
+
+func (h *AdminHandler) GetBodyLogging(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.BodyLoggingRequest{SampleRate: h.bodyLogger.SampleRate()})
+}
+
+// SetBodyLogging changes the debug body capture sample rate until the next
+// restart, which resets it to the configured value.
+func (h *AdminHandler) SetBodyLogging(c *gin.Context) {
+	var req dto.BodyLoggingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.bodyLogger.SetSampleRate(req.SampleRate)
+	c.JSON(http.StatusOK, dto.BodyLoggingRequest{SampleRate: h.bodyLogger.SampleRate()})
+}
+
+func (h *AdminHandler) GetReadOnlyMode(c *gin.Context) {
+	enabled := h.readOnly.Enabled(c.Request.Context())
+	c.JSON(http.StatusOK, dto.ReadOnlyModeRequest{Enabled: &enabled})
+}
+
+// SetReadOnlyMode turns maintenance read-only mode on or off for every
+// instance. Instances started with READ_ONLY_MODE stay read-only.
+func (h *AdminHandler) SetReadOnlyMode(c *gin.Context) {
+	var req dto.ReadOnlyModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.readOnly.SetEnabled(c.Request.Context(), *req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to change read-only mode",
+		})
+		return
+	}
+	log.Printf("read-only mode set to %t by user %d", *req.Enabled, middleware.GetUserID(c))
+	c.JSON(http.StatusOK, req)
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+// adminEnv serves the admin routes behind RequireRole, with the caller
+// chosen per request through the X-Test-User header.
+type adminEnv struct {
+	*avatarEnv
+	router *gin.Engine
+}
+
+func newAdminEnv(t *testing.T) *adminEnv {
+	t.Helper()
+
+	e := &adminEnv{avatarEnv: newAvatarEnv(t, 1)}
+	h := NewAdminHandler(e.users, repository.NewSessionRepository(e.db), nil, nil)
+
+	e.router = gin.New()
+	e.router.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set(ctxkey.UserID, id)
+	})
+	admin := e.router.Group("/admin")
+	admin.Use(middleware.RequireRole(e.users, models.RoleAdmin))
+	admin.GET("/users/:id", h.GetUser)
+	admin.POST("/users/:id/verify-email", h.VerifyUserEmail)
+	return e
+}
+
+func (e *adminEnv) createAdmin(t *testing.T, username string) *models.User {
+	t.Helper()
+	user := e.createUser(t, username)
+	if _, err := e.db.Exec(context.Background(), `UPDATE users SET role = $1 WHERE id = $2`, models.RoleAdmin, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func (e *adminEnv) do(caller *models.User, method, path string) *httptest.ResponseRecorder {
+	return doJSON(e.router, method, path, nil, http.Header{"X-Test-User": {strconv.FormatInt(caller.ID, 10)}})
+}
+
+func TestAdminGetUserShowsPrivateFields(t *testing.T) {
+	e := newAdminEnv(t)
+	admin, alice := e.createAdmin(t, "admin"), e.createUser(t, "alice")
+
+	w := e.do(admin, http.MethodGet, fmt.Sprintf("/admin/users/%d", alice.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"email", "is_verified", "created_at", "active_sessions"} {
+		if _, ok := body[field]; !ok {
+			t.Errorf("response has no %s: %s", field, w.Body)
+		}
+	}
+	if body["email"] != "alice@example.com" {
+		t.Errorf("email = %v", body["email"])
+	}
+	if _, ok := body["password_hash"]; ok {
+		t.Error("response includes the password hash")
+	}
+
+	if w := e.do(admin, http.MethodGet, "/admin/users/999999"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status = %d, want 404", w.Code)
+	}
+}
+
+func TestAdminRoutesRejectNonAdmins(t *testing.T) {
+	e := newAdminEnv(t)
+	alice, bob := e.createUser(t, "alice"), e.createUser(t, "bob")
+
+	w := e.do(alice, http.MethodGet, fmt.Sprintf("/admin/users/%d", bob.ID))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "bob@example.com") {
+		t.Error("403 response leaks the user's email")
+	}
+}
+
+func TestAdminVerifyEmail(t *testing.T) {
+	e := newAdminEnv(t)
+	admin, alice, bob := e.createAdmin(t, "admin"), e.createUser(t, "alice"), e.createUser(t, "bob")
+	path := fmt.Sprintf("/admin/users/%d/verify-email", alice.ID)
+
+	var audit bytes.Buffer
+	log.SetOutput(&audit)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	verify := func(caller *models.User) (int, map[string]any) {
+		t.Helper()
+		w := e.do(caller, http.MethodPost, path)
+		var body map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+	stored := func() *models.User {
+		t.Helper()
+		user, err := e.users.GetByID(context.Background(), alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+
+	if code, _ := verify(bob); code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d, want 403", code)
+	}
+	if stored().IsVerified {
+		t.Fatal("a non-admin verified alice")
+	}
+
+	if code, body := verify(admin); code != http.StatusOK || body["already_verified"] != false {
+		t.Fatalf("verify: %d %v", code, body)
+	}
+	verified := stored()
+	if !verified.IsVerified {
+		t.Fatal("alice not verified")
+	}
+	want := fmt.Sprintf("admin %d manually verified email of user %d", admin.ID, alice.ID)
+	if !strings.Contains(audit.String(), want) {
+		t.Errorf("no audit entry %q in %q", want, audit.String())
+	}
+
+	audit.Reset()
+	if code, body := verify(admin); code != http.StatusOK || body["already_verified"] != true {
+		t.Errorf("second verify: %d %v, want 200 with already_verified", code, body)
+	}
+	if again := stored(); !again.UpdatedAt.Equal(verified.UpdatedAt) {
+		t.Error("verifying a verified user updated it")
+	}
+	if strings.Contains(audit.String(), "manually verified") {
+		t.Error("the no-op was audited as a verification")
+	}
+
+	if w := e.do(admin, http.MethodPost, "/admin/users/999999/verify-email"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status = %d, want 404", w.Code)
+	}
+}
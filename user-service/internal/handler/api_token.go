@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
+)
+
+type APITokenHandler struct {
+	tokenService *service.APITokenService
+}
+
+func NewAPITokenHandler(tokenService *service.APITokenService) *APITokenHandler {
+	return &APITokenHandler{tokenService: tokenService}
+}
+
+func (h *APITokenHandler) Create(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var req dto.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	token, plaintext, err := h.tokenService.Create(c.Request.Context(), userID, req.Name, req.Scopes, ttl)
+	if err != nil {
+		var fieldErrs validator.FieldErrors
+		if errors.As(err, &fieldErrs) {
+			respondFieldErrors(c, fieldErrs)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to create token",
+		})
+		return
+	}
+
+	respondCreated(c, fmt.Sprintf("/api/v1/auth/tokens/%d", token.ID), dto.CreateAPITokenResponse{
+		APIToken: token,
+		Token:    plaintext,
+	})
+}
+
+func (h *APITokenHandler) List(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	tokens, err := h.tokenService.List(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"total":  len(tokens),
+	})
+}
+
+func (h *APITokenHandler) Get(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var uriParam struct {
+		ID int64 `uri:"id" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindUri(&uriParam); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid token ID",
+		})
+		return
+	}
+
+	token, err := h.tokenService.Get(c.Request.Context(), userID, uriParam.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPITokenNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "token_not_found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+func (h *APITokenHandler) Revoke(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var uriParam struct {
+		ID int64 `uri:"id" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindUri(&uriParam); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid token ID",
+		})
+		return
+	}
+
+	err := h.tokenService.Revoke(c.Request.Context(), userID, uriParam.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPITokenNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "token_not_found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Token revoked successfully",
+	})
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+)
+
+// apiTokenEnv serves the token routes at their real paths, as the user
+// chosen per request through the X-Test-User header.
+type apiTokenEnv struct {
+	*avatarEnv
+	router *gin.Engine
+	tokens *service.APITokenService
+}
+
+func newAPITokenEnv(t *testing.T) *apiTokenEnv {
+	t.Helper()
+
+	e := &apiTokenEnv{avatarEnv: newAvatarEnv(t, 1)}
+	e.tokens = service.NewAPITokenService(repository.NewAPITokenRepository(e.db))
+	h := NewAPITokenHandler(e.tokens)
+	e.router = gin.New()
+	tokens := e.router.Group("/api/v1/auth/tokens", func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set(ctxkey.UserID, id)
+	})
+	tokens.POST("", h.Create)
+	tokens.GET("", h.List)
+	tokens.GET("/:id", h.Get)
+	tokens.DELETE("/:id", h.Revoke)
+	return e
+}
+
+func (e *apiTokenEnv) do(userID int64, method, path string, body any) *httptest.ResponseRecorder {
+	return doJSON(e.router, method, path, body, http.Header{"X-Test-User": {strconv.FormatInt(userID, 10)}})
+}
+
+func TestCreateAPITokenLocation(t *testing.T) {
+	e := newAPITokenEnv(t)
+	alice, bob := e.createUser(t, "alice"), e.createUser(t, "bob")
+
+	w := e.do(alice.ID, http.MethodPost, "/api/v1/auth/tokens", gin.H{"name": "ci"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", w.Code, w.Body)
+	}
+	var created struct {
+		ID    int64  `json:"id"`
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	location := w.Header().Get("Location")
+	if want := "/api/v1/auth/tokens/" + strconv.FormatInt(created.ID, 10); location != want {
+		t.Fatalf("Location = %q, want %q", location, want)
+	}
+
+	w = e.do(alice.ID, http.MethodGet, location, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET Location: status = %d, body %s", w.Code, w.Body)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["id"] != float64(created.ID) || got["name"] != "ci" {
+		t.Errorf("GET Location = %v", got)
+	}
+	if _, ok := got["token"]; ok {
+		t.Error("GET returns the plaintext token")
+	}
+
+	if w := e.do(bob.ID, http.MethodGet, location, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another user's token: status = %d, want 404", w.Code)
+	}
+}
+
+func TestAPITokenCreateListRevoke(t *testing.T) {
+	e := newAPITokenEnv(t)
+	alice, bob := e.createUser(t, "alice"), e.createUser(t, "bob")
+	ctx := context.Background()
+
+	var plaintexts []string
+	var ids []int64
+	for _, body := range []gin.H{{"name": "ci", "scopes": []string{"read"}}, {"name": "deploy", "scopes": []string{"read", "write"}}} {
+		w := e.do(alice.ID, http.MethodPost, "/api/v1/auth/tokens", body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %v: status = %d, body %s", body, w.Code, w.Body)
+		}
+		var created struct {
+			ID    int64  `json:"id"`
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Fatal(err)
+		}
+		if !service.IsAPIToken(created.Token) {
+			t.Fatalf("created token %q isn't a personal access token", created.Token)
+		}
+		plaintexts = append(plaintexts, created.Token)
+		ids = append(ids, created.ID)
+	}
+
+	list := func(userID int64) []map[string]any {
+		t.Helper()
+		w := e.do(userID, http.MethodGet, "/api/v1/auth/tokens", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: status = %d, body %s", w.Code, w.Body)
+		}
+		var body struct {
+			Tokens []map[string]any `json:"tokens"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Tokens
+	}
+
+	tokens := list(alice.ID)
+	if len(tokens) != 2 {
+		t.Fatalf("alice lists %d tokens, want 2", len(tokens))
+	}
+	for _, token := range tokens {
+		if _, ok := token["token"]; ok {
+			t.Errorf("listing returns the plaintext token: %v", token)
+		}
+	}
+	if tokens := list(bob.ID); len(tokens) != 0 {
+		t.Errorf("bob lists alice's tokens: %v", tokens)
+	}
+
+	revoke := "/api/v1/auth/tokens/" + strconv.FormatInt(ids[0], 10)
+	if w := e.do(bob.ID, http.MethodDelete, revoke, nil); w.Code != http.StatusNotFound {
+		t.Errorf("bob revoking alice's token: status = %d, want 404", w.Code)
+	}
+	if w := e.do(alice.ID, http.MethodDelete, revoke, nil); w.Code != http.StatusOK {
+		t.Fatalf("revoke: status = %d, body %s", w.Code, w.Body)
+	}
+
+	if tokens := list(alice.ID); len(tokens) != 1 || tokens[0]["id"] != float64(ids[1]) {
+		t.Errorf("after revoking, alice lists %v, want only the deploy token", tokens)
+	}
+	if _, err := e.tokens.Authenticate(ctx, plaintexts[0]); !errors.Is(err, service.ErrInvalidAPIToken) {
+		t.Errorf("revoked token authenticates: %v", err)
+	}
+	if _, err := e.tokens.Authenticate(ctx, plaintexts[1]); err != nil {
+		t.Errorf("remaining token no longer authenticates: %v", err)
+	}
+}
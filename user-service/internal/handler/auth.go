@@ -4,24 +4,49 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
 	"log"
 	"net/http"
 )
 
 type AuthHandler struct {
 	authService *service.AuthService
+	minimalUser bool
 }
 
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *service.AuthService, minimalUser bool) *AuthHandler {
+	return &AuthHandler{authService: authService, minimalUser: minimalUser}
+}
+
+// wantMinimalUser reports whether responses carry a MinimalUser: when
+// configured, unless overridden with ?user=minimal or ?user=full.
+func (h *AuthHandler) wantMinimalUser(c *gin.Context) bool {
+	switch c.Query("user") {
+	case "minimal":
+		return true
+	case "full":
+		return false
+	}
+	return h.minimalUser
+}
+
+// authBody shapes a token response: the full user by default, or a
+// MinimalUser per wantMinimalUser.
+func (h *AuthHandler) authBody(c *gin.Context, resp *dto.AuthResponse) any {
+	if h.wantMinimalUser(c) {
+		return dto.NewMinimalAuthResponse(resp)
+	}
+	return resp
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req dto.RegisterUserRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindBody(c, &req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error:   "validation_error",
 			Message: err.Error(),
@@ -29,10 +54,18 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	userAgent, ipAddress := getClientInfo(c)
-	authResp, err := h.authService.Register(c.Request.Context(), &req, userAgent, ipAddress)
+	authResp, err := h.authService.Register(c.Request.Context(), &req, getClientInfo(c))
 	log.Println(err)
 	if err != nil {
+		var fieldErrs validator.FieldErrors
+		if errors.As(err, &fieldErrs) {
+			respondFieldErrors(c, fieldErrs)
+			return
+		}
+		if errors.Is(err, service.ErrServiceBusy) {
+			respondBusy(c)
+			return
+		}
 		if errors.Is(err, service.ErrAlreadyUserExists) {
 			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
 				Error:   "user_exists",
@@ -47,21 +80,75 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, authResp)
+	if authResp.AccessToken == "" {
+		// REQUIRE_EMAIL_VERIFICATION: no session until the email is verified.
+		var user any = authResp.User
+		if h.wantMinimalUser(c) {
+			user = dto.NewMinimalUser(authResp.User)
+		}
+		c.JSON(http.StatusCreated, dto.RegistrationPendingResponse{
+			Message:              "Registration successful, verify your email address to log in",
+			VerificationRequired: true,
+			User:                 user,
+		})
+		return
+	}
+
+	respondCreated(c, "/api/v1/users/me", h.authBody(c, authResp))
+}
+
+func (h *AuthHandler) ValidateRegistration(c *gin.Context) {
+	var req dto.RegisterUserRequest
+	if err := bindBody(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err := h.authService.ValidateRegistration(c.Request.Context(), &req)
+	if err != nil {
+		var fieldErrs validator.FieldErrors
+		if errors.As(err, &fieldErrs) {
+			respondFieldErrors(c, fieldErrs)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to validate registration",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": true})
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req dto.LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindBody(c, &req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error:   "validation_error",
 			Message: err.Error(),
 		})
 		return
 	}
-	userAgent, ip := getClientInfo(c)
-	authResp, err := h.authService.Login(c.Request.Context(), &req, userAgent, ip)
+	client := getClientInfo(c)
+	if client.DeviceID == nil && req.DeviceID != "" {
+		if deviceID, ok := service.NormalizeDeviceID(req.DeviceID); ok {
+			client.DeviceID = &deviceID
+		}
+	}
+	if client.DeviceSecret == nil && req.DeviceSecret != "" {
+		client.DeviceSecret = &req.DeviceSecret
+	}
+
+	authResp, err := h.authService.Login(c.Request.Context(), &req, client)
 	if err != nil {
+		if errors.Is(err, service.ErrServiceBusy) {
+			respondBusy(c)
+			return
+		}
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
 				Error:   "invalid_credentials",
@@ -69,6 +156,13 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			})
 			return
 		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "email_not_verified",
+				Message: "Verify your email address before logging in",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error:   "internal_error",
 			Message: "Failed to login",
@@ -76,12 +170,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, authResp)
+	c.JSON(http.StatusOK, h.authBody(c, authResp))
 }
 
 func (h *AuthHandler) Logout(c *gin.Context) {
 	var req dto.TokensRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindBody(c, &req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error:   "validation_error",
 			Message: err.Error(),
@@ -89,6 +183,12 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		return
 	}
 
+	if req.AccessToken == "" {
+		if token, err := middleware.BearerToken(c); err == nil {
+			req.AccessToken = token
+		}
+	}
+
 	err := h.authService.Logout(c.Request.Context(), req.RefreshToken, req.AccessToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -105,7 +205,7 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req dto.RefreshTokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindBody(c, &req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error:   "validation_error",
 			Message: err.Error(),
@@ -113,9 +213,23 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	userAgent, ip := getClientInfo(c)
-	authResp, err := h.authService.RefreshToken(c.Request.Context(), req.RefreshToken, userAgent, ip)
+	authResp, err := h.authService.RefreshToken(c.Request.Context(), req.RefreshToken, getClientInfo(c))
 	if err != nil {
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "email_not_verified",
+				Message: "Verify your email address before logging in",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrRefreshRace) {
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusConflict, dto.ErrorResponse{
+				Error:   "refresh_race",
+				Message: err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
 			Error:   "invalid_token",
 			Message: err.Error(),
@@ -123,7 +237,59 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, authResp)
+	c.JSON(http.StatusOK, h.authBody(c, authResp))
+}
+
+// VerifyToken lets a client check its own access token before relying on
+// it. An unusable token is a normal answer, not an error: the response is
+// 200 with valid set to false and a reason.
+func (h *AuthHandler) VerifyToken(c *gin.Context) {
+	var req dto.VerifyTokenRequest
+	if c.Request.ContentLength != 0 {
+		if err := bindBody(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "validation_error",
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+	if req.Token == "" {
+		req.Token, _ = middleware.BearerToken(c)
+	}
+	if req.Token == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "no token provided",
+		})
+		return
+	}
+
+	// ClientIP only follows X-Forwarded-For from TRUSTED_PROXIES, so callers
+	// can't pick their own rate limit key.
+	resp, err := h.authService.VerifyToken(c.Request.Context(), req.Token, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrVerifyTokenRateLimited):
+			c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
+				Error:   "rate_limited",
+				Message: err.Error(),
+			})
+		case errors.Is(err, service.ErrBlacklistUnavailable):
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{
+				Error:   "service_unavailable",
+				Message: err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error: "internal_error",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 func (h *AuthHandler) LogoutAll(c *gin.Context) {
@@ -159,9 +325,23 @@ func (h *AuthHandler) GetActiveSessions(c *gin.Context) {
 		return
 	}
 
-	currentRefreshToken := c.Query("current_token")
+	var query struct {
+		CurrentToken string `form:"current_token"`
+		Limit        int    `form:"limit" binding:"omitempty,min=1,max=100"`
+		Offset       int    `form:"offset" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 20
+	}
 
-	sessions, err := h.authService.GetActiveSessions(c.Request.Context(), userID, currentRefreshToken)
+	sessions, err := h.authService.GetActiveSessions(c.Request.Context(), userID, query.CurrentToken, query.Limit, query.Offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: "internal_error",
@@ -172,19 +352,312 @@ func (h *AuthHandler) GetActiveSessions(c *gin.Context) {
 	c.JSON(http.StatusOK, sessions)
 }
 
-func getClientInfo(c *gin.Context) (*string, *string) {
-	userAgent := c.Request.UserAgent()
-	ip := c.ClientIP()
+func (h *AuthHandler) GetCurrentSession(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	token, err := middleware.BearerToken(c)
+	if userID == 0 || err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	session, err := h.authService.GetCurrentSession(c.Request.Context(), userID, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			// Personal access tokens aren't tied to a session.
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "session_not_found",
+				Message: "No session is associated with this token",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
 
-	var userAgentStr *string
-	var ipPtr *string
+	c.JSON(http.StatusOK, session)
+}
 
-	if userAgent != "" {
-		userAgentStr = &userAgent
+func (h *AuthHandler) TrustDevice(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	token, err := middleware.BearerToken(c)
+	if userID == 0 || err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var req dto.TrustDeviceRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "validation_error",
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	device, err := h.authService.TrustCurrentDevice(c.Request.Context(), userID, token, req.Label)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrSessionNotFound):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "session_not_found",
+				Message: "No session is associated with this token",
+			})
+		case errors.Is(err, service.ErrDeviceIDRequired):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "device_id_required",
+				Message: "Log in with an X-Device-ID header to trust this device",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error: "internal_error",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, device)
+}
+
+func (h *AuthHandler) ListTrustedDevices(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
 	}
-	if ip != "" {
-		ipPtr = &ip
+
+	devices, err := h.authService.ListTrustedDevices(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+func (h *AuthHandler) UntrustDevice(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var uriParam struct {
+		ID int64 `uri:"id" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindUri(&uriParam); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid device ID",
+		})
+		return
+	}
+
+	err := h.authService.UntrustDevice(c.Request.Context(), userID, uriParam.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrTrustedDeviceNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "device_not_found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Device is no longer trusted",
+	})
+}
+
+// bindBody binds form-encoded and multipart bodies by their field names and
+// anything else as JSON, so clients that omit Content-Type keep working.
+// Validation is the same either way.
+func bindBody(c *gin.Context, obj any) error {
+	switch c.ContentType() {
+	case binding.MIMEPOSTForm, binding.MIMEMultipartPOSTForm:
+		return c.ShouldBind(obj)
+	default:
+		return c.ShouldBindJSON(obj)
+	}
+}
+
+func respondFieldErrors(c *gin.Context, errs validator.FieldErrors) {
+	c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+		Error:   "validation_error",
+		Message: errs.Error(),
+		Fields:  errs,
+	})
+}
+
+// respondCreated answers a request that created a resource: 201 with a
+// Location header pointing at it.
+func respondCreated(c *gin.Context, location string, body any) {
+	c.Header("Location", location)
+	c.JSON(http.StatusCreated, body)
+}
+
+func respondBusy(c *gin.Context) {
+	c.Header("Retry-After", "1")
+	c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{
+		Error:   "service_busy",
+		Message: "Service is temporarily overloaded, please retry shortly",
+	})
+}
+
+const (
+	deviceIDHeader     = "X-Device-ID"
+	deviceSecretHeader = "X-Device-Secret"
+)
+
+func getClientInfo(c *gin.Context) service.ClientInfo {
+	var client service.ClientInfo
+
+	if userAgent := c.Request.UserAgent(); userAgent != "" {
+		client.UserAgent = &userAgent
+	}
+	if ip := c.ClientIP(); ip != "" {
+		client.IPAddress = &ip
+	}
+	if deviceID, ok := service.NormalizeDeviceID(c.GetHeader(deviceIDHeader)); ok {
+		client.DeviceID = &deviceID
+	}
+	if secret := c.GetHeader(deviceSecretHeader); secret != "" {
+		client.DeviceSecret = &secret
+	}
+
+	return client
+}
+
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	purgeAt, err := h.authService.DeleteAccount(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "user_not_found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Account scheduled for deletion",
+		"purge_at": purgeAt,
+	})
+}
+
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	token, err := middleware.BearerToken(c)
+	if userID == 0 || err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var req dto.ChangePasswordRequest
+	if err := bindBody(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err = h.authService.ChangePassword(c.Request.Context(), userID, token, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		var fieldErrs validator.FieldErrors
+		switch {
+		case errors.As(err, &fieldErrs):
+			respondFieldErrors(c, fieldErrs)
+		case errors.Is(err, service.ErrServiceBusy):
+			respondBusy(c)
+		case errors.Is(err, service.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+				Error:   "invalid_credentials",
+				Message: "Current password is incorrect",
+			})
+		case errors.Is(err, repository.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "user_not_found",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "internal_error",
+				Message: "Failed to change password",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password changed, other sessions have been signed out",
+	})
+}
+
+func (h *AuthHandler) ReactivateAccount(c *gin.Context) {
+	var req dto.LoginRequest
+	if err := bindBody(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authResp, err := h.authService.ReactivateAccount(c.Request.Context(), &req, getClientInfo(c))
+	if err != nil {
+		if errors.Is(err, service.ErrServiceBusy) {
+			respondBusy(c)
+			return
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "email_not_verified",
+				Message: "Account reactivated, verify your email address before logging in",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrNothingToReactivate) {
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+				Error:   "invalid_credentials",
+				Message: "No account pending deletion matches these credentials",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
 	}
 
-	return userAgentStr, ipPtr
+	c.JSON(http.StatusOK, h.authBody(c, authResp))
 }
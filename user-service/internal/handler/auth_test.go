@@ -0,0 +1,382 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// verificationSender sends verification emails and fails everything else.
+type verificationSender struct{ failingSender }
+
+func (verificationSender) SendVerificationEmail(to, username, token string) error { return nil }
+
+func TestRegisterPendingVerificationHonorsMinimalUser(t *testing.T) {
+	s := newTestServices(t, verificationSender{}, func(cfg *config.Config) { cfg.RequireEmailVerification = true })
+
+	router := gin.New()
+	router.POST("/register", NewAuthHandler(s.auth, false).Register)
+
+	register := func(path, username string) map[string]any {
+		t.Helper()
+		w := doJSON(router, http.MethodPost, path, gin.H{
+			"username": username,
+			"email":    username + "@example.com",
+			"password": "battery-staple",
+		}, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s: status = %d, body %s", path, w.Code, w.Body)
+		}
+		var body struct {
+			VerificationRequired bool           `json:"verification_required"`
+			User                 map[string]any `json:"user"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if !body.VerificationRequired {
+			t.Errorf("%s: verification_required not set", path)
+		}
+		return body.User
+	}
+
+	if user := register("/register?user=minimal", "alice"); user["email"] != nil || user["username"] != "alice" {
+		t.Errorf("minimal pending user = %v, want it without the email", user)
+	}
+	if user := register("/register", "bob"); user["email"] != "bob@example.com" {
+		t.Errorf("default pending user = %v, want the full user", user)
+	}
+}
+
+func TestLoginUserShape(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	ctx := context.Background()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("battery-staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: string(hash)}
+	if err := s.users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(minimalByDefault bool, query string) map[string]any {
+		t.Helper()
+		router := gin.New()
+		router.POST("/login", NewAuthHandler(s.auth, minimalByDefault).Login)
+		w := doJSON(router, http.MethodPost, "/login"+query, gin.H{"login": "alice", "password": "battery-staple"}, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login%s: status = %d, body %s", query, w.Code, w.Body)
+		}
+		var body struct {
+			AccessToken string         `json:"access_token"`
+			User        map[string]any `json:"user"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.AccessToken == "" {
+			t.Errorf("login%s: no access token", query)
+		}
+		return body.User
+	}
+
+	tests := []struct {
+		minimalByDefault bool
+		query            string
+		wantEmail        bool
+	}{
+		{false, "", true},
+		{false, "?user=minimal", false},
+		{true, "", false},
+		{true, "?user=full", true},
+	}
+	for _, tt := range tests {
+		user := login(tt.minimalByDefault, tt.query)
+		if _, ok := user["email"]; ok != tt.wantEmail {
+			t.Errorf("minimal default %v, query %q: email present = %v, want %v", tt.minimalByDefault, tt.query, ok, tt.wantEmail)
+		}
+		if user["username"] != "alice" {
+			t.Errorf("minimal default %v, query %q: user = %v", tt.minimalByDefault, tt.query, user)
+		}
+	}
+}
+
+func TestValidateRegistrationReportsTakenFields(t *testing.T) {
+	s := newTestServices(t, verificationSender{}, nil)
+	ctx := context.Background()
+	if err := s.users.Create(ctx, &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := NewAuthHandler(s.auth, false)
+	router := gin.New()
+	router.POST("/register", auth.Register)
+	router.POST("/register/validate", auth.ValidateRegistration)
+
+	countUsers := func() int {
+		t.Helper()
+		var n int
+		if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	tests := []struct {
+		username, email string
+		fields          []string
+	}{
+		{"alice", "new@example.com", []string{"username"}},
+		{"newbie", "alice@example.com", []string{"email"}},
+		{"alice", "alice@example.com", []string{"username", "email"}},
+	}
+	for _, tt := range tests {
+		body := gin.H{"username": tt.username, "email": tt.email, "password": "battery-staple"}
+
+		w := doJSON(router, http.MethodPost, "/register/validate", body, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("validate %s/%s: status = %d, want 400", tt.username, tt.email, w.Code)
+			continue
+		}
+		var resp struct {
+			Error  string            `json:"error"`
+			Fields map[string]string `json:"fields"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != "validation_error" || len(resp.Fields) != len(tt.fields) {
+			t.Errorf("validate %s/%s: body = %s, want validation_error on %v", tt.username, tt.email, w.Body, tt.fields)
+		}
+		for _, f := range tt.fields {
+			if resp.Fields[f] == "" {
+				t.Errorf("validate %s/%s: field %s not reported", tt.username, tt.email, f)
+			}
+		}
+
+		w = doJSON(router, http.MethodPost, "/register", body, nil)
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"user_exists"`) {
+			t.Errorf("register %s/%s: status = %d, body %s, want 401 user_exists", tt.username, tt.email, w.Code, w.Body)
+		}
+	}
+
+	if w := doJSON(router, http.MethodPost, "/register/validate", gin.H{"username": "carol", "email": "carol@example.com", "password": "battery-staple"}, nil); w.Code != http.StatusOK {
+		t.Errorf("validating a free username: status = %d, body %s", w.Code, w.Body)
+	}
+	if n := countUsers(); n != 1 {
+		t.Errorf("%d users after conflicts and a validation, want only the original", n)
+	}
+}
+
+func TestAuthResponsesAreNotCached(t *testing.T) {
+	e := newAvatarEnv(t, 1)
+	user := e.createLoginUser(t, "alice")
+
+	// Routed as in main: no-store on the auth group only.
+	router := gin.New()
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/auth")
+	auth.Use(middleware.NoStore())
+	auth.POST("/login", NewAuthHandler(e.auth, false).Login)
+	v1.GET("/avatars/:userID/:hash", e.handler.GetImmutableAvatar)
+	router.POST("/me/avatar", asUser(user.ID, e.handler.UploadAvatar))
+
+	w := doJSON(router, http.MethodPost, "/api/v1/auth/login", gin.H{"login": "alice", "password": testPassword}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status = %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("login Cache-Control = %q, want no-store", got)
+	}
+	if got := w.Header().Get("Pragma"); got != "no-cache" {
+		t.Errorf("login Pragma = %q, want no-cache", got)
+	}
+
+	w = uploadAvatar(t, router, []byte("avatar"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: status = %d: %s", w.Code, w.Body)
+	}
+	w = doJSON(router, http.MethodGet, w.Header().Get("Location"), nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("avatar: status = %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+		t.Errorf("avatar Cache-Control = %q, want it cacheable", got)
+	}
+	if got := w.Header().Get("Pragma"); got != "" {
+		t.Errorf("avatar Pragma = %q, want none", got)
+	}
+}
+
+func TestLogoutTakesAccessTokenFromHeaderOrBody(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	s.createLoginUser(t, "alice")
+	ctx := context.Background()
+
+	router := gin.New()
+	router.POST("/logout", NewAuthHandler(s.auth, false).Logout)
+
+	tests := []struct {
+		name   string
+		logout func(resp *dto.AuthResponse) *httptest.ResponseRecorder
+	}{
+		{"header", func(resp *dto.AuthResponse) *httptest.ResponseRecorder {
+			return doJSON(router, http.MethodPost, "/logout", gin.H{"refresh_token": resp.RefreshToken},
+				http.Header{"Authorization": {"Bearer " + resp.AccessToken}})
+		}},
+		{"body", func(resp *dto.AuthResponse) *httptest.ResponseRecorder {
+			return doJSON(router, http.MethodPost, "/logout", gin.H{"refresh_token": resp.RefreshToken, "access_token": resp.AccessToken}, nil)
+		}},
+	}
+	for _, tt := range tests {
+		resp := s.login(t, "alice")
+		if w := tt.logout(resp); w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tt.name, w.Code, w.Body)
+		}
+		if n, err := s.redis.Exists(ctx, "revoked:"+resp.AccessToken).Result(); err != nil || n != 1 {
+			t.Errorf("%s: access token not revoked (%d, %v)", tt.name, n, err)
+		}
+		if _, err := s.auth.RefreshToken(ctx, resp.RefreshToken, service.ClientInfo{}); err == nil {
+			t.Errorf("%s: session still refreshes after logout", tt.name)
+		}
+	}
+
+	resp := s.login(t, "alice")
+	w := doJSON(router, http.MethodPost, "/logout", nil, http.Header{"Authorization": {"Bearer " + resp.AccessToken}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("logout without a refresh token: status = %d, want 400", w.Code)
+	}
+}
+
+func TestGetCurrentSession(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	s.createLoginUser(t, "alice")
+	ctx := context.Background()
+
+	router := gin.New()
+	router.GET("/sessions/current", middleware.AuthMiddleware(s.jwt, s.redis, nil, middleware.BlacklistFailOpen),
+		NewAuthHandler(s.auth, false).GetCurrentSession)
+
+	// Alice is signed in on two devices; each token describes its own.
+	for _, resp := range []*dto.AuthResponse{s.login(t, "alice"), s.login(t, "alice")} {
+		var want int64
+		if err := s.db.QueryRow(ctx, `SELECT id FROM sessions WHERE access_token = $1`, resp.AccessToken).Scan(&want); err != nil {
+			t.Fatal(err)
+		}
+
+		w := doJSON(router, http.MethodGet, "/sessions/current", nil, http.Header{"Authorization": {"Bearer " + resp.AccessToken}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var got models.SessionInfo
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != want || !got.IsCurrent {
+			t.Errorf("session = %d (current %v), want %d", got.ID, got.IsCurrent, want)
+		}
+	}
+
+	if w := doJSON(router, http.MethodGet, "/sessions/current", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("without auth: status = %d, want 401", w.Code)
+	}
+}
+
+func TestAuthEndpointsAcceptJSONAndForms(t *testing.T) {
+	s := newTestServices(t, verificationSender{}, nil)
+	s.createLoginUser(t, "alice")
+
+	h := NewAuthHandler(s.auth, false)
+	router := gin.New()
+	router.POST("/register", h.Register)
+	router.POST("/login", h.Login)
+	router.POST("/refresh", h.RefreshToken)
+
+	tests := []struct {
+		name, path string
+		fields     func(encoding string) map[string]string
+		want       int
+	}{
+		{"login", "/login", func(string) map[string]string {
+			return map[string]string{"login": "alice", "password": testPassword}
+		}, http.StatusOK},
+		{"wrong password", "/login", func(string) map[string]string {
+			return map[string]string{"login": "alice", "password": "wrong-password"}
+		}, http.StatusUnauthorized},
+		{"missing password", "/login", func(string) map[string]string {
+			return map[string]string{"login": "alice"}
+		}, http.StatusBadRequest},
+		{"register", "/register", func(encoding string) map[string]string {
+			return map[string]string{"username": "bob_" + encoding, "email": "bob_" + encoding + "@example.com", "password": testPassword}
+		}, http.StatusCreated},
+		{"register with a bad email", "/register", func(encoding string) map[string]string {
+			return map[string]string{"username": "carol_" + encoding, "email": "not-an-email", "password": testPassword}
+		}, http.StatusBadRequest},
+		{"refresh", "/refresh", func(string) map[string]string {
+			return map[string]string{"refresh_token": s.login(t, "alice").RefreshToken}
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			for k, v := range tt.fields("form") {
+				form.Set(k, v)
+			}
+			asForm := doForm(router, tt.path, form)
+			asJSON := doJSON(router, http.MethodPost, tt.path, tt.fields("json"), nil)
+
+			if asJSON.Code != tt.want || asForm.Code != tt.want {
+				t.Fatalf("status = %d as JSON and %d as a form, want %d: %s / %s", asJSON.Code, asForm.Code, tt.want, asJSON.Body, asForm.Body)
+			}
+			var jsonErr, formErr dto.ErrorResponse
+			json.Unmarshal(asJSON.Body.Bytes(), &jsonErr)
+			json.Unmarshal(asForm.Body.Bytes(), &formErr)
+			if jsonErr.Error != formErr.Error {
+				t.Errorf("error = %q as JSON and %q as a form", jsonErr.Error, formErr.Error)
+			}
+		})
+	}
+}
+
+func TestChangePasswordAcceptsJSONAndForms(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	s.createLoginUser(t, "alice")
+
+	router := gin.New()
+	router.POST("/me/password", middleware.AuthMiddleware(s.jwt, s.redis, nil, middleware.BlacklistFailOpen),
+		middleware.RequireSession(), NewAuthHandler(s.auth, false).ChangePassword)
+
+	// Each change keeps the session it was made from, so one login covers
+	// both requests.
+	auth := "Bearer " + s.login(t, "alice").AccessToken
+
+	form := url.Values{"current_password": {testPassword}, "new_password": {"correct-horse"}}
+	req := httptest.NewRequest(http.MethodPost, "/me/password", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", auth)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("as a form: status = %d: %s", w.Code, w.Body)
+	}
+
+	w = doJSON(router, http.MethodPost, "/me/password", gin.H{"current_password": "correct-horse", "new_password": testPassword},
+		http.Header{"Authorization": {auth}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("as JSON: status = %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+)
+
+type diagnosticCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// DiagnosticsHandler reports, in one place, whether the service is wired
+// correctly after a deploy: dependencies, migrations, credentials and the
+// effective non-secret configuration.
+type DiagnosticsHandler struct {
+	health *HealthHandler
+	cfg    *config.Config
+}
+
+func NewDiagnosticsHandler(health *HealthHandler, cfg *config.Config) *DiagnosticsHandler {
+	return &DiagnosticsHandler{health: health, cfg: cfg}
+}
+
+// Diagnostics runs every check live. Pass ?smtp_connect=true to also open a
+// connection to the SMTP server.
+func (h *DiagnosticsHandler) Diagnostics(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var checks []diagnosticCheck
+
+	dependencies, _ := h.health.checkDependencies(ctx)
+	for _, name := range []string{"database", "migrations", "redis", "minio"} {
+		checks = append(checks, checkResult(name, dependencies[name]))
+	}
+
+	smtpConfigured := h.cfg.SMTPHost != "" && h.cfg.SMTPUser != "" && h.cfg.SMPTPass != ""
+	checks = append(checks, boolCheck("smtp_credentials", smtpConfigured, "SMTP host, user or password is empty"))
+	if c.Query("smtp_connect") == "true" {
+		checks = append(checks, checkResult("smtp_connection", h.dialSMTP(ctx)))
+	}
+
+	secretOK := h.cfg.JWTSecret != config.DefaultJWTSecret && len(h.cfg.JWTSecret) >= 32
+	checks = append(checks, boolCheck("jwt_secret", secretOK, "JWT secret is the default or shorter than 32 bytes"))
+
+	passed := true
+	for _, check := range checks {
+		passed = passed && check.Passed
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"passed": passed,
+		"checks": checks,
+		"config": h.effectiveConfig(),
+	})
+}
+
+func checkResult(name, result string) diagnosticCheck {
+	if result == "" {
+		result = "not checked"
+	}
+	return diagnosticCheck{Name: name, Passed: result == "ok", Detail: result}
+}
+
+func boolCheck(name string, passed bool, failure string) diagnosticCheck {
+	if passed {
+		return checkResult(name, "ok")
+	}
+	return checkResult(name, failure)
+}
+
+func (h *DiagnosticsHandler) dialSMTP(ctx context.Context) string {
+	dialer := net.Dialer{Timeout: dependencyCheckTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(h.cfg.SMTPHost, strconv.Itoa(h.cfg.SMTPPort)))
+	if err != nil {
+		return err.Error()
+	}
+	conn.Close()
+	return "ok"
+}
+
+// effectiveConfig lists configuration that is safe to show. Never add
+// passwords, secrets or tokens here.
+func (h *DiagnosticsHandler) effectiveConfig() gin.H {
+	cfg := h.cfg
+	return gin.H{
+		"http_port":                  cfg.Port,
+		"db_host":                    cfg.DBHost,
+		"db_name":                    cfg.DBName,
+		"redis_host":                 cfg.RedisHost,
+		"smtp_host":                  cfg.SMTPHost,
+		"smtp_port":                  cfg.SMTPPort,
+		"smtp_from":                  cfg.SMTPFrom,
+		"minio_host":                 cfg.MinioHost,
+		"minio_use_tls":              cfg.MinioUseTLS,
+		"jwt_refresh_ttl":            cfg.JWTRefreshTTL.String(),
+		"jwt_remember_me_ttl":        cfg.JWTRememberMeTTL.String(),
+		"jwt_access_max_age":         cfg.JWTAccessMaxAge.String(),
+		"password_min_length":        cfg.PasswordMinLength,
+		"password_max_length":        cfg.PasswordMaxLength,
+		"registration_email_domains": cfg.RegistrationEmailDomains,
+		"storage_quota_bytes":        cfg.StorageQuotaBytes,
+		"cors_allowed_origins":       cfg.CORSAllowedOrigins,
+		"cors_allow_credentials":     cfg.CORSAllowCredentials,
+		"tls_min_version":            cfg.TLSMinVersion,
+		"tls_enabled":                cfg.TLSCertFile != "" && cfg.TLSKeyFile != "",
+		"shutdown_timeout":           cfg.ShutdownTimeout.String(),
+		"checked_at":                 time.Now(),
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/s3test"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+)
+
+// closedAddr returns an address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// diagnose runs the diagnostics endpoint and returns whether each check passed.
+func diagnose(t *testing.T, h *DiagnosticsHandler) (bool, map[string]bool) {
+	t.Helper()
+
+	router := gin.New()
+	router.GET("/diagnostics", h.Diagnostics)
+	w := doJSON(router, http.MethodGet, "/diagnostics?smtp_connect=true", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	var resp struct {
+		Passed bool              `json:"passed"`
+		Checks []diagnosticCheck `json:"checks"`
+		Config map[string]any    `json:"config"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(w.Body.String(), h.cfg.JWTSecret) {
+		t.Error("diagnostics expose the JWT secret")
+	}
+
+	passed := make(map[string]bool, len(resp.Checks))
+	for _, check := range resp.Checks {
+		passed[check.Name] = check.Passed
+	}
+	return resp.Passed, passed
+}
+
+func TestDiagnostics(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	_, client := s3test.New(t)
+	minio := &service.Minio{MinioClient: client}
+	checks := []string{"database", "migrations", "redis", "minio", "smtp_credentials", "smtp_connection", "jwt_secret"}
+
+	smtp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer smtp.Close()
+	host, port, _ := net.SplitHostPort(smtp.Addr().String())
+
+	cfg := *s.cfg
+	cfg.SMTPHost, cfg.SMTPUser, cfg.SMPTPass = host, "mailer", "mail-password"
+	cfg.SMTPPort, _ = strconv.Atoi(port)
+	cfg.JWTSecret = strings.Repeat("s", 32)
+
+	t.Run("all pass", func(t *testing.T) {
+		health := NewHealthHandler(s.db, s.redis, minio, 0, 0)
+		all, passed := diagnose(t, NewDiagnosticsHandler(health, &cfg))
+		for _, name := range checks {
+			if !passed[name] {
+				t.Errorf("%s failed", name)
+			}
+		}
+		if !all {
+			t.Error("report failed with every check passing")
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		down := redis.NewClient(&redis.Options{Addr: closedAddr(t), MaxRetries: -1})
+		defer down.Close()
+		health := NewHealthHandler(s.db, down, minio, 1<<20, 0)
+
+		broken := cfg
+		broken.SMPTPass = ""
+		host, port, _ := net.SplitHostPort(closedAddr(t))
+		broken.SMTPHost = host
+		broken.SMTPPort, _ = strconv.Atoi(port)
+		broken.JWTSecret = config.DefaultJWTSecret
+
+		all, passed := diagnose(t, NewDiagnosticsHandler(health, &broken))
+		want := map[string]bool{"database": true, "minio": true}
+		for _, name := range checks {
+			if _, ok := passed[name]; !ok {
+				t.Errorf("%s not reported", name)
+			} else if passed[name] != want[name] {
+				t.Errorf("%s passed = %v, want %v", name, passed[name], want[name])
+			}
+		}
+		if all {
+			t.Error("report passed with failing checks")
+		}
+	})
+}
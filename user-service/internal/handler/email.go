@@ -1,9 +1,15 @@
 package handler
 
 import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
-	"net/http"
 )
 
 type EmailVerificationHandler struct {
@@ -14,18 +20,109 @@ func NewEmailVerificationHandler(authService *service.AuthService) *EmailVerific
 	return &EmailVerificationHandler{authService: authService}
 }
 
-func (h *EmailVerificationHandler) VerifyEmail(c *gin.Context) {
+// confirmVerificationPage is served for the link in the verification email.
+// Verifying takes a POST from it, so mail scanners and link prefetchers that
+// follow the link don't verify the address on the user's behalf.
+var confirmVerificationPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>Verify your email address</title></head>
+<body>
+<form method="POST" action="/verify-email">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Verify my email address</button>
+</form>
+</body>
+</html>`))
+
+func (h *EmailVerificationHandler) ConfirmVerification(c *gin.Context) {
 	token := c.Query("token")
 	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no token provided"})
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "no token provided",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := confirmVerificationPage.Execute(c.Writer, token); err != nil {
+		log.Printf("failed to render verification page: %v", err)
+	}
+}
+
+// VerifyEmail is idempotent: repeating it with a used token reports success
+// without verifying again.
+func (h *EmailVerificationHandler) VerifyEmail(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		token = c.Query("token")
+	}
+	if token == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "no token provided",
+		})
 		return
 	}
 
 	err := h.authService.VerifyEmail(c.Request.Context(), token)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, repository.ErrAlreadyVerified):
+			c.JSON(http.StatusOK, gin.H{
+				"message":          "email already verified",
+				"already_verified": true,
+			})
+		case errors.Is(err, repository.ErrVerificationExpired):
+			resp := dto.VerificationExpiredResponse{
+				ErrorResponse: dto.ErrorResponse{
+					Error:   "verification_expired",
+					Message: "Verification link has expired, please request a new one",
+				},
+				ResendAvailable: true,
+			}
+			var expired *repository.VerificationExpiredError
+			if errors.As(err, &expired) {
+				resp.ExpiredAt = &expired.ExpiredAt
+			}
+			c.JSON(http.StatusBadRequest, resp)
+		case errors.Is(err, repository.ErrVerificationNotFound):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "invalid_token",
+				Message: "Verification link is invalid",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "internal_error",
+				Message: "Failed to verify email",
+			})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "email verified successfully"})
 }
+
+func (h *EmailVerificationHandler) ResendVerification(c *gin.Context) {
+	var req dto.ResendVerificationRequest
+	if err := bindBody(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.ResendVerification(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to resend verification email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If this address belongs to an unverified account, a verification email has been sent",
+	})
+}
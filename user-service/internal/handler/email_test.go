@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+// verificationRecorder records who verification emails were sent to and
+// fails everything else.
+type verificationRecorder struct {
+	failingSender
+	mu sync.Mutex
+	to []string
+}
+
+func (r *verificationRecorder) SendVerificationEmail(to, username, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.to = append(r.to, to)
+	return nil
+}
+
+func (r *verificationRecorder) sent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.to)
+}
+
+// emailEnv serves the verification routes the way main does.
+type emailEnv struct {
+	*testServices
+	router *gin.Engine
+	sender *verificationRecorder
+}
+
+func newEmailEnv(t *testing.T) *emailEnv {
+	t.Helper()
+
+	sender := &verificationRecorder{}
+	e := &emailEnv{testServices: newTestServices(t, sender, nil), sender: sender}
+	h := NewEmailVerificationHandler(e.auth)
+	e.router = gin.New()
+	e.router.GET("/verify-email", h.ConfirmVerification)
+	e.router.POST("/verify-email", h.VerifyEmail)
+	e.router.POST("/resend-verification", h.ResendVerification)
+	return e
+}
+
+// addVerification stores a verification token for user expiring at expiresAt.
+func (e *emailEnv) addVerification(t *testing.T, user *models.User, token string, expiresAt time.Time) {
+	t.Helper()
+	ev := &models.EmailVerification{UserID: user.ID, Token: token, ExpiresAt: expiresAt}
+	if err := repository.NewEmailVerificationRepository(e.db).Create(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verify submits token the way the confirmation page's form does.
+func (e *emailEnv) verify(token string) (int, map[string]any) {
+	w := doForm(e.router, "/verify-email", url.Values{"token": {token}})
+	var body map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func (e *emailEnv) isVerified(t *testing.T, user *models.User) bool {
+	t.Helper()
+	stored, err := e.users.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored.IsVerified
+}
+
+func TestVerifyEmailOutcomes(t *testing.T) {
+	e := newEmailEnv(t)
+	alice, bob := e.createLoginUser(t, "alice"), e.createLoginUser(t, "bob")
+	e.addVerification(t, alice, "alice-token", time.Now().Add(time.Hour))
+	e.addVerification(t, bob, "bob-token", time.Now().Add(-time.Hour))
+
+	if code, body := e.verify("alice-token"); code != http.StatusOK || body["already_verified"] != nil {
+		t.Fatalf("first verification: %d %v", code, body)
+	}
+	if !e.isVerified(t, alice) {
+		t.Fatal("alice not verified")
+	}
+
+	t.Run("already verified", func(t *testing.T) {
+		code, body := e.verify("alice-token")
+		if code != http.StatusOK || body["already_verified"] != true {
+			t.Errorf("got %d %v, want 200 with already_verified", code, body)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		code, body := e.verify("bob-token")
+		if code != http.StatusBadRequest || body["error"] != "verification_expired" || body["resend_available"] != true {
+			t.Errorf("got %d %v, want 400 verification_expired offering a resend", code, body)
+		}
+		if e.isVerified(t, bob) {
+			t.Error("expired link verified bob")
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		code, body := e.verify("no-such-token")
+		if code != http.StatusBadRequest || body["error"] != "invalid_token" {
+			t.Errorf("got %d %v, want 400 invalid_token", code, body)
+		}
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	e := newEmailEnv(t)
+	e.createLoginUser(t, "alice")
+	bob := e.createLoginUser(t, "bob")
+	e.addVerification(t, bob, "bob-token", time.Now().Add(time.Hour))
+	if code, _ := e.verify("bob-token"); code != http.StatusOK {
+		t.Fatal("verifying bob failed")
+	}
+
+	resend := func(email string) {
+		t.Helper()
+		w := doJSON(e.router, http.MethodPost, "/resend-verification", gin.H{"email": email}, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("resend to %s: status = %d, want 200 for any address: %s", email, w.Code, w.Body)
+		}
+	}
+
+	// Every address gets the same answer; only the unverified one gets mail.
+	resend("alice@example.com")
+	resend("bob@example.com")
+	resend("nobody@example.com")
+	if sent := e.sender.sent(); !slices.Equal(sent, []string{"alice@example.com"}) {
+		t.Errorf("sent verification emails to %v, want only alice", sent)
+	}
+
+	resend("alice@example.com")
+	if sent := e.sender.sent(); len(sent) != 1 {
+		t.Errorf("an immediate second resend sent another email (%d total)", len(sent))
+	}
+}
+
+func TestVerificationLinkPrefetch(t *testing.T) {
+	e := newEmailEnv(t)
+	alice := e.createLoginUser(t, "alice")
+	e.addVerification(t, alice, "alice-token", time.Now().Add(time.Hour))
+
+	// A scanner following the link, however often, only gets the page.
+	for range 2 {
+		w := doJSON(e.router, http.MethodGet, "/verify-email?token=alice-token", nil, nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `method="POST"`) || !strings.Contains(w.Body.String(), "alice-token") {
+			t.Fatalf("confirmation page = %d %q", w.Code, w.Body)
+		}
+	}
+	if e.isVerified(t, alice) {
+		t.Fatal("following the link verified alice")
+	}
+
+	if code, body := e.verify("alice-token"); code != http.StatusOK || body["already_verified"] != nil {
+		t.Errorf("confirming: %d %v", code, body)
+	}
+	if !e.isVerified(t, alice) {
+		t.Error("confirming didn't verify alice")
+	}
+}
+
+func TestReplayedVerificationHasNoEffect(t *testing.T) {
+	e := newEmailEnv(t)
+	alice := e.createLoginUser(t, "alice")
+	e.addVerification(t, alice, "alice-token", time.Now().Add(time.Hour))
+	ctx := context.Background()
+
+	verifiedAt := func() (at time.Time) {
+		t.Helper()
+		if err := e.db.QueryRow(ctx, `SELECT verified_at FROM email_verifications WHERE token = $1`, "alice-token").Scan(&at); err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+
+	if code, body := e.verify("alice-token"); code != http.StatusOK || body["already_verified"] != nil {
+		t.Fatalf("first verification: %d %v", code, body)
+	}
+	first := verifiedAt()
+
+	for range 2 {
+		if code, body := e.verify("alice-token"); code != http.StatusOK || body["already_verified"] != true {
+			t.Errorf("replay: %d %v, want 200 with already_verified", code, body)
+		}
+	}
+	if again := verifiedAt(); !again.Equal(first) {
+		t.Errorf("replay moved verified_at from %v to %v", first, again)
+	}
+}
+
+func TestExpiredVerificationResponse(t *testing.T) {
+	e := newEmailEnv(t)
+	bob := e.createLoginUser(t, "bob")
+	expiredAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	e.addVerification(t, bob, "bob-token", expiredAt)
+
+	code, body := e.verify("bob-token")
+	if code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %v", code, body)
+	}
+	if body["error"] != "verification_expired" || body["message"] == "" {
+		t.Errorf("error = %v %v, want verification_expired with a message", body["error"], body["message"])
+	}
+	if body["resend_available"] != true {
+		t.Errorf("resend_available = %v, want true", body["resend_available"])
+	}
+	raw, _ := body["expired_at"].(string)
+	if got, err := time.Parse(time.RFC3339Nano, raw); err != nil || !got.Equal(expiredAt) {
+		t.Errorf("expired_at = %q, want %v", raw, expiredAt)
+	}
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+var errSendFailed = errors.New("smtp unavailable")
+
+// failingSender fails every email.
+type failingSender struct{}
+
+func (failingSender) SendVerificationEmail(to, username, token string) error { return errSendFailed }
+func (failingSender) SendPasswordResetEmail(to, username, token string, ttl time.Duration) error {
+	return errSendFailed
+}
+func (failingSender) SendPasswordResetCodeEmail(to, username, code string, ttl time.Duration) error {
+	return errSendFailed
+}
+func (failingSender) SendLoginAlertEmail(userID int64, to, username, device, ipAddress string, at time.Time) error {
+	return errSendFailed
+}
+func (failingSender) SendAccountDeletionEmail(to, username string, purgeAt time.Time) error {
+	return errSendFailed
+}
+func (failingSender) SendAccountDeletionReminderEmail(to, username string, purgeAt time.Time) error {
+	return errSendFailed
+}
+func (failingSender) SendOnboardingEmail(userID int64, to, username, step string) error {
+	return errSendFailed
+}
+
+// testServices are services on a fresh database and an in-memory Redis.
+type testServices struct {
+	db    *pgxpool.Pool
+	redis *redis.Client
+	cfg   *config.Config
+	users *repository.UserRepository
+	auth  *service.AuthService
+	jwt   *jwt.TokenManager
+}
+
+func newTestServices(t *testing.T, sender service.EmailSender, configure func(*config.Config)) *testServices {
+	t.Helper()
+
+	db := testdb.New(t)
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	cfg := config.LoadConfig()
+	cfg.BcryptCost = bcrypt.MinCost
+	if configure != nil {
+		configure(cfg)
+	}
+
+	s := &testServices{
+		db:    db,
+		redis: redisClient,
+		cfg:   cfg,
+		users: repository.NewUserRepository(db),
+		jwt:   jwt.NewTokenManager(cfg.JWTSecret, cfg.JWTAccessMaxAge),
+	}
+	s.auth = service.NewAuthService(
+		s.users,
+		s.jwt,
+		repository.NewSessionRepository(db),
+		repository.NewEmailVerificationRepository(db),
+		repository.NewPasswordResetRepository(db),
+		repository.NewTrustedDeviceRepository(db),
+		sender,
+		redisClient,
+		nil,
+		cfg,
+	)
+	return s
+}
+
+// doJSON sends body as JSON to router and returns the recorded response.
+func doJSON(router http.Handler, method, path string, body any, header http.Header) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// doForm posts form as an application/x-www-form-urlencoded body.
+func doForm(router http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// codeSender records password reset codes and fails everything else.
+type codeSender struct {
+	failingSender
+	codes chan string
+}
+
+func (s codeSender) SendPasswordResetCodeEmail(to, username, code string, ttl time.Duration) error {
+	s.codes <- code
+	return nil
+}
+
+const testPassword = "battery-staple"
+
+// createLoginUser inserts a user who can log in with testPassword.
+func (s *testServices) createLoginUser(t *testing.T, username string) *models.User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: username, Email: username + "@example.com", PasswordHash: string(hash)}
+	if err := s.users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// login signs username in through the service, bypassing the handlers.
+func (s *testServices) login(t *testing.T, username string) *dto.AuthResponse {
+	t.Helper()
+
+	resp, err := s.auth.Login(context.Background(), &dto.LoginRequest{Login: username, Password: testPassword}, service.ClientInfo{})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return resp
+}
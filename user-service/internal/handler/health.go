@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/migration"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+)
+
+const dependencyCheckTimeout = 2 * time.Second
+
+type readinessReport struct {
+	ready     bool
+	checks    map[string]string
+	checkedAt time.Time
+}
+
+// HealthHandler serves liveness and readiness. Dependency checks run on a
+// ticker in Run and Readiness only returns the latest result, so aggressive
+// probing never turns into a ping flood against Postgres, Redis or MinIO.
+type HealthHandler struct {
+	db              *pgxpool.Pool
+	redisClient     *redis.Client
+	minioService    *service.Minio
+	expectedVersion uint
+	interval        time.Duration
+
+	mu     sync.RWMutex
+	report readinessReport
+}
+
+func NewHealthHandler(db *pgxpool.Pool, redisClient *redis.Client, minioService *service.Minio, expectedVersion uint, interval time.Duration) *HealthHandler {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	return &HealthHandler{
+		db:              db,
+		redisClient:     redisClient,
+		minioService:    minioService,
+		expectedVersion: expectedVersion,
+		interval:        interval,
+	}
+}
+
+// Run refreshes the readiness report every interval until ctx is cancelled.
+func (h *HealthHandler) Run(ctx context.Context) {
+	h.refresh(ctx)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.refresh(ctx)
+		}
+	}
+}
+
+func (h *HealthHandler) refresh(ctx context.Context) {
+	checks, ready := h.checkDependencies(ctx)
+
+	h.mu.Lock()
+	h.report = readinessReport{
+		ready:     ready,
+		checks:    checks,
+		checkedAt: time.Now(),
+	}
+	h.mu.Unlock()
+}
+
+// checkDependencies probes every dependency and returns "ok" or the error
+// for each, plus whether all of them passed.
+func (h *HealthHandler) checkDependencies(ctx context.Context) (map[string]string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+	defer cancel()
+
+	checks := map[string]string{}
+	ready := true
+
+	if err := h.db.Ping(ctx); err != nil {
+		checks["database"] = err.Error()
+		ready = false
+	} else {
+		checks["database"] = "ok"
+	}
+
+	version, dirty, err := migration.SchemaVersion(ctx, h.db)
+	switch {
+	case err != nil:
+		checks["migrations"] = err.Error()
+		ready = false
+	case dirty:
+		checks["migrations"] = fmt.Sprintf("version %d is dirty", version)
+		ready = false
+	case version < h.expectedVersion:
+		checks["migrations"] = fmt.Sprintf("at version %d, expected %d", version, h.expectedVersion)
+		ready = false
+	default:
+		checks["migrations"] = "ok"
+	}
+
+	if err := h.redisClient.Ping(ctx).Err(); err != nil {
+		checks["redis"] = err.Error()
+		ready = false
+	} else {
+		checks["redis"] = "ok"
+	}
+
+	if _, err := h.minioService.MinioClient.BucketExists(ctx, service.BucketName); err != nil {
+		checks["minio"] = err.Error()
+		ready = false
+	} else {
+		checks["minio"] = "ok"
+	}
+
+	return checks, ready
+}
+
+func (h *HealthHandler) Health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "healthy",
+		"service": "user-service",
+	})
+}
+
+// Readiness reports ready only once every dependency answers and the schema
+// is at the version this build expects, so a pod never serves traffic
+// against a half-migrated database.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	h.mu.RLock()
+	report := h.report
+	h.mu.RUnlock()
+
+	if report.checkedAt.IsZero() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready"})
+		return
+	}
+
+	status := http.StatusOK
+	state := "ready"
+	if !report.ready {
+		status = http.StatusServiceUnavailable
+		state = "not_ready"
+	}
+
+	c.JSON(status, gin.H{
+		"status":     state,
+		"checks":     report.checks,
+		"checked_at": report.checkedAt,
+	})
+}
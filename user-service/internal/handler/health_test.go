@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/s3test"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+)
+
+// pingCounter counts PING commands sent through a Redis client.
+type pingCounter struct{ n atomic.Int64 }
+
+func (p *pingCounter) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (p *pingCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if strings.EqualFold(cmd.Name(), "ping") {
+			p.n.Add(1)
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (p *pingCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func newHealthEnv(t *testing.T, interval time.Duration) (*HealthHandler, *pingCounter, *gin.Engine) {
+	t.Helper()
+
+	s := newTestServices(t, failingSender{}, nil)
+	_, client := s3test.New(t)
+	pings := &pingCounter{}
+	s.redis.AddHook(pings)
+
+	h := NewHealthHandler(s.db, s.redis, &service.Minio{MinioClient: client}, 0, interval)
+	router := gin.New()
+	router.GET("/readiness", h.Readiness)
+	return h, pings, router
+}
+
+func TestReadinessReusesRecentCheck(t *testing.T) {
+	h, pings, router := newHealthEnv(t, time.Hour)
+	h.refresh(context.Background())
+
+	for i := range 20 {
+		if w := doJSON(router, http.MethodGet, "/readiness", nil, nil); w.Code != http.StatusOK {
+			t.Fatalf("probe %d: status = %d: %s", i+1, w.Code, w.Body)
+		}
+	}
+	if n := pings.n.Load(); n != 1 {
+		t.Errorf("20 probes within the interval pinged Redis %d times, want 1", n)
+	}
+}
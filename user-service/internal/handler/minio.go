@@ -1,25 +1,54 @@
 package handler
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"image"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/minio/minio-go/v7"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
 )
 
+const (
+	avatarLockTTL        = 30 * time.Second
+	avatarPresignTTL     = time.Hour
+	avatarPresignWorkers = 8
+)
+
 type MinioHandler struct {
 	MinioService *service.Minio
 	UserRepo     *repository.UserRepository
+	Locker       *service.RedisLocker
+	Quota        service.StorageQuota
+
+	// AvatarVersions is how many avatar versions, the current one included,
+	// are kept per user.
+	AvatarVersions int
+	// AvatarMaxPixels limits the dimensions of avatars that are transformed.
+	AvatarMaxPixels int64
 }
 
-func NewMinioHandler(minioService *service.Minio, userRepo *repository.UserRepository) *MinioHandler {
+func NewMinioHandler(minioService *service.Minio, userRepo *repository.UserRepository, locker *service.RedisLocker, quota service.StorageQuota, avatarVersions int, avatarMaxPixels int64) *MinioHandler {
 	return &MinioHandler{
-		MinioService: minioService,
-		UserRepo:     userRepo,
+		MinioService:    minioService,
+		UserRepo:        userRepo,
+		Locker:          locker,
+		Quota:           quota,
+		AvatarVersions:  avatarVersions,
+		AvatarMaxPixels: avatarMaxPixels,
 	}
 }
 
@@ -30,6 +59,17 @@ func (m *MinioHandler) UploadAvatar(c *gin.Context) {
 		return
 	}
 
+	var transformReq dto.AvatarTransformRequest
+	if err := c.ShouldBind(&transformReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	transform, err := avatarTransform(transformReq)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	file, err := fileHeader.Open()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to open file"})
@@ -37,21 +77,103 @@ func (m *MinioHandler) UploadAvatar(c *gin.Context) {
 	}
 	defer file.Close()
 
+	var body io.ReadSeeker = file
+	size := fileHeader.Size
+	contentType := fileHeader.Header.Get("Content-Type")
+
+	if !transform.IsZero() {
+		transform.MaxPixels = m.AvatarMaxPixels
+		data, transformedType, err := service.TransformImage(file, transform)
+		if errors.Is(err, service.ErrImageTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		body = bytes.NewReader(data)
+		size = int64(len(data))
+		contentType = transformedType
+	}
+
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
 		return
 	}
 
-	objectName := fmt.Sprintf("%v/%s", userID, "avatar")
-	contentType := fileHeader.Header.Get("Content-Type")
+	// Serialize avatar mutations per user so concurrent uploads can't
+	// interleave the object write and the DB update.
+	release, err := m.Locker.Acquire(c.Request.Context(), fmt.Sprintf("avatar:%d", userID), avatarLockTTL)
+	if err != nil {
+		if errors.Is(err, service.ErrLockHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Another avatar update is in progress"})
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to acquire avatar lock"})
+		return
+	}
+	defer release()
+
+	previous, err := m.UserRepo.GetAvatarURL(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get avatar URL"})
+		return
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read file"})
+		return
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read file"})
+		return
+	}
+
+	objectName := service.AvatarKey(userID, hex.EncodeToString(hasher.Sum(nil)))
+
+	used, limit, err := m.storageUsage(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute storage usage"})
+		return
+	}
+	// Keys are content-addressed, so re-uploading a kept version stores
+	// nothing new.
+	existing, err := m.MinioService.ObjectSize(c.Request.Context(), objectName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute storage usage"})
+		return
+	}
+	added := size
+	if existing > 0 {
+		added = 0
+	}
+	// When no history is kept (or the current avatar is a legacy object)
+	// the upload replaces the current avatar, so its bytes are freed.
+	var replaced int64
+	if previous != "" && previous != objectName && (m.AvatarVersions <= 1 || service.IsLegacyAvatarKey(previous)) {
+		replaced, err = m.MinioService.ObjectSize(c.Request.Context(), previous)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute storage usage"})
+		return
+	}
+	if used-replaced+added > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":       "Storage quota exceeded",
+			"used_bytes":  used,
+			"quota_bytes": limit,
+		})
+		return
+	}
 
-	_, err = m.MinioService.MinioClient.PutObject(
+	err = m.MinioService.PutObject(
 		c.Request.Context(),
-		"avatars",
 		objectName,
-		file,
-		fileHeader.Size,
+		body,
+		size,
 		minio.PutObjectOptions{ContentType: contentType},
 	)
 
@@ -66,7 +188,78 @@ func (m *MinioHandler) UploadAvatar(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Avatar uploaded successfully", "path": objectName})
+	// Content-addressed keys are never overwritten, so old versions are
+	// pruned down to the retained count. A legacy un-namespaced object isn't
+	// part of the history and is dropped once replaced.
+	if service.IsLegacyAvatarKey(previous) {
+		err = m.MinioService.RemoveObject(c.Request.Context(), previous)
+		if err != nil {
+			log.Printf("failed to remove previous avatar %s: %v", previous, err)
+		}
+	}
+	if _, err := m.MinioService.PruneAvatars(c.Request.Context(), userID, objectName, m.AvatarVersions); err != nil {
+		log.Printf("failed to prune avatar versions of user %d: %v", userID, err)
+	}
+
+	// Every upload creates a new content-addressed object.
+	url := immutableAvatarURL(userID, objectName)
+	respondCreated(c, url, gin.H{
+		"message": "Avatar uploaded successfully",
+		"path":    objectName,
+		"url":     url,
+	})
+}
+
+// DeleteAvatar removes the user's avatar and all of its stored versions. It
+// is idempotent: deleting when there is no avatar succeeds, and a retry
+// after a partial failure finishes the cleanup.
+func (m *MinioHandler) DeleteAvatar(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	release, err := m.Locker.Acquire(c.Request.Context(), fmt.Sprintf("avatar:%d", userID), avatarLockTTL)
+	if err != nil {
+		if errors.Is(err, service.ErrLockHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Another avatar update is in progress"})
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to acquire avatar lock"})
+		return
+	}
+	defer release()
+
+	previous, err := m.UserRepo.GetAvatarURL(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get avatar URL"})
+		return
+	}
+
+	// Clear the pointer first so the user never references a removed
+	// object. The objects are removed even if the pointer was already
+	// empty, in case an earlier attempt stopped halfway.
+	if err := m.UserRepo.ClearAvatar(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear avatar"})
+		return
+	}
+
+	if err := m.MinioService.RemoveAvatars(c.Request.Context(), userID, previous); err != nil {
+		log.Printf("failed to remove avatars of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove avatar files"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar deleted"})
 }
 
 func (m *MinioHandler) GetAvatar(c *gin.Context) {
@@ -78,9 +271,145 @@ func (m *MinioHandler) GetAvatar(c *gin.Context) {
 		return
 	}
 
+	m.serveAvatar(c, url, "")
+}
+
+// GetUserAvatar redirects to the immutable URL of a user's current avatar.
+// The redirect itself must not be cached, since it changes on every upload.
+func (m *MinioHandler) GetUserAvatar(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	key, err := m.UserRepo.GetAvatarURLShared(c.Request.Context(), userID)
+	if err != nil || key == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	url := immutableAvatarURL(userID, key)
+	if url == "" {
+		// Legacy avatars aren't content-addressed and are served in place.
+		m.serveAvatar(c, key, "no-cache")
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Redirect(http.StatusFound, url)
+}
+
+// GetImmutableAvatar serves an avatar by content hash. The object behind a
+// hash never changes, so it may be cached forever by browsers and CDNs.
+func (m *MinioHandler) GetImmutableAvatar(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil || !service.IsContentHash(c.Param("hash")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	m.serveAvatar(c, service.AvatarKey(userID, c.Param("hash")), "public, max-age=31536000, immutable")
+}
+
+// GetAvatarBatch resolves servable avatar URLs for many users at once.
+// Content-addressed avatars map to their immutable URL without touching
+// MinIO; legacy ones get presigned URLs, generated by a bounded pool.
+func (m *MinioHandler) GetAvatarBatch(c *gin.Context) {
+	var req dto.AvatarBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	keys, err := m.UserRepo.GetAvatarURLs(c.Request.Context(), req.UserIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get avatar URLs"})
+		return
+	}
+
+	avatars := make(map[int64]string, len(keys))
+	var legacy []int64
+	for userID, key := range keys {
+		if url := immutableAvatarURL(userID, key); url != "" {
+			avatars[userID] = url
+		} else {
+			legacy = append(legacy, userID)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, avatarPresignWorkers)
+	for _, userID := range legacy {
+		wg.Go(func() {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			u, err := m.MinioService.MinioClient.PresignedGetObject(c.Request.Context(), service.BucketName, keys[userID], avatarPresignTTL, nil)
+			if err != nil {
+				log.Printf("failed to presign avatar for user %d: %v", userID, err)
+				return
+			}
+
+			mu.Lock()
+			avatars[userID] = u.String()
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, dto.AvatarBatchResponse{Avatars: avatars})
+}
+
+func avatarTransform(req dto.AvatarTransformRequest) (service.ImageTransform, error) {
+	transform := service.ImageTransform{Rotate: req.Rotate}
+
+	fields := []*int{req.CropX, req.CropY, req.CropW, req.CropH}
+	set := 0
+	for _, f := range fields {
+		if f != nil {
+			set++
+		}
+	}
+	switch set {
+	case 0:
+	case len(fields):
+		crop := image.Rect(*req.CropX, *req.CropY, *req.CropX+*req.CropW, *req.CropY+*req.CropH)
+		transform.Crop = &crop
+	default:
+		return transform, errors.New("crop_x, crop_y, crop_w and crop_h must be given together")
+	}
+
+	if req.Rotate%90 != 0 {
+		return transform, service.ErrInvalidRotation
+	}
+
+	return transform, nil
+}
+
+func immutableAvatarURL(userID int64, key string) string {
+	hash, ok := service.AvatarHash(userID, key)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("/api/v1/avatars/%d/%s", userID, hash)
+}
+
+// serveAvatar streams the object at url. cacheControl, if set, is only sent
+// with a successful response so errors never get cached.
+func (m *MinioHandler) serveAvatar(c *gin.Context, url, cacheControl string) {
+	if service.ValidateObjectKey(url) != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
 	object, err := m.MinioService.MinioClient.GetObject(
 		c.Request.Context(),
-		"avatars",
+		service.BucketName,
 		url,
 		minio.GetObjectOptions{},
 	)
@@ -101,6 +430,9 @@ func (m *MinioHandler) GetAvatar(c *gin.Context) {
 	extraHeaders := map[string]string{
 		"Content-Disposition": fmt.Sprintf("inline; filename=avatar"),
 	}
+	if cacheControl != "" {
+		extraHeaders["Cache-Control"] = cacheControl
+	}
 
 	c.DataFromReader(
 		http.StatusOK,
@@ -110,3 +442,41 @@ func (m *MinioHandler) GetAvatar(c *gin.Context) {
 		extraHeaders,
 	)
 }
+
+func (m *MinioHandler) GetStorage(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	used, limit, err := m.storageUsage(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute storage usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"used_bytes":  used,
+		"quota_bytes": limit,
+	})
+}
+
+// storageUsage returns the user's current usage and quota. The plan comes
+// from the access token's entitlements, or from the user record when the
+// request was made with a personal access token.
+func (m *MinioHandler) storageUsage(c *gin.Context, userID int64) (int64, int64, error) {
+	var plan string
+	if ent := middleware.GetEntitlements(c); ent != nil {
+		plan = ent.Plan
+	} else {
+		user, err := m.UserRepo.GetByID(c.Request.Context(), userID)
+		if err != nil {
+			return 0, 0, err
+		}
+		plan = user.Plan
+	}
+
+	used, err := m.MinioService.StorageUsage(c.Request.Context(), userID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return used, m.Quota.For(plan), nil
+}
@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/s3test"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+)
+
+// avatarEnv is a MinioHandler on a test database, Redis and bucket.
+type avatarEnv struct {
+	*testServices
+	store   *s3test.Server
+	handler *MinioHandler
+}
+
+func newAvatarEnv(t *testing.T, versions int) *avatarEnv {
+	t.Helper()
+
+	s := newTestServices(t, failingSender{}, nil)
+	store, client := s3test.New(t)
+	h := NewMinioHandler(&service.Minio{MinioClient: client}, s.users, service.NewRedisLocker(s.redis),
+		service.StorageQuota{Default: 10 << 20}, versions, 40_000_000)
+	return &avatarEnv{testServices: s, store: store, handler: h}
+}
+
+// asUser runs route as userID, standing in for AuthMiddleware.
+func asUser(userID int64, route gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ctxkey.UserID, userID)
+		route(c)
+	}
+}
+
+func (e *avatarEnv) createUser(t *testing.T, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Email: username + "@example.com", PasswordHash: "x"}
+	if err := e.users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// uploadAvatar posts data as the avatar form file to router.
+func uploadAvatar(t *testing.T, router http.Handler, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/me/avatar", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestConcurrentAvatarUploads(t *testing.T) {
+	e := newAvatarEnv(t, 1)
+	user := e.createUser(t, "alice")
+
+	r := gin.New()
+	r.POST("/me/avatar", asUser(user.ID, e.handler.UploadAvatar))
+
+	var responses [2]*httptest.ResponseRecorder
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Go(func() { responses[i] = uploadAvatar(t, r, []byte(fmt.Sprintf("avatar %d", i))) })
+	}
+	wg.Wait()
+
+	for i, w := range responses {
+		if w.Code != http.StatusCreated && w.Code != http.StatusConflict {
+			t.Errorf("upload %d: status = %d, want 201 or 409: %s", i, w.Code, w.Body)
+		}
+	}
+
+	// Whichever upload won, exactly its object is left and referenced.
+	keys := e.store.Keys(service.AvatarPrefix)
+	current, err := e.users.GetAvatarURL(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != current {
+		t.Errorf("stored %v with avatar_url %q, want just the current avatar", keys, current)
+	}
+}
+
+func TestAvatarUploadWhileLocked(t *testing.T) {
+	e := newAvatarEnv(t, 1)
+	user := e.createUser(t, "alice")
+
+	release, err := e.handler.Locker.Acquire(context.Background(), fmt.Sprintf("avatar:%d", user.ID), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	r := gin.New()
+	r.POST("/me/avatar", asUser(user.ID, e.handler.UploadAvatar))
+	if w := uploadAvatar(t, r, []byte("avatar")); w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+	if keys := e.store.Keys(service.AvatarPrefix); len(keys) != 0 {
+		t.Errorf("stored %v during another update", keys)
+	}
+}
+
+func TestDeleteAvatarTwice(t *testing.T) {
+	e := newAvatarEnv(t, 1)
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	legacy := service.LegacyAvatarKey(user.ID)
+	e.store.Put(legacy, []byte("legacy"), time.Now())
+	if err := e.users.UpdateAvatar(ctx, user.ID, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.DELETE("/me/avatar", asUser(user.ID, e.handler.DeleteAvatar))
+
+	for i := range 2 {
+		if w := doJSON(r, http.MethodDelete, "/me/avatar", nil, nil); w.Code != http.StatusOK {
+			t.Fatalf("delete %d: status = %d, want 200: %s", i+1, w.Code, w.Body)
+		}
+	}
+
+	if e.store.Has(legacy) {
+		t.Error("legacy avatar still stored")
+	}
+	if url, err := e.users.GetAvatarURL(ctx, user.ID); err != nil || url != "" {
+		t.Errorf("avatar_url = %q, %v; want it cleared", url, err)
+	}
+}
+
+func TestDeleteAvatarRetryRemovesLegacyObject(t *testing.T) {
+	e := newAvatarEnv(t, 1)
+	user := e.createUser(t, "alice")
+
+	// An earlier attempt cleared avatar_url and failed before removing
+	// the object.
+	legacy := service.LegacyAvatarKey(user.ID)
+	e.store.Put(legacy, []byte("legacy"), time.Now())
+
+	r := gin.New()
+	r.DELETE("/me/avatar", asUser(user.ID, e.handler.DeleteAvatar))
+	if w := doJSON(r, http.MethodDelete, "/me/avatar", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if e.store.Has(legacy) {
+		t.Error("retry left the legacy avatar behind")
+	}
+}
+
+func TestAvatarUploadStorageQuota(t *testing.T) {
+	e := newAvatarEnv(t, 3)
+	e.handler.Quota = service.StorageQuota{Default: 100, Plans: map[string]int64{models.PlanPro: 1000}}
+	user := e.createUser(t, "alice")
+
+	r := gin.New()
+	r.POST("/me/avatar", asUser(user.ID, e.handler.UploadAvatar))
+	r.GET("/me/storage", asUser(user.ID, e.handler.GetStorage))
+
+	if w := uploadAvatar(t, r, bytes.Repeat([]byte("a"), 60)); w.Code != http.StatusCreated {
+		t.Fatalf("under quota: status = %d, want 201: %s", w.Code, w.Body)
+	}
+
+	w := doJSON(r, http.MethodGet, "/me/storage", nil, nil)
+	var usage struct {
+		Used  int64 `json:"used_bytes"`
+		Quota int64 `json:"quota_bytes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatal(err)
+	}
+	if usage.Used != 60 || usage.Quota != 100 {
+		t.Errorf("storage = %+v, want 60 of 100 bytes", usage)
+	}
+
+	// The same bytes map to the stored object, so re-uploading them needs
+	// no more space.
+	if w := uploadAvatar(t, r, bytes.Repeat([]byte("a"), 60)); w.Code != http.StatusCreated {
+		t.Fatalf("same avatar again: status = %d, want 201: %s", w.Code, w.Body)
+	}
+
+	// Earlier versions are kept, so a second avatar would need 120 bytes.
+	if w := uploadAvatar(t, r, bytes.Repeat([]byte("b"), 60)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("over quota: status = %d, want 413: %s", w.Code, w.Body)
+	}
+	if keys := e.store.Keys(service.AvatarUserPrefix(user.ID)); len(keys) != 1 {
+		t.Errorf("stored %v after the rejected upload, want only the first avatar", keys)
+	}
+
+	if _, err := e.db.Exec(context.Background(), `UPDATE users SET plan = $1 WHERE id = $2`, models.PlanPro, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := uploadAvatar(t, r, bytes.Repeat([]byte("b"), 60)); w.Code != http.StatusCreated {
+		t.Errorf("under the pro quota: status = %d, want 201: %s", w.Code, w.Body)
+	}
+}
+
+func TestAvatarRedirectsToImmutableURL(t *testing.T) {
+	e := newAvatarEnv(t, 1)
+	user := e.createUser(t, "alice")
+
+	r := gin.New()
+	r.POST("/me/avatar", asUser(user.ID, e.handler.UploadAvatar))
+	r.GET("/api/v1/avatars/:userID/:hash", e.handler.GetImmutableAvatar)
+	r.GET("/api/v1/users/:id/avatar", e.handler.GetUserAvatar)
+	avatarPath := fmt.Sprintf("/api/v1/users/%d/avatar", user.ID)
+
+	for _, data := range []string{"first avatar", "second avatar"} {
+		w := uploadAvatar(t, r, []byte(data))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("upload: status = %d: %s", w.Code, w.Body)
+		}
+		current := w.Header().Get("Location")
+
+		w = doJSON(r, http.MethodGet, avatarPath, nil, nil)
+		if w.Code != http.StatusFound || w.Header().Get("Location") != current {
+			t.Fatalf("redirect = %d to %q, want 302 to the current avatar %q", w.Code, w.Header().Get("Location"), current)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+			t.Errorf("redirect Cache-Control = %q, want no-cache", got)
+		}
+
+		w = doJSON(r, http.MethodGet, current, nil, nil)
+		if w.Code != http.StatusOK || w.Body.String() != data {
+			t.Fatalf("immutable URL = %d %q, want the %q avatar", w.Code, w.Body, data)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+			t.Errorf("immutable Cache-Control = %q", got)
+		}
+	}
+
+	missing := fmt.Sprintf("/api/v1/avatars/%d/%s", user.ID, strings.Repeat("0", 64))
+	w := doJSON(r, http.MethodGet, missing, nil, nil)
+	if w.Code != http.StatusNotFound || w.Header().Get("Cache-Control") != "" {
+		t.Errorf("unknown hash = %d with Cache-Control %q, want an uncached 404", w.Code, w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestAvatarBatch(t *testing.T) {
+	e := newAvatarEnv(t, 1)
+	alice := e.createUser(t, "alice")
+	bob := e.createUser(t, "bob")
+	carol := e.createUser(t, "carol")
+
+	r := gin.New()
+	r.POST("/me/avatar", asUser(alice.ID, e.handler.UploadAvatar))
+	r.POST("/avatars/batch", e.handler.GetAvatarBatch)
+
+	w := uploadAvatar(t, r, []byte("alice"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: status = %d: %s", w.Code, w.Body)
+	}
+	aliceURL := w.Header().Get("Location")
+
+	legacy := service.LegacyAvatarKey(bob.ID)
+	e.store.Put(legacy, []byte("bob"), time.Now())
+	if err := e.users.UpdateAvatar(context.Background(), bob.ID, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	w = doJSON(r, http.MethodPost, "/avatars/batch", map[string]any{
+		"user_ids": []int64{alice.ID, bob.ID, carol.ID, carol.ID + 1000},
+	}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Avatars map[int64]string `json:"avatars"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Avatars) != 2 {
+		t.Errorf("avatars = %v, want only alice and bob", resp.Avatars)
+	}
+	if got := resp.Avatars[alice.ID]; got != aliceURL {
+		t.Errorf("alice = %q, want the immutable URL %q", got, aliceURL)
+	}
+	if got := resp.Avatars[bob.ID]; !strings.Contains(got, legacy) || !strings.Contains(got, "X-Amz-Signature") {
+		t.Errorf("bob = %q, want a presigned URL for %s", got, legacy)
+	}
+
+	tooMany := make([]int64, 101)
+	for i := range tooMany {
+		tooMany[i] = int64(i + 1)
+	}
+	for name, ids := range map[string][]int64{"empty": {}, "zero id": {0}, "over the cap": tooMany} {
+		if w := doJSON(r, http.MethodPost, "/avatars/batch", map[string]any{"user_ids": ids}, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestAvatarVersionRetention(t *testing.T) {
+	for _, versions := range []int{1, 3} {
+		t.Run(fmt.Sprintf("%d versions", versions), func(t *testing.T) {
+			e := newAvatarEnv(t, versions)
+			user := e.createUser(t, "alice")
+
+			r := gin.New()
+			r.POST("/me/avatar", asUser(user.ID, e.handler.UploadAvatar))
+
+			var uploaded []string
+			for i := range 5 {
+				// The store records modification times to the millisecond.
+				time.Sleep(2 * time.Millisecond)
+				w := uploadAvatar(t, r, []byte(fmt.Sprintf("avatar %d", i)))
+				if w.Code != http.StatusCreated {
+					t.Fatalf("upload %d: status = %d: %s", i, w.Code, w.Body)
+				}
+				var resp struct {
+					Path string `json:"path"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				uploaded = append(uploaded, resp.Path)
+			}
+
+			want := slices.Sorted(slices.Values(uploaded[len(uploaded)-versions:]))
+			if got := slices.Sorted(slices.Values(e.store.Keys(service.AvatarUserPrefix(user.ID)))); !slices.Equal(got, want) {
+				t.Errorf("kept %v, want the %d most recent %v", got, versions, want)
+			}
+		})
+	}
+}
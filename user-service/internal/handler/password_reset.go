@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
+)
+
+type PasswordResetHandler struct {
+	authService *service.AuthService
+}
+
+func NewPasswordResetHandler(authService *service.AuthService) *PasswordResetHandler {
+	return &PasswordResetHandler{authService: authService}
+}
+
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	var req dto.ForgotPasswordRequest
+	if err := bindBody(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Failures get the same answer as success: an error here would only
+	// ever happen for registered addresses.
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		log.Printf("password reset request failed: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If this address belongs to an account, password reset instructions have been sent",
+	})
+}
+
+// resetPasswordPage is the target of the link in the reset email. It only
+// renders a form; the reset itself takes the POST.
+var resetPasswordPage = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>Reset your password</title></head>
+<body>
+<form method="POST" action="/reset-password">
+<input type="hidden" name="token" value="{{.}}">
+<label>New password <input type="password" name="new_password" autocomplete="new-password" required></label>
+<button type="submit">Reset password</button>
+</form>
+</body>
+</html>`))
+
+func (h *PasswordResetHandler) ResetPasswordPage(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "no token provided",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := resetPasswordPage.Execute(c.Writer, token); err != nil {
+		log.Printf("failed to render password reset page: %v", err)
+	}
+}
+
+// ResetPassword accepts JSON from API clients and the form posted by
+// ResetPasswordPage.
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	var req dto.ResetPasswordRequest
+	if err := bindBody(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var err error
+	if req.Code != "" {
+		err = h.authService.ConfirmPasswordReset(c.Request.Context(), req.Email, req.Code, req.NewPassword)
+	} else {
+		err = h.authService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
+	}
+	if err != nil {
+		var fieldErrs validator.FieldErrors
+		switch {
+		case errors.As(err, &fieldErrs):
+			respondFieldErrors(c, fieldErrs)
+		case errors.Is(err, service.ErrServiceBusy):
+			respondBusy(c)
+		case errors.Is(err, service.ErrResetAttemptsExceeded):
+			c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
+				Error:   "too_many_attempts",
+				Message: "Too many attempts, please try again later",
+			})
+		case req.Code != "" && isResetFailure(err):
+			// Whether a code was wrong, spent or expired would tell a
+			// guesser which codes were once valid.
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "invalid_code",
+				Message: "Code is invalid or has expired",
+			})
+		case errors.Is(err, repository.ErrResetExpired):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "reset_expired",
+				Message: "Password reset link has expired, please request a new one",
+			})
+		case errors.Is(err, repository.ErrResetUsed):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "reset_used",
+				Message: "Password reset link has already been used",
+			})
+		case errors.Is(err, repository.ErrResetNotFound), errors.Is(err, repository.ErrUserNotFound):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "invalid_token",
+				Message: "Password reset link is invalid",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error:   "internal_error",
+				Message: "Failed to reset password",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+}
+
+func isResetFailure(err error) bool {
+	return errors.Is(err, repository.ErrResetNotFound) ||
+		errors.Is(err, repository.ErrResetExpired) ||
+		errors.Is(err, repository.ErrResetUsed) ||
+		errors.Is(err, repository.ErrUserNotFound)
+}
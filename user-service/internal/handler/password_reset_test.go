@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+)
+
+func TestForgotPasswordHidesSendFailures(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := s.users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/forgot-password", NewPasswordResetHandler(s.auth).ForgotPassword)
+
+	registered := doJSON(router, http.MethodPost, "/forgot-password", gin.H{"email": "alice@example.com"}, nil)
+	unknown := doJSON(router, http.MethodPost, "/forgot-password", gin.H{"email": "nobody@example.com"}, nil)
+
+	if registered.Code != http.StatusOK {
+		t.Fatalf("registered address: got %d, want 200", registered.Code)
+	}
+	if registered.Body.String() != unknown.Body.String() {
+		t.Fatalf("responses differ:\n%s\n%s", registered.Body, unknown.Body)
+	}
+}
+
+func TestResetCodeFailuresLookAlike(t *testing.T) {
+	sender := codeSender{codes: make(chan string, 1)}
+	s := newTestServices(t, sender, func(cfg *config.Config) { cfg.PasswordResetMode = service.PasswordResetCode })
+	ctx := context.Background()
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := s.users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.auth.RequestPasswordReset(ctx, user.Email); err != nil {
+		t.Fatal(err)
+	}
+	code := <-sender.codes
+
+	router := gin.New()
+	router.POST("/reset-password", NewPasswordResetHandler(s.auth).ResetPassword)
+	reset := func(code string) *httptest.ResponseRecorder {
+		return doJSON(router, http.MethodPost, "/reset-password", gin.H{
+			"email":        user.Email,
+			"code":         code,
+			"new_password": "battery-staple",
+		}, nil)
+	}
+
+	wrong := "000000"
+	if wrong == code {
+		wrong = "000001"
+	}
+	responses := map[string]*httptest.ResponseRecorder{"wrong": reset(wrong)}
+
+	if _, err := s.db.Exec(ctx, `UPDATE password_resets SET expires_at = $1`, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	responses["expired"] = reset(code)
+
+	if _, err := s.db.Exec(ctx, `UPDATE password_resets SET expires_at = $1, used_at = NOW()`, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	responses["used"] = reset(code)
+
+	for name, w := range responses {
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"invalid_code"`) {
+			t.Errorf("%s code: got %d %s, want 400 invalid_code", name, w.Code, w.Body)
+		}
+		if w.Body.String() != responses["wrong"].Body.String() {
+			t.Errorf("%s code response differs from a wrong code", name)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
+)
+
+type ReportHandler struct {
+	reportService *service.ReportService
+}
+
+func NewReportHandler(reportService *service.ReportService) *ReportHandler {
+	return &ReportHandler{reportService: reportService}
+}
+
+func (h *ReportHandler) ReportUser(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	var uriParam struct {
+		ID int64 `uri:"id" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindUri(&uriParam); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	var req dto.ReportUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	report, err := h.reportService.ReportUser(c.Request.Context(), userID, uriParam.ID, req.Reason, req.Details)
+	if err != nil {
+		var fieldErrs validator.FieldErrors
+		var rateErr *service.ReportRateLimitError
+		switch {
+		case errors.As(err, &fieldErrs):
+			respondFieldErrors(c, fieldErrs)
+		case errors.Is(err, repository.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "user_not_found",
+			})
+		case errors.Is(err, service.ErrCannotReportSelf):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "cannot_report_self",
+				Message: err.Error(),
+			})
+		case errors.Is(err, repository.ErrDuplicateReport):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{
+				Error:   "report_exists",
+				Message: err.Error(),
+			})
+		case errors.As(err, &rateErr):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
+				Error:   "rate_limited",
+				Message: err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error: "internal_error",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// ListReports is the moderation queue: open reports oldest first unless
+// another status is asked for.
+func (h *ReportHandler) ListReports(c *gin.Context) {
+	var query struct {
+		Status string `form:"status" binding:"omitempty,oneof=open resolved dismissed all"`
+		Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+		Offset int    `form:"offset" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 20
+	}
+	switch query.Status {
+	case "":
+		query.Status = models.ReportStatusOpen
+	case "all":
+		query.Status = ""
+	}
+
+	reports, err := h.reportService.List(c.Request.Context(), query.Status, query.Limit, query.Offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": reports,
+		"limit":   query.Limit,
+		"offset":  query.Offset,
+	})
+}
+
+func (h *ReportHandler) ResolveReport(c *gin.Context) {
+	var uriParam struct {
+		ID int64 `uri:"id" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindUri(&uriParam); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid report ID",
+		})
+		return
+	}
+
+	var req dto.ResolveReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	report, err := h.reportService.Resolve(c.Request.Context(), uriParam.ID, middleware.GetUserID(c), req.Status, req.Note)
+	if err != nil {
+		var fieldErrs validator.FieldErrors
+		switch {
+		case errors.As(err, &fieldErrs):
+			respondFieldErrors(c, fieldErrs)
+		case errors.Is(err, repository.ErrReportNotFound):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: "report_not_found",
+			})
+		case errors.Is(err, repository.ErrReportClosed):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{
+				Error:   "report_closed",
+				Message: err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error: "internal_error",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+)
+
+// reportEnv serves the report routes on a test database, with the caller
+// chosen per request through the X-Test-User header.
+type reportEnv struct {
+	*avatarEnv
+	router *gin.Engine
+}
+
+func newReportEnv(t *testing.T, limit int, window time.Duration) *reportEnv {
+	t.Helper()
+
+	e := &reportEnv{avatarEnv: newAvatarEnv(t, 1)}
+	h := NewReportHandler(service.NewReportService(repository.NewReportRepository(e.db), e.users, e.redis, limit, window))
+
+	e.router = gin.New()
+	e.router.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set(ctxkey.UserID, id)
+	})
+	e.router.POST("/users/:id/report", h.ReportUser)
+	e.router.GET("/admin/reports", h.ListReports)
+	return e
+}
+
+func (e *reportEnv) report(reporter, target *models.User, reason string) *httptest.ResponseRecorder {
+	return doJSON(e.router, http.MethodPost, fmt.Sprintf("/users/%d/report", target.ID),
+		map[string]string{"reason": reason},
+		http.Header{"X-Test-User": {strconv.FormatInt(reporter.ID, 10)}})
+}
+
+func TestReportUserCreatesReport(t *testing.T) {
+	e := newReportEnv(t, 5, time.Hour)
+	alice, mallory := e.createUser(t, "alice"), e.createUser(t, "mallory")
+
+	w := e.report(alice, mallory, models.ReportReasonSpam)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", w.Code, w.Body)
+	}
+	if loc := w.Header().Get("Location"); loc != "" {
+		t.Errorf("Location = %q, want none", loc)
+	}
+
+	var report models.UserReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.ID == 0 || report.TargetID != mallory.ID || report.Status != models.ReportStatusOpen {
+		t.Errorf("report = %+v", report)
+	}
+
+	if w := e.report(alice, alice, models.ReportReasonSpam); w.Code != http.StatusBadRequest {
+		t.Errorf("self report: status = %d, want 400", w.Code)
+	}
+	if w := e.report(alice, mallory, "no-such-reason"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown reason: status = %d, want 400", w.Code)
+	}
+}
+
+func TestListReportsShowsOpenQueueInOrder(t *testing.T) {
+	e := newReportEnv(t, 5, time.Hour)
+	alice, bob, mallory := e.createUser(t, "alice"), e.createUser(t, "bob"), e.createUser(t, "mallory")
+
+	for _, reporter := range []*models.User{alice, bob} {
+		if w := e.report(reporter, mallory, models.ReportReasonHarassment); w.Code != http.StatusCreated {
+			t.Fatalf("report: status = %d: %s", w.Code, w.Body)
+		}
+	}
+
+	w := doJSON(e.router, http.MethodGet, "/admin/reports", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var page struct {
+		Reports []models.UserReport `json:"reports"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	reports := page.Reports
+	if len(reports) != 2 || *reports[0].ReporterID != alice.ID || *reports[1].ReporterID != bob.ID {
+		t.Errorf("reports = %+v, want alice's then bob's", reports)
+	}
+
+	w = doJSON(e.router, http.MethodGet, "/admin/reports?status=dismissed", nil, nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Reports) != 0 {
+		t.Errorf("dismissed reports = %s, want none", w.Body)
+	}
+}
+
+func TestReportRateLimit(t *testing.T) {
+	e := newReportEnv(t, 2, time.Hour)
+	alice := e.createUser(t, "alice")
+	targets := []*models.User{e.createUser(t, "target1"), e.createUser(t, "target2"), e.createUser(t, "target3")}
+
+	if w := e.report(alice, targets[0], models.ReportReasonSpam); w.Code != http.StatusCreated {
+		t.Fatalf("first report: status = %d: %s", w.Code, w.Body)
+	}
+	// A duplicate is refused and doesn't count against the limit.
+	if w := e.report(alice, targets[0], models.ReportReasonSpam); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate: status = %d, want 409", w.Code)
+	}
+	if w := e.report(alice, targets[1], models.ReportReasonSpam); w.Code != http.StatusCreated {
+		t.Fatalf("second report: status = %d, want 201: %s", w.Code, w.Body)
+	}
+
+	w := e.report(alice, targets[2], models.ReportReasonSpam)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third report: status = %d, want 429", w.Code)
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter <= 0 || retryAfter > 3600 {
+		t.Errorf("Retry-After = %q, want the window's remaining seconds", w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+const (
+	defaultSessionExportDays = 30
+	sessionExportFlushEvery  = 100
+)
+
+var sessionCSVHeader = []string{
+	"id", "status", "device_id", "user_agent", "ip_address",
+	"created_at", "expires_at", "revoked_at", "rotated_at",
+}
+
+// sessionSource streams the sessions of one user to fn.
+type sessionSource func(since time.Time, fn func(*repository.Session) error) error
+
+func (h *AuthHandler) ExportSessions(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "unauthorized",
+		})
+		return
+	}
+
+	streamSessionsCSV(c, userID, func(since time.Time, fn func(*repository.Session) error) error {
+		return h.authService.ExportSessions(c.Request.Context(), userID, since, fn)
+	})
+}
+
+func (h *AdminHandler) ExportUserSessions(c *gin.Context) {
+	var uriParam struct {
+		ID int64 `uri:"id" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindUri(&uriParam); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	streamSessionsCSV(c, uriParam.ID, func(since time.Time, fn func(*repository.Session) error) error {
+		return h.sessionRepo.EachByUserID(c.Request.Context(), uriParam.ID, since, fn)
+	})
+}
+
+// streamSessionsCSV writes the sessions of the last ?days= days (default
+// 30) as a CSV attachment, flushing as rows arrive. Once the first row is
+// out the status can't change, so later failures only cut the file short.
+func streamSessionsCSV(c *gin.Context, userID int64, source sessionSource) {
+	var query struct {
+		Days int `form:"days" binding:"omitempty,min=1,max=365"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+	if query.Days == 0 {
+		query.Days = defaultSessionExportDays
+	}
+	since := time.Now().AddDate(0, 0, -query.Days)
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="sessions-%d.csv"`, userID))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(sessionCSVHeader)
+
+	now := time.Now()
+	rows := 0
+	err := source(since, func(sess *repository.Session) error {
+		if err := w.Write(sessionCSVRecord(sess, now)); err != nil {
+			return err
+		}
+		rows++
+		if rows%sessionExportFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+	w.Flush()
+	if err != nil {
+		log.Printf("session export for user %d stopped after %d rows: %v", userID, rows, err)
+	}
+}
+
+func sessionCSVRecord(sess *repository.Session, now time.Time) []string {
+	return []string{
+		strconv.FormatInt(sess.ID, 10),
+		sessionStatus(sess, now),
+		csvSafe(deref(sess.DeviceID)),
+		csvSafe(deref(sess.UserAgent)),
+		csvSafe(deref(sess.IPAddress)),
+		sess.CreatedAt.UTC().Format(time.RFC3339),
+		sess.ExpiresAt.UTC().Format(time.RFC3339),
+		formatTime(sess.RevokedAt),
+		formatTime(sess.RotatedAt),
+	}
+}
+
+// sessionStatus explains why a session is no longer active. A rotation is
+// the normal end of a session; "revoked" covers logouts and forced
+// revocations.
+func sessionStatus(sess *repository.Session, now time.Time) string {
+	switch {
+	case sess.RotatedAt != nil:
+		return "rotated"
+	case sess.RevokedAt != nil:
+		return "revoked"
+	case now.After(sess.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// csvSafe stops a client-supplied value from being read as a formula when
+// the export is opened in a spreadsheet, by prefixing a quote to anything
+// starting with a formula trigger.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func exportSessions(t *testing.T, path string, sessions []*repository.Session, failAfter int) (*httptest.ResponseRecorder, [][]string) {
+	t.Helper()
+
+	r := gin.New()
+	r.GET("/export", func(c *gin.Context) {
+		streamSessionsCSV(c, 42, func(since time.Time, fn func(*repository.Session) error) error {
+			for i, sess := range sessions {
+				if i == failAfter {
+					return errors.New("connection reset")
+				}
+				if err := fn(sess); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK {
+		return w, nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("response isn't valid CSV: %v\n%s", err, w.Body)
+	}
+	return w, records
+}
+
+func TestSessionExportColumnsAndRows(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rotated := created.Add(time.Hour)
+	sessions := []*repository.Session{
+		{
+			ID:        1,
+			UserAgent: ptr("Firefox"),
+			IPAddress: ptr("203.0.113.5"),
+			DeviceID:  ptr("laptop"),
+			CreatedAt: created,
+			ExpiresAt: created.Add(24 * time.Hour),
+			RotatedAt: &rotated,
+		},
+		{
+			ID:        2,
+			CreatedAt: created,
+			ExpiresAt: time.Now().Add(time.Hour),
+		},
+	}
+
+	w, records := exportSessions(t, "/export", sessions, -1)
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="sessions-42.csv"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want header and 2 rows", len(records))
+	}
+	if !slices.Equal(records[0], sessionCSVHeader) {
+		t.Errorf("header = %v, want %v", records[0], sessionCSVHeader)
+	}
+	want := []string{"1", "rotated", "laptop", "Firefox", "203.0.113.5",
+		"2026-03-01T12:00:00Z", "2026-03-02T12:00:00Z", "", "2026-03-01T13:00:00Z"}
+	if !slices.Equal(records[1], want) {
+		t.Errorf("row 1 = %v, want %v", records[1], want)
+	}
+	if records[2][0] != "2" || records[2][1] != "active" || records[2][2] != "" {
+		t.Errorf("row 2 = %v, want an active session with empty optional fields", records[2])
+	}
+}
+
+func TestSessionExportNeutralizesFormulas(t *testing.T) {
+	for _, value := range []string{"=HYPERLINK(\"http://evil\")", "+1", "-2+3", "@SUM(A1)", "\tcmd", "\rcmd"} {
+		sess := &repository.Session{ID: 1, UserAgent: ptr(value), DeviceID: ptr(value), IPAddress: ptr(value)}
+		_, records := exportSessions(t, "/export", []*repository.Session{sess}, -1)
+
+		for _, col := range []int{2, 3, 4} {
+			if got := records[1][col]; got != "'"+value {
+				t.Errorf("column %s for %q = %q, want it quoted", sessionCSVHeader[col], value, got)
+			}
+		}
+	}
+
+	sess := &repository.Session{ID: 1, UserAgent: ptr("Mozilla/5.0 (X11)")}
+	_, records := exportSessions(t, "/export", []*repository.Session{sess}, -1)
+	if got := records[1][3]; got != "Mozilla/5.0 (X11)" {
+		t.Errorf("plain value rewritten to %q", got)
+	}
+}
+
+func TestSessionExportStopsOnSourceError(t *testing.T) {
+	sessions := []*repository.Session{{ID: 1}, {ID: 2}, {ID: 3}}
+	_, records := exportSessions(t, "/export", sessions, 2)
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want header and the 2 rows before the failure", len(records))
+	}
+}
+
+func TestSessionExportRejectsBadDays(t *testing.T) {
+	for _, days := range []string{"0x", "-1", "366"} {
+		w, _ := exportSessions(t, "/export?days="+days, nil, -1)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("days=%s: status = %d, want 400", days, w.Code)
+		}
+	}
+}
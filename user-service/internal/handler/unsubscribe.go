@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/mailer"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+type UnsubscribeHandler struct {
+	userRepo *repository.UserRepository
+	signer   *mailer.UnsubscribeSigner
+}
+
+func NewUnsubscribeHandler(userRepo *repository.UserRepository, signer *mailer.UnsubscribeSigner) *UnsubscribeHandler {
+	return &UnsubscribeHandler{userRepo: userRepo, signer: signer}
+}
+
+// unsubscribePage is served for the link in optional emails. Like email
+// verification, the change itself takes a POST so link scanners don't
+// unsubscribe anyone.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>Unsubscribe</title></head>
+<body>
+<p>Stop receiving onboarding emails and sign-in alerts? Security emails such as password resets will still be sent.</p>
+<form method="POST" action="/unsubscribe">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>`))
+
+func (h *UnsubscribeHandler) UnsubscribePage(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "no token provided",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := unsubscribePage.Execute(c.Writer, token); err != nil {
+		log.Printf("failed to render unsubscribe page: %v", err)
+	}
+}
+
+// Unsubscribe switches the account to essential emails only. The token may
+// also come in the query, so mail clients' one-click unsubscribe works.
+// Users opt back in through PUT /users/me.
+func (h *UnsubscribeHandler) Unsubscribe(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		token = c.Query("token")
+	}
+	if token == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "no token provided",
+		})
+		return
+	}
+
+	userID, err := h.signer.Verify(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "invalid_token",
+			Message: "Unsubscribe link is invalid",
+		})
+		return
+	}
+
+	err = h.userRepo.SetEmailPreferences(c.Request.Context(), userID, models.EmailPreferencesEssential)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to update email preferences",
+		})
+		return
+	}
+
+	// A deleted account has nothing left to unsubscribe from; report success
+	// either way.
+	c.JSON(http.StatusOK, gin.H{"message": "you have been unsubscribed"})
+}
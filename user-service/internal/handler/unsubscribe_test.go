@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/mailer"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+func TestUnsubscribe(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	ctx := context.Background()
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	bob := &models.User{Username: "bob", Email: "Alice@Example.com", PasswordHash: "x"}
+	for _, u := range []*models.User{alice, bob} {
+		if err := s.users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signer := mailer.NewUnsubscribeSigner([]byte("secret"))
+	router := gin.New()
+	router.POST("/unsubscribe", NewUnsubscribeHandler(s.users, signer).Unsubscribe)
+
+	post := func(token string) int {
+		form := url.Values{"token": {token}}
+		req := httptest.NewRequest(http.MethodPost, "/unsubscribe", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(signer.Token(alice.ID) + "x"); code != http.StatusBadRequest {
+		t.Fatalf("tampered token: got %d, want 400", code)
+	}
+	if code := post(signer.Token(alice.ID)); code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+
+	essential, err := s.users.EssentialEmailsOnly(ctx, alice.ID)
+	if err != nil || !essential {
+		t.Fatalf("alice essential only = %v, %v; want true", essential, err)
+	}
+	// An account whose address differs only in case is left alone.
+	essential, err = s.users.EssentialEmailsOnly(ctx, bob.ID)
+	if err != nil || essential {
+		t.Fatalf("bob essential only = %v, %v; want false", essential, err)
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/middleware"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
 )
 
 type UserHandler struct {
@@ -65,6 +68,11 @@ func (h *UserHandler) UpdateMe(c *gin.Context) {
 		return
 	}
 
+	if errs := validator.ValidateUpdateUserRequest(&req); errs != nil {
+		respondFieldErrors(c, errs)
+		return
+	}
+
 	user, err := h.userRepo.GetByID(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{
@@ -82,6 +90,9 @@ func (h *UserHandler) UpdateMe(c *gin.Context) {
 	if req.Status != nil {
 		user.Status = *req.Status
 	}
+	if req.EmailPreferences != nil {
+		user.EmailPreferences = *req.EmailPreferences
+	}
 
 	err = h.userRepo.Update(c.Request.Context(), user)
 	if err != nil {
@@ -94,6 +105,99 @@ func (h *UserHandler) UpdateMe(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// maxSearchLimit caps the page size of user searches, which back
+// autocomplete and shouldn't return whole directories.
+const maxSearchLimit = 50
+
+// ListUsers pages through users newest first. Pass the returned next_cursor
+// as cursor for stable iteration; offset is kept for simple cases. With q
+// set it searches instead; see searchUsers.
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	var query struct {
+		Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+		Offset int    `form:"offset" binding:"omitempty,min=0"`
+		Cursor string `form:"cursor"`
+		Q      string `form:"q" binding:"max=100"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 20
+	}
+
+	if q := strings.TrimSpace(query.Q); q != "" {
+		if query.Cursor != "" {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "validation_error",
+				Message: "cursor can't be combined with q; use offset",
+			})
+			return
+		}
+		h.searchUsers(c, q, min(query.Limit, maxSearchLimit), query.Offset)
+		return
+	}
+
+	params := repository.ListUsersParams{Limit: query.Limit, Offset: query.Offset}
+	if query.Cursor != "" {
+		cursor, err := repository.DecodeUserCursor(query.Cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "invalid_cursor",
+				Message: err.Error(),
+			})
+			return
+		}
+		params.After = cursor
+		params.Offset = 0
+	}
+
+	users, next, err := h.userRepo.List(c.Request.Context(), params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	resp := dto.ListUsersResponse{
+		Users:  make([]*models.PublicUser, 0, len(users)),
+		Limit:  params.Limit,
+		Offset: params.Offset,
+	}
+	for _, user := range users {
+		resp.Users = append(resp.Users, user.Public())
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// searchUsers matches q as a prefix of usernames and display names, ordered
+// by username, and reports the total number of matches.
+func (h *UserHandler) searchUsers(c *gin.Context, q string, limit, offset int) {
+	users, total, err := h.userRepo.Search(c.Request.Context(), q, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: "internal_error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ListUsersResponse{
+		Users:  users,
+		Limit:  limit,
+		Offset: offset,
+		Total:  &total,
+	})
+}
+
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	var uriParam struct {
 		ID int64 `uri:"id" binding:"required,min=1"`
@@ -107,7 +211,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userRepo.GetByID(c.Request.Context(), uriParam.ID)
+	user, err := h.userRepo.GetByIDShared(c.Request.Context(), uriParam.ID)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+func TestUpdateMeStatus(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := s.users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.PUT("/users/me", asUser(user.ID, NewUserHandler(s.users).UpdateMe))
+
+	w := doJSON(router, http.MethodPut, "/users/me", gin.H{"status": "Away"}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status Away: %d: %s", w.Code, w.Body)
+	}
+	stored, err := s.users.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.StatusAway {
+		t.Errorf("stored status = %q, want %q", stored.Status, models.StatusAway)
+	}
+
+	w = doJSON(router, http.MethodPut, "/users/me", gin.H{"status": "sleeping"}, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown status: %d, want 400: %s", w.Code, w.Body)
+	}
+	var resp dto.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Fields["status"] == "" {
+		t.Errorf("response %+v has no status field error", resp)
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	s := newTestServices(t, failingSender{}, nil)
+	ctx := context.Background()
+	for i := range maxSearchLimit + 1 {
+		user := &models.User{Username: fmt.Sprintf("user%02d", i), Email: fmt.Sprintf("user%02d@example.com", i), PasswordHash: "x"}
+		if err := s.users.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := gin.New()
+	router.GET("/users", NewUserHandler(s.users).ListUsers)
+
+	w := doJSON(router, http.MethodGet, "/users?q=user&limit=100", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: %d: %s", w.Code, w.Body)
+	}
+	var resp dto.ListUsersResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Limit != maxSearchLimit || len(resp.Users) != maxSearchLimit {
+		t.Errorf("limit 100 returned %d users with limit %d, want the cap of %d", len(resp.Users), resp.Limit, maxSearchLimit)
+	}
+	if resp.Total == nil || *resp.Total != maxSearchLimit+1 {
+		t.Errorf("total = %v, want %d", resp.Total, maxSearchLimit+1)
+	}
+
+	w = doJSON(router, http.MethodGet, "/users?q=user&cursor=abc", nil, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("q with a cursor: %d, want 400: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+)
+
+const verifyTokenSecret = "verify-token-test-secret"
+
+// newVerifyTokenRouter serves verify-token the way main does, trusting no
+// proxies. The endpoint never touches the database.
+func newVerifyTokenRouter(t *testing.T, rateLimit int) (*gin.Engine, *miniredis.Miniredis, *jwt.TokenManager) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	cfg := config.LoadConfig()
+	cfg.VerifyTokenRateLimit = rateLimit
+	cfg.VerifyTokenRateWindow = time.Minute
+
+	tokens := jwt.NewTokenManager(verifyTokenSecret, 0)
+	auth := service.NewAuthService(nil, tokens, nil, nil, nil, nil, failingSender{}, redisClient, nil, cfg)
+
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	r.POST("/verify-token", NewAuthHandler(auth, false).VerifyToken)
+	return r, mr, tokens
+}
+
+func verifyToken(r http.Handler, token, remoteAddr string, header http.Header) (*httptest.ResponseRecorder, map[string]any) {
+	req := httptest.NewRequest(http.MethodPost, "/verify-token", strings.NewReader(`{"token":"`+token+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+func expiredAccessToken(t *testing.T) string {
+	t.Helper()
+	claims := jwt.Claims{
+		UserId:   7,
+		Username: "alice",
+		Email:    "alice@example.com",
+		RegisteredClaims: gojwt.RegisteredClaims{
+			ExpiresAt: gojwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			IssuedAt:  gojwt.NewNumericDate(time.Now().Add(-16 * time.Minute)),
+		},
+	}
+	token, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims).SignedString([]byte(verifyTokenSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyTokenResponses(t *testing.T) {
+	r, mr, tokens := newVerifyTokenRouter(t, 0)
+
+	valid, _, err := tokens.GenerateAccessToken(7, "alice", "alice@example.com", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		w, body := verifyToken(r, valid, "203.0.113.5:1234", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+		}
+		if body["valid"] != true || body["user_id"] != float64(7) || body["expires_at"] == nil {
+			t.Errorf("body = %v, want valid with user_id and expires_at", body)
+		}
+		if _, ok := body["reason"]; ok {
+			t.Errorf("valid token reported a reason: %v", body)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		w, body := verifyToken(r, expiredAccessToken(t), "203.0.113.5:1234", nil)
+		assertInvalidToken(t, w, body, service.TokenReasonExpired)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		if err := mr.Set("revoked:"+valid, "1"); err != nil {
+			t.Fatal(err)
+		}
+		w, body := verifyToken(r, valid, "203.0.113.5:1234", nil)
+		assertInvalidToken(t, w, body, service.TokenReasonRevoked)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		w, body := verifyToken(r, "not-a-jwt", "203.0.113.5:1234", nil)
+		assertInvalidToken(t, w, body, service.TokenReasonInvalid)
+	})
+}
+
+func assertInvalidToken(t *testing.T, w *httptest.ResponseRecorder, body map[string]any, reason string) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if body["valid"] != false || body["reason"] != reason {
+		t.Errorf("body = %v, want valid=false reason=%q", body, reason)
+	}
+	for _, field := range []string{"user_id", "expires_at"} {
+		if _, ok := body[field]; ok {
+			t.Errorf("invalid token response carries %s: %v", field, body)
+		}
+	}
+}
+
+func TestVerifyTokenRateLimitKeysOnPeer(t *testing.T) {
+	r, _, _ := newVerifyTokenRouter(t, 2)
+
+	// Rotating X-Forwarded-For doesn't earn an untrusted peer more calls.
+	for i, forwarded := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		w, _ := verifyToken(r, "not-a-jwt", "203.0.113.5:1234", http.Header{"X-Forwarded-For": {forwarded}})
+		want := http.StatusOK
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Fatalf("call %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+
+	if w, _ := verifyToken(r, "not-a-jwt", "198.51.100.9:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("other peer: status = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const capTimeout = time.Second
+
+// RecipientCap counts emails per recipient per UTC day in Redis. Exempt
+// types are neither counted nor limited. If Redis is unreachable emails
+// are let through.
+type RecipientCap struct {
+	client *redis.Client
+	limit  int64
+	exempt []EmailType
+}
+
+func NewRecipientCap(client *redis.Client, limit int, exempt []EmailType) *RecipientCap {
+	return &RecipientCap{client: client, limit: int64(limit), exempt: exempt}
+}
+
+// Allow records an email of type t to to and reports whether it may be sent.
+func (c *RecipientCap) Allow(t EmailType, to string) bool {
+	if c.limit <= 0 || slices.Contains(c.exempt, t) {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), capTimeout)
+	defer cancel()
+
+	key := "email_cap:" + time.Now().UTC().Format("2006-01-02") + ":" + strings.ToLower(strings.TrimSpace(to))
+	pipe := c.client.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 25*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("email cap unavailable: %v", err)
+		return true
+	}
+
+	return count.Val() <= c.limit
+}
@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCap(t *testing.T, limit int, exempt ...EmailType) (*miniredis.Miniredis, *RecipientCap) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return mr, NewRecipientCap(client, limit, exempt)
+}
+
+func TestRecipientCapSuppressesOverLimit(t *testing.T) {
+	_, c := newTestCap(t, 3)
+
+	for i := range 3 {
+		if !c.Allow(EmailLoginAlert, "alice@example.com") {
+			t.Fatalf("email %d of 3 suppressed", i+1)
+		}
+	}
+	// The same inbox however it's written.
+	if c.Allow(EmailAccount, " Alice@Example.com ") {
+		t.Error("4th email to the same recipient allowed")
+	}
+	if !c.Allow(EmailAccount, "bob@example.com") {
+		t.Error("another recipient was capped")
+	}
+}
+
+func TestRecipientCapExemptTypes(t *testing.T) {
+	_, c := newTestCap(t, 1, EmailPasswordReset)
+
+	for range 5 {
+		if !c.Allow(EmailPasswordReset, "alice@example.com") {
+			t.Fatal("exempt email suppressed")
+		}
+	}
+	// Exempt emails don't use up the allowance either.
+	if !c.Allow(EmailLoginAlert, "alice@example.com") {
+		t.Error("first capped email suppressed after exempt ones")
+	}
+	if c.Allow(EmailLoginAlert, "alice@example.com") {
+		t.Error("second capped email allowed with a limit of 1")
+	}
+}
+
+func TestRecipientCapFailsOpen(t *testing.T) {
+	mr, c := newTestCap(t, 1)
+	mr.Close()
+
+	for range 2 {
+		if !c.Allow(EmailLoginAlert, "alice@example.com") {
+			t.Fatal("email suppressed while Redis is down")
+		}
+	}
+}
+
+func TestCappedEmailIsNotSent(t *testing.T) {
+	s := newStubSMTP(t, false)
+	m := newTestMailer(t, s)
+	_, m.Cap = newTestCap(t, 2, EmailVerification, EmailPasswordReset)
+
+	purgeAt := time.Now().Add(30 * 24 * time.Hour)
+	for range 3 {
+		if err := m.SendAccountDeletionEmail("alice@example.com", "alice", purgeAt); err != nil {
+			t.Fatalf("a capped email is dropped, not failed: %v", err)
+		}
+	}
+	if got := len(s.sent()); got != 2 {
+		t.Errorf("delivered %d emails, want the cap of 2", got)
+	}
+
+	if err := m.SendPasswordResetEmail("alice@example.com", "alice", "abc123", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.sent()); got != 3 {
+		t.Errorf("exempt password reset not delivered over the cap (%d sent)", got)
+	}
+}
+
+func TestParseEmailTypes(t *testing.T) {
+	types, err := ParseEmailTypes([]string{"verification", "password_reset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 2 || types[0] != EmailVerification || types[1] != EmailPasswordReset {
+		t.Errorf("types = %v", types)
+	}
+
+	for _, bad := range []string{"reset", "Verification", ""} {
+		if _, err := ParseEmailTypes([]string{bad}); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
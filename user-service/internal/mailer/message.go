@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// EmailType selects the sender identity an email goes out with.
+type EmailType string
+
+const (
+	EmailVerification  EmailType = "verification"
+	EmailPasswordReset EmailType = "password_reset"
+	EmailLoginAlert    EmailType = "login_alert"
+	EmailAccount       EmailType = "account"
+	EmailSupport       EmailType = "support"
+	EmailOnboarding    EmailType = "onboarding"
+)
+
+var emailTypes = []EmailType{
+	EmailVerification, EmailPasswordReset, EmailLoginAlert,
+	EmailAccount, EmailSupport, EmailOnboarding,
+}
+
+// ParseEmailTypes converts names such as "password_reset" to email types,
+// rejecting any that isn't one.
+func ParseEmailTypes(names []string) ([]EmailType, error) {
+	types := make([]EmailType, 0, len(names))
+	for _, name := range names {
+		t := EmailType(name)
+		if !slices.Contains(emailTypes, t) {
+			return nil, fmt.Errorf("unknown email type %q", name)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// Sender is the From and optional Reply-To of an email.
+type Sender struct {
+	From    *mail.Address
+	ReplyTo *mail.Address
+}
+
+// ParseSender parses RFC 5322 addresses such as "Apex <noreply@apex.dev>".
+// Empty strings leave the corresponding field nil.
+func ParseSender(from, replyTo string) (Sender, error) {
+	var sender Sender
+	var err error
+
+	if from != "" {
+		if sender.From, err = mail.ParseAddress(from); err != nil {
+			return Sender{}, fmt.Errorf("invalid from address %q: %w", from, err)
+		}
+	}
+	if replyTo != "" {
+		if sender.ReplyTo, err = mail.ParseAddress(replyTo); err != nil {
+			return Sender{}, fmt.Errorf("invalid reply-to address %q: %w", replyTo, err)
+		}
+	}
+
+	return sender, nil
+}
+
+// ParseBaseURL checks that raw is an absolute http(s) URL that links can be
+// built on, and returns it without a trailing slash. Anything else renders
+// as an unusable link, since html/template rewrites hrefs without a known
+// scheme.
+func ParseBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute http(s) URL", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("%q must not have a query or fragment", raw)
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// senderFor returns the sender configured for t, filling whatever it leaves
+// unset from the default sender.
+func (m *SMTPMailer) senderFor(t EmailType) Sender {
+	sender := m.Senders[t]
+	if sender.From == nil {
+		sender.From = m.From.From
+	}
+	if sender.From == nil {
+		sender.From = &mail.Address{Address: m.User}
+	}
+	if sender.ReplyTo == nil {
+		sender.ReplyTo = m.From.ReplyTo
+	}
+	return sender
+}
+
+// buildMessage assembles an HTML email. mail.Address and mime encode display
+// names and the subject, so non-ASCII text survives transport.
+func buildMessage(sender Sender, to, subject, htmlBody string) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", sender.From.String())
+	if sender.ReplyTo != nil {
+		fmt.Fprintf(&b, "Reply-To: %s\r\n", sender.ReplyTo.String())
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", (&mail.Address{Address: to}).String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(htmlBody)
+
+	return []byte(b.String())
+}
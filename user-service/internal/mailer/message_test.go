@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendersPerEmailType(t *testing.T) {
+	s := newStubSMTP(t, false)
+	m := newTestMailer(t, s)
+
+	var err error
+	if m.From, err = ParseSender("Apex <noreply@example.com>", ""); err != nil {
+		t.Fatal(err)
+	}
+	support, err := ParseSender("Apex Поддержка <support@example.com>", "help@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Senders = map[EmailType]Sender{EmailSupport: support}
+
+	if err := m.SendVerificationEmail("alice@example.com", "alice", "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.deliver(EmailSupport, "alice@example.com", "Re: your ticket", "<p>Hi</p>"); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := s.sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d emails, want 2", len(sent))
+	}
+
+	tests := []struct {
+		name, from, fromName, replyTo string
+	}{
+		{"verification", "noreply@example.com", "Apex", ""},
+		{"support", "support@example.com", "Apex Поддержка", "<help@example.com>"},
+	}
+	for i, tt := range tests {
+		msg, err := mail.ReadMessage(strings.NewReader(sent[i]))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		from, err := msg.Header.AddressList("From")
+		if err != nil || len(from) != 1 || from[0].Address != tt.from || from[0].Name != tt.fromName {
+			t.Errorf("%s: From = %v (%v), want %s <%s>", tt.name, from, err, tt.fromName, tt.from)
+		}
+		if got := msg.Header.Get("Reply-To"); got != tt.replyTo {
+			t.Errorf("%s: Reply-To = %q, want %q", tt.name, got, tt.replyTo)
+		}
+	}
+
+	// The encoded display name keeps the header ASCII.
+	if header, _, _ := strings.Cut(sent[1], "\r\n\r\n"); strings.ContainsFunc(header, func(r rune) bool { return r > 127 }) {
+		t.Errorf("support headers aren't ASCII:\n%s", header)
+	}
+}
+
+func TestSenderFallsBackToUser(t *testing.T) {
+	s := newStubSMTP(t, false)
+	m := newTestMailer(t, s)
+
+	if err := m.SendPasswordResetEmail("alice@example.com", "alice", "abc123", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(s.sent()[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("From"); got != "<noreply@example.com>" {
+		t.Errorf("From = %q, want the SMTP user", got)
+	}
+}
@@ -4,19 +4,52 @@ import (
 	"bytes"
 	"html/template"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
+// TemplateRender parses each template once and reuses it afterwards.
 type TemplateRender struct {
 	BaseDir string
+
+	cache sync.Map // name -> *template.Template
 }
 
 func NewTemplateRender(baseDir string) *TemplateRender {
 	return &TemplateRender{BaseDir: baseDir}
 }
 
+// Preload parses every template in BaseDir up front, so the first email
+// doesn't pay for parsing and a broken template fails at startup.
+func (t *TemplateRender) Preload() (int, error) {
+	paths, err := filepath.Glob(filepath.Join(t.BaseDir, "*.html"))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, path := range paths {
+		if _, err := t.template(filepath.Base(path)); err != nil {
+			return 0, err
+		}
+	}
+	return len(paths), nil
+}
+
+func (t *TemplateRender) template(name string) (*template.Template, error) {
+	if tmpl, ok := t.cache.Load(name); ok {
+		return tmpl.(*template.Template), nil
+	}
+
+	tmpl, err := template.ParseFiles(filepath.Join(t.BaseDir, name))
+	if err != nil {
+		return nil, err
+	}
+	t.cache.Store(name, tmpl)
+	return tmpl, nil
+}
+
 func (t *TemplateRender) RenderTemplate(name string, data interface{}) (string, error) {
-	path := filepath.Join(t.BaseDir, name)
-	tmpl, err := template.ParseFiles(path)
+	tmpl, err := t.template(name)
 	if err != nil {
 		return "", err
 	}
@@ -28,3 +61,19 @@ func (t *TemplateRender) RenderTemplate(name string, data interface{}) (string,
 
 	return buf.String(), nil
 }
+
+// RenderBlock executes the template block defined inside template name,
+// e.g. a {{define "subject"}} that travels with the email body.
+func (t *TemplateRender) RenderBlock(name, block string, data interface{}) (string, error) {
+	tmpl, err := t.template(name)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, block, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
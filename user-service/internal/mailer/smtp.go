@@ -1,10 +1,27 @@
 package mailer
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/smtp"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
+)
+
+const (
+	defaultDialTimeout = 10 * time.Second
+	defaultSendTimeout = 30 * time.Second
+)
+
+var (
+	ErrSMTPTimeout    = errors.New("smtp server did not respond in time")
+	ErrInvalidAddress = errors.New("smtp: address must not contain CR or LF")
 )
 
 type SMTPMailer struct {
@@ -12,17 +29,46 @@ type SMTPMailer struct {
 	Port    int
 	User    string
 	Pass    string
-	From    string
 	BaseURL string
 	Render  *TemplateRender
+
+	// From is the default sender; Senders overrides it per email type.
+	From    Sender
+	Senders map[EmailType]Sender
+
+	// DialTimeout bounds the TCP connect, SendTimeout the whole SMTP
+	// conversation. Zero means the package defaults.
+	DialTimeout time.Duration
+	SendTimeout time.Duration
+
+	// TLSConfig is used for STARTTLS; ServerName is filled in from Host.
+	TLSConfig *tls.Config
+
+	// Cap limits how many emails one recipient gets per day; nil means no
+	// limit.
+	Cap *RecipientCap
+
+	// Preferences, if set, is checked before sending optional emails;
+	// Unsubscribe signs the opt-out links placed in them.
+	Preferences Preferences
+	Unsubscribe *UnsubscribeSigner
 }
 
-func (m *SMTPMailer) SendVerificationEmail(to, username, token string) error {
-	auth := smtp.PlainAuth("", m.User, m.Pass, m.Host)
-	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+// deliver sends an email of type t unless the recipient has reached their
+// daily cap, in which case it is dropped and nil is returned: callers
+// shouldn't fail a registration or reset because an inbox is being
+// flooded.
+func (m *SMTPMailer) deliver(t EmailType, to, subject, htmlBody string) error {
+	if m.Cap != nil && !m.Cap.Allow(t, to) {
+		metrics.EmailsSuppressed.WithLabelValues(string(t)).Inc()
+		log.Printf("dropping %s email: daily cap reached for recipient", t)
+		return nil
+	}
 
-	log.Println("helloworld")
+	return m.send(to, buildMessage(m.senderFor(t), to, subject, htmlBody))
+}
 
+func (m *SMTPMailer) SendVerificationEmail(to, username, token string) error {
 	link := fmt.Sprintf("%s/verify-email?token=%s", m.BaseURL, token)
 
 	data := map[string]any{
@@ -37,12 +83,219 @@ func (m *SMTPMailer) SendVerificationEmail(to, username, token string) error {
 	}
 
 	subject := "Verify your email address"
-	msg := fmt.Sprintf("Subject: %s\n"+
-		"MIME-version: 1.0;\n"+
-		"Content-Type: text/html; charset=\"UTF-8\";\n%s",
-		subject, htmlBody)
 
-	log.Println("helloworld")
+	return m.deliver(EmailVerification, to, subject, htmlBody)
+}
+
+func (m *SMTPMailer) SendAccountDeletionEmail(to, username string, purgeAt time.Time) error {
+	return m.sendAccountDeletion(to, username, purgeAt, false, "Your account is scheduled for deletion")
+}
+
+func (m *SMTPMailer) SendAccountDeletionReminderEmail(to, username string, purgeAt time.Time) error {
+	return m.sendAccountDeletion(to, username, purgeAt, true, "Your account will be deleted soon")
+}
+
+func (m *SMTPMailer) sendAccountDeletion(to, username string, purgeAt time.Time, reminder bool, subject string) error {
+	data := map[string]any{
+		"Username": username,
+		"PurgeAt":  purgeAt.UTC().Format("January 2, 2006"),
+		"Reminder": reminder,
+		"Year":     time.Now().Year(),
+	}
 
-	return smtp.SendMail(addr, auth, m.User, []string{to}, []byte(msg))
+	htmlBody, err := m.Render.RenderTemplate("account_deletion.html", data)
+	if err != nil {
+		return err
+	}
+
+	return m.deliver(EmailAccount, to, subject, htmlBody)
+}
+
+func (m *SMTPMailer) SendLoginAlertEmail(userID int64, to, username, device, ipAddress string, at time.Time) error {
+	data := map[string]any{
+		"Username":  username,
+		"Device":    device,
+		"IPAddress": ipAddress,
+		"Time":      at.UTC().Format(time.RFC1123),
+		"Year":      time.Now().Year(),
+
+		"UnsubscribeURL": m.unsubscribeURL(userID),
+	}
+
+	htmlBody, err := m.Render.RenderTemplate("new_login.html", data)
+	if err != nil {
+		return err
+	}
+
+	return m.deliverOptional(EmailLoginAlert, userID, to, "New sign-in to your account", htmlBody)
+}
+
+func (m *SMTPMailer) SendPasswordResetEmail(to, username, token string, ttl time.Duration) error {
+	link := fmt.Sprintf("%s/reset-password?token=%s", m.BaseURL, token)
+
+	data := map[string]any{
+		"Username":  username,
+		"ResetURL":  link,
+		"ExpiresIn": ttl.String(),
+		"Year":      time.Now().Year(),
+	}
+
+	htmlBody, err := m.Render.RenderTemplate("reset_password.html", data)
+	if err != nil {
+		return err
+	}
+
+	return m.deliver(EmailPasswordReset, to, "Reset your password", htmlBody)
+}
+
+func (m *SMTPMailer) SendPasswordResetCodeEmail(to, username, code string, ttl time.Duration) error {
+	data := map[string]any{
+		"Username":  username,
+		"Code":      code,
+		"ExpiresIn": ttl.String(),
+		"Year":      time.Now().Year(),
+	}
+
+	htmlBody, err := m.Render.RenderTemplate("reset_password.html", data)
+	if err != nil {
+		return err
+	}
+
+	return m.deliver(EmailPasswordReset, to, "Your password reset code", htmlBody)
+}
+
+// SendOnboardingEmail sends the onboarding email for step, rendered from
+// onboarding_<step>.html. The template defines its own "subject" block.
+func (m *SMTPMailer) SendOnboardingEmail(userID int64, to, username, step string) error {
+	name := onboardingTemplate(step)
+	data := map[string]any{
+		"Username": username,
+		"BaseURL":  m.BaseURL,
+		"Year":     time.Now().Year(),
+
+		"UnsubscribeURL": m.unsubscribeURL(userID),
+	}
+
+	subject, err := m.Render.RenderBlock(name, "subject", data)
+	if err != nil {
+		return err
+	}
+	htmlBody, err := m.Render.RenderTemplate(name, data)
+	if err != nil {
+		return err
+	}
+
+	return m.deliverOptional(EmailOnboarding, userID, to, subject, htmlBody)
+}
+
+// CheckOnboardingTemplates makes sure every step has a template with a
+// "subject" block, so a typo in the sequence fails at startup instead of
+// on every onboarding run.
+func (m *SMTPMailer) CheckOnboardingTemplates(steps ...string) error {
+	for _, step := range steps {
+		name := onboardingTemplate(step)
+		tmpl, err := m.Render.template(name)
+		if err != nil {
+			return fmt.Errorf("onboarding step %s: %w", step, err)
+		}
+		if tmpl.Lookup("subject") == nil {
+			return fmt.Errorf("onboarding step %s: %s defines no subject block", step, name)
+		}
+	}
+	return nil
+}
+
+func onboardingTemplate(step string) string {
+	return "onboarding_" + step + ".html"
+}
+
+// send does what smtp.SendMail does, but with a dial timeout and a deadline
+// on the connection so a stalled server can't block the caller forever.
+func (m *SMTPMailer) send(to string, msg []byte) error {
+	// Like smtp.SendMail, refuse addresses that would inject SMTP commands
+	// before connecting at all.
+	for _, line := range []string{m.User, to} {
+		if strings.ContainsAny(line, "\r\n") {
+			return ErrInvalidAddress
+		}
+	}
+
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+
+	dialTimeout := m.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	sendTimeout := m.SendTimeout
+	if sendTimeout <= 0 {
+		sendTimeout = defaultSendTimeout
+	}
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return wrapTimeout(addr, err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(sendTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return wrapTimeout(addr, err)
+	}
+	defer client.Close()
+
+	if err := m.converse(client, to, msg); err != nil {
+		return wrapTimeout(addr, err)
+	}
+	return nil
+}
+
+func (m *SMTPMailer) converse(client *smtp.Client, to string, msg []byte) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := &tls.Config{}
+		if m.TLSConfig != nil {
+			tlsConfig = m.TLSConfig.Clone()
+		}
+		tlsConfig.ServerName = m.Host
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if ok, _ := client.Extension("AUTH"); ok {
+		if err := client.Auth(smtp.PlainAuth("", m.User, m.Pass, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.User); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func wrapTimeout(addr string, err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %s: %v", ErrSMTPTimeout, addr, err)
+	}
+	return err
 }
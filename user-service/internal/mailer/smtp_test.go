@@ -0,0 +1,224 @@
+package mailer
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubSMTP is a minimal SMTP server that accepts every message, or with
+// stall set, accepts connections and never answers.
+type stubSMTP struct {
+	ln    net.Listener
+	stall bool
+
+	mu       sync.Mutex
+	conns    int
+	messages []string
+}
+
+func newStubSMTP(t *testing.T, stall bool) *stubSMTP {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubSMTP{ln: ln, stall: stall}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *stubSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	if s.stall {
+		// Hold the connection open until the client gives up.
+		_, _ = conn.Read(make([]byte, 1))
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				msg.WriteString(line)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *stubSMTP) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+// newTestMailer returns a mailer delivering to s.
+func newTestMailer(t *testing.T, s *stubSMTP) *SMTPMailer {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, _ := strconv.Atoi(port)
+
+	return &SMTPMailer{
+		Host:    host,
+		Port:    portNum,
+		User:    "noreply@example.com",
+		BaseURL: "https://api.example.com",
+		Render:  NewTemplateRender("templates"),
+	}
+}
+
+func TestPasswordResetEmailLinksToBaseURL(t *testing.T) {
+	s := newStubSMTP(t, false)
+	m := newTestMailer(t, s)
+
+	if err := m.SendPasswordResetEmail("alice@example.com", "alice", "abc123", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := s.sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+	if !strings.Contains(sent[0], `href="https://api.example.com/reset-password?token=abc123"`) {
+		t.Fatalf("reset link missing from email:\n%s", sent[0])
+	}
+	if strings.Contains(sent[0], "ZgotmplZ") {
+		t.Fatal("template rejected the reset link")
+	}
+}
+
+func TestStalledServerTimesOut(t *testing.T) {
+	s := newStubSMTP(t, true)
+	m := newTestMailer(t, s)
+	m.SendTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	err := m.SendPasswordResetEmail("alice@example.com", "alice", "abc123", time.Hour)
+	if !errors.Is(err, ErrSMTPTimeout) {
+		t.Fatalf("send to a stalled server = %v, want ErrSMTPTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up after %s, want about the send timeout", elapsed)
+	}
+}
+
+func TestSendRejectsCRLFAddresses(t *testing.T) {
+	s := newStubSMTP(t, false)
+	m := newTestMailer(t, s)
+
+	injected := "alice@example.com\r\nRCPT TO:<victim@example.com>"
+	if err := m.SendPasswordResetEmail(injected, "alice", "abc123", time.Hour); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("recipient with CRLF: err = %v, want ErrInvalidAddress", err)
+	}
+
+	m.User = "noreply@example.com\nDATA"
+	if err := m.SendPasswordResetEmail("alice@example.com", "alice", "abc123", time.Hour); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("sender with LF: err = %v, want ErrInvalidAddress", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns != 0 {
+		t.Errorf("opened %d connections for invalid addresses, want none", s.conns)
+	}
+}
+
+func TestParseBaseURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "https://api.example.com", want: "https://api.example.com"},
+		{raw: "http://localhost:8080/", want: "http://localhost:8080"},
+		{raw: "https://example.com/auth/", want: "https://example.com/auth"},
+		{raw: "", wantErr: true},
+		{raw: "localhost:8080", wantErr: true},
+		{raw: "api.example.com", wantErr: true},
+		{raw: "javascript://x", wantErr: true},
+		{raw: "https://example.com/?a=b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBaseURL(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseBaseURL(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseBaseURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOnboardingTemplates(t *testing.T) {
+	m := &SMTPMailer{Render: NewTemplateRender("templates")}
+	if err := m.CheckOnboardingTemplates("welcome", "tips"); err != nil {
+		t.Errorf("shipped templates: %v", err)
+	}
+	if err := m.CheckOnboardingTemplates("welcome", "welcom"); err == nil {
+		t.Error("a missing template passed the check")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "onboarding_bare.html"), []byte("<p>Hi</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m = &SMTPMailer{Render: NewTemplateRender(dir)}
+	if err := m.CheckOnboardingTemplates("bare"); err == nil {
+		t.Error("a template without a subject block passed the check")
+	}
+}
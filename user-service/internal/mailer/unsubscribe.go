@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
+)
+
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// optionalEmails are the types a recipient can unsubscribe from. Everything
+// else concerns the security of their account and always goes out.
+var optionalEmails = []EmailType{EmailOnboarding, EmailLoginAlert}
+
+// Optional reports whether recipients can opt out of emails of type t.
+func (t EmailType) Optional() bool {
+	return slices.Contains(optionalEmails, t)
+}
+
+// Preferences tells the mailer whether a user opted out of optional emails.
+type Preferences interface {
+	EssentialEmailsOnly(ctx context.Context, userID int64) (bool, error)
+}
+
+// UnsubscribeSigner issues and checks the tokens in unsubscribe links. A
+// token is the user ID and an HMAC over it, so links work without signing
+// in and never expire.
+type UnsubscribeSigner struct {
+	key []byte
+}
+
+func NewUnsubscribeSigner(key []byte) *UnsubscribeSigner {
+	return &UnsubscribeSigner{key: key}
+}
+
+func (s *UnsubscribeSigner) Token(userID int64) string {
+	id := strconv.FormatInt(userID, 10)
+	return id + "." + base64.RawURLEncoding.EncodeToString(s.mac(id))
+}
+
+// Verify returns the user token was issued for.
+func (s *UnsubscribeSigner) Verify(token string) (int64, error) {
+	id, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidUnsubscribeToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(signature, s.mac(id)) {
+		return 0, ErrInvalidUnsubscribeToken
+	}
+
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || userID <= 0 {
+		return 0, ErrInvalidUnsubscribeToken
+	}
+	return userID, nil
+}
+
+func (s *UnsubscribeSigner) mac(id string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte("unsubscribe:" + id))
+	return h.Sum(nil)
+}
+
+// unsubscribeURL is the link placed in optional emails, or "" when no signer
+// is configured.
+func (m *SMTPMailer) unsubscribeURL(userID int64) string {
+	if m.Unsubscribe == nil {
+		return ""
+	}
+	return m.BaseURL + "/unsubscribe?token=" + url.QueryEscape(m.Unsubscribe.Token(userID))
+}
+
+// deliverOptional is deliver for emails userID can unsubscribe from. If the
+// preference can't be read the email is held back and the error returned,
+// so jobs retry instead of mailing someone who may have opted out.
+func (m *SMTPMailer) deliverOptional(t EmailType, userID int64, to, subject, htmlBody string) error {
+	if m.Preferences != nil && t.Optional() {
+		ctx, cancel := context.WithTimeout(context.Background(), capTimeout)
+		essentialOnly, err := m.Preferences.EssentialEmailsOnly(ctx, userID)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("reading email preferences: %w", err)
+		}
+		if essentialOnly {
+			metrics.EmailsOptedOut.WithLabelValues(string(t)).Inc()
+			return nil
+		}
+	}
+
+	return m.deliver(t, to, subject, htmlBody)
+}
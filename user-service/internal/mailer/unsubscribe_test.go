@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticPreferences reports the users in essentialOnly as unsubscribed.
+type staticPreferences map[int64]bool
+
+func (p staticPreferences) EssentialEmailsOnly(ctx context.Context, userID int64) (bool, error) {
+	return p[userID], nil
+}
+
+func TestUnsubscribeTokenRoundTrip(t *testing.T) {
+	signer := NewUnsubscribeSigner([]byte("secret"))
+
+	userID, err := signer.Verify(signer.Token(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != 42 {
+		t.Fatalf("got user %d, want 42", userID)
+	}
+}
+
+func TestUnsubscribeTokenRejectsTampering(t *testing.T) {
+	signer := NewUnsubscribeSigner([]byte("secret"))
+	token := signer.Token(42)
+	_, mac, _ := strings.Cut(token, ".")
+
+	for name, tampered := range map[string]string{
+		"other user":  "43." + mac,
+		"other key":   NewUnsubscribeSigner([]byte("other")).Token(42),
+		"no mac":      "42",
+		"bad base64":  "42.!!!",
+		"negative id": "-1." + mac,
+	} {
+		if _, err := signer.Verify(tampered); !errors.Is(err, ErrInvalidUnsubscribeToken) {
+			t.Errorf("%s: got %v, want ErrInvalidUnsubscribeToken", name, err)
+		}
+	}
+}
+
+func TestUnsubscribedUserStillGetsSecurityEmails(t *testing.T) {
+	s := newStubSMTP(t, false)
+	m := newTestMailer(t, s)
+	m.Preferences = staticPreferences{1: true}
+	m.Unsubscribe = NewUnsubscribeSigner([]byte("secret"))
+
+	if err := m.SendOnboardingEmail(1, "alice@example.com", "alice", "tips"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SendLoginAlertEmail(1, "alice@example.com", "alice", "Firefox", "127.0.0.1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SendPasswordResetEmail("alice@example.com", "alice", "abc123", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := s.sent()
+	if len(sent) != 1 || !strings.Contains(sent[0], "/reset-password?token=abc123") {
+		t.Fatalf("want only the reset email, got %d emails", len(sent))
+	}
+}
+
+func TestSubscribedUserGetsUnsubscribeLink(t *testing.T) {
+	s := newStubSMTP(t, false)
+	m := newTestMailer(t, s)
+	m.Preferences = staticPreferences{}
+	m.Unsubscribe = NewUnsubscribeSigner([]byte("secret"))
+
+	if err := m.SendOnboardingEmail(1, "alice@example.com", "alice", "tips"); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := s.sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+	want := `href="https://api.example.com/unsubscribe?token=` + m.Unsubscribe.Token(1) + `"`
+	if !strings.Contains(sent[0], want) {
+		t.Fatalf("unsubscribe link missing from email:\n%s", sent[0])
+	}
+}
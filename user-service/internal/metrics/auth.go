@@ -0,0 +1,72 @@
+// Package metrics holds domain counters for auth outcomes. They are kept
+// apart from any HTTP-level metrics so alerts keep working when handlers
+// are reshuffled.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	Registrations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_registrations_total",
+		Help: "Registration attempts by result.",
+	}, []string{"result"})
+
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+
+	Refreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_refreshes_total",
+		Help: "Refresh token exchanges by result.",
+	}, []string{"result"})
+
+	Logouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logouts_total",
+		Help: "Logouts by scope (single session or all sessions).",
+	}, []string{"scope"})
+
+	VerificationEmails = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_verification_emails_total",
+		Help: "Verification emails by send result.",
+	}, []string{"result"})
+
+	Verifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_email_verifications_total",
+		Help: "Email verification attempts by result.",
+	}, []string{"result"})
+
+	PasswordResets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_password_resets_total",
+		Help: "Password reset steps by stage and result.",
+	}, []string{"stage", "result"})
+
+	Revocations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_revocations_total",
+		Help: "Revoked sessions and tokens by reason.",
+	}, []string{"reason"})
+
+	// BlacklistErrors counts access token blacklist operations that failed
+	// because Redis was unreachable. A failed "check" was "allowed" or
+	// "rejected" by the configured policy; a failed "write" is "dropped",
+	// leaving the token usable until it expires.
+	BlacklistErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_blacklist_errors_total",
+		Help: "Failed access token blacklist operations by operation and outcome.",
+	}, []string{"operation", "outcome"})
+)
+
+// Result labels shared by the counters above.
+const (
+	ResultSuccess            = "success"
+	ResultFailure            = "failure"
+	ResultInvalidCredentials = "invalid_credentials"
+	ResultInvalid            = "invalid"
+	ResultExpired            = "expired"
+	ResultBusy               = "busy"
+	ResultRace               = "race"
+	ResultReuse              = "reuse"
+)
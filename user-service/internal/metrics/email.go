@@ -0,0 +1,16 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var EmailsSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "emails_suppressed_total",
+	Help: "Emails dropped because the recipient reached the daily cap, by email type.",
+}, []string{"type"})
+
+var EmailsOptedOut = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "emails_opted_out_total",
+	Help: "Non-essential emails not sent because the recipient unsubscribed, by email type.",
+}, []string{"type"})
@@ -1,7 +1,15 @@
 package middleware
 
 import (
+	"errors"
+	"log"
+	"slices"
+
 	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
 	"net/http"
 	"strings"
@@ -11,73 +19,165 @@ import (
 
 const (
 	authorizationHeader = "Authorization"
-	userIDKey           = "user_id"
-	usernameKey         = "username"
-	emailKey            = "email"
 )
 
-func AuthMiddleware(tokenManager *jwt.TokenManager, redisClient *redis.Client) gin.HandlerFunc {
+var (
+	ErrMissingAuthHeader = errors.New("authorization header required")
+	ErrInvalidAuthHeader = errors.New("invalid authorization header format")
+)
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>"
+// header without validating it.
+func BearerToken(c *gin.Context) (string, error) {
+	authHeader := c.GetHeader(authorizationHeader)
+	if authHeader == "" {
+		return "", ErrMissingAuthHeader
+	}
+
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+		return "", ErrInvalidAuthHeader
+	}
+
+	return parts[1], nil
+}
+
+// Blacklist policies for when Redis can't be reached to check whether an
+// access token was revoked.
+const (
+	// BlacklistFailOpen accepts the token, risking that a logged-out token
+	// keeps working during the outage.
+	BlacklistFailOpen = "open"
+	// BlacklistFailClosed rejects the request with 503.
+	BlacklistFailClosed = "closed"
+)
+
+// AuthMiddleware accepts either a JWT access token or a personal access
+// token in the Authorization header. failurePolicy decides what happens to
+// JWTs when the blacklist can't be checked.
+func AuthMiddleware(tokenManager *jwt.TokenManager, redisClient *redis.Client, apiTokens *service.APITokenService, failurePolicy string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader(authorizationHeader)
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
+		token, err := BearerToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
-			c.Abort()
+		ctx := c.Request.Context()
+
+		if service.IsAPIToken(token) {
+			authenticateAPIToken(c, apiTokens, token)
 			return
 		}
 
-		token := parts[1]
-
-		ctx := c.Request.Context()
-
 		exists, err := redisClient.Exists(ctx, "revoked:"+token).Result()
-		if err == nil && exists > 0 {
+		if err != nil {
+			log.Printf("token blacklist unavailable, failing %s: %v", failurePolicy, err)
+			if failurePolicy == BlacklistFailClosed {
+				metrics.BlacklistErrors.WithLabelValues("check", "rejected").Inc()
+				c.Header("Retry-After", "1")
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "unable to verify token"})
+				c.Abort()
+				return
+			}
+			metrics.BlacklistErrors.WithLabelValues("check", "allowed").Inc()
+		} else if exists > 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
 			c.Abort()
 			return
 		}
 
-		claims, err := tokenManager.ValidateToken(token)
+		claims, err := tokenManager.ValidateAccessToken(token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		c.Set(userIDKey, claims.UserId)
-		c.Set(usernameKey, claims.Username)
-		c.Set(emailKey, claims.Email)
+		c.Set(ctxkey.UserID, claims.UserId)
+		c.Set(ctxkey.Username, claims.Username)
+		c.Set(ctxkey.Email, claims.Email)
+		if claims.Entitlements != nil {
+			c.Set(ctxkey.Entitlements, claims.Entitlements)
+		}
+		if claims.EmailVerified {
+			c.Set(ctxkey.EmailVerified, true)
+		}
 
 		c.Next()
 	}
 }
 
-func GetUserID(c *gin.Context) int64 {
-	userID, exists := c.Get(userIDKey)
-	if !exists {
-		return 0
+func authenticateAPIToken(c *gin.Context, apiTokens *service.APITokenService, token string) {
+	apiToken, err := apiTokens.Authenticate(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to authenticate token"})
+		}
+		c.Abort()
+		return
 	}
-	return userID.(int64)
+
+	// Read-only tokens may only call safe methods.
+	if !slices.Contains(apiToken.Scopes, models.ScopeWrite) && !isSafeMethod(c.Request.Method) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient token scope"})
+		c.Abort()
+		return
+	}
+
+	// Even a GET would write last_used_at; in read-only mode it's skipped.
+	if !ctxkey.Get[bool](c, ctxkey.ReadOnly) {
+		apiTokens.TouchLastUsed(c.Request.Context(), apiToken.ID)
+	}
+
+	c.Set(ctxkey.UserID, apiToken.UserID)
+	c.Set(ctxkey.APITokenScopes, apiToken.Scopes)
+
+	c.Next()
 }
 
-func GetUsername(c *gin.Context) string {
-	username, exists := c.Get(usernameKey)
-	if !exists {
-		return ""
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// RequireSession rejects requests authenticated with a personal access
+// token. It guards routes that manage sessions, tokens and credentials, so a
+// leaked token can't mint more tokens, sign the user out or take over the
+// account, whatever its scopes.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetAPITokenScopes(c) != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "personal access tokens can't be used here"})
+			c.Abort()
+			return
+		}
+		c.Next()
 	}
-	return username.(string)
+}
+
+// GetAPITokenScopes returns the scopes of the personal access token that
+// authenticated the request, or nil if a JWT was used.
+func GetAPITokenScopes(c *gin.Context) []string {
+	return ctxkey.Get[[]string](c, ctxkey.APITokenScopes)
+}
+
+func GetUserID(c *gin.Context) int64 {
+	return ctxkey.Get[int64](c, ctxkey.UserID)
+}
+
+func GetUsername(c *gin.Context) string {
+	return ctxkey.Get[string](c, ctxkey.Username)
 }
 
 func GetEmail(c *gin.Context) string {
-	email, exists := c.Get(emailKey)
-	if !exists {
-		return ""
-	}
-	return email.(string)
+	return ctxkey.Get[string](c, ctxkey.Email)
+}
+
+// GetEntitlements returns the entitlements carried by the access token, or
+// nil for tokens issued before they were introduced.
+func GetEntitlements(c *gin.Context) *jwt.Entitlements {
+	return ctxkey.Get[*jwt.Entitlements](c, ctxkey.Entitlements)
 }
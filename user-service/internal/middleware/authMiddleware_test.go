@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/service"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+type patEnv struct {
+	router   *gin.Engine
+	db       *pgxpool.Pool
+	readOnly *ReadOnly
+	tokens   *service.APITokenService
+	jwt      *jwt.TokenManager
+	userID   int64
+	exec     func(sql string, args ...any)
+}
+
+func newPATEnv(t *testing.T) *patEnv {
+	t.Helper()
+
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	var userID int64
+	err := db.QueryRow(ctx, `
+		INSERT INTO users (username, email, password_hash)
+		VALUES ('alice', 'alice@example.com', 'x')
+		RETURNING id
+	`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	env := &patEnv{
+		db:       db,
+		readOnly: NewReadOnly(redisClient, false),
+		tokens:   service.NewAPITokenService(repository.NewAPITokenRepository(db)),
+		jwt:      jwt.NewTokenManager("test-secret", 0),
+		userID:   userID,
+		exec: func(sql string, args ...any) {
+			if _, err := db.Exec(ctx, sql, args...); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"user_id": GetUserID(c)}) }
+	env.router = gin.New()
+	env.router.Use(env.readOnly.Middleware())
+	protected := env.router.Group("", AuthMiddleware(env.jwt, redisClient, env.tokens, BlacklistFailOpen))
+	protected.GET("/users/me", ok)
+	protected.PUT("/users/me", ok)
+	protected.POST("/auth/tokens", RequireSession(), ok)
+	protected.POST("/users/me/password", RequireSession(), ok)
+
+	return env
+}
+
+func (e *patEnv) createToken(t *testing.T, scopes ...string) (*models.APIToken, string) {
+	t.Helper()
+
+	token, plaintext, err := e.tokens.Create(context.Background(), e.userID, "ci", scopes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, plaintext
+}
+
+func (e *patEnv) do(method, path, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPITokenAuthentication(t *testing.T) {
+	e := newPATEnv(t)
+	_, readToken := e.createToken(t, models.ScopeRead)
+	_, writeToken := e.createToken(t, models.ScopeRead, models.ScopeWrite)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"read token reads", http.MethodGet, "/users/me", readToken, http.StatusOK},
+		{"read token can't write", http.MethodPut, "/users/me", readToken, http.StatusForbidden},
+		{"write token writes", http.MethodPut, "/users/me", writeToken, http.StatusOK},
+		{"write token can't mint tokens", http.MethodPost, "/auth/tokens", writeToken, http.StatusForbidden},
+		{"write token can't change password", http.MethodPost, "/users/me/password", writeToken, http.StatusForbidden},
+		{"wrong secret", http.MethodGet, "/users/me", readToken + "x", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.do(tt.method, tt.path, tt.token); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPITokenExpiry(t *testing.T) {
+	e := newPATEnv(t)
+	token, plaintext := e.createToken(t, models.ScopeRead)
+
+	e.exec(`UPDATE api_tokens SET expires_at = $1 WHERE id = $2`, time.Now().Add(-time.Minute), token.ID)
+
+	if got := e.do(http.MethodGet, "/users/me", plaintext); got != http.StatusUnauthorized {
+		t.Fatalf("expired token: got %d, want 401", got)
+	}
+}
+
+func TestAPITokenRevocation(t *testing.T) {
+	e := newPATEnv(t)
+	token, plaintext := e.createToken(t, models.ScopeRead)
+
+	if got := e.do(http.MethodGet, "/users/me", plaintext); got != http.StatusOK {
+		t.Fatalf("before revocation: got %d, want 200", got)
+	}
+	if err := e.tokens.Revoke(context.Background(), e.userID, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.do(http.MethodGet, "/users/me", plaintext); got != http.StatusUnauthorized {
+		t.Fatalf("revoked token: got %d, want 401", got)
+	}
+}
+
+func TestRequireSessionAllowsJWT(t *testing.T) {
+	e := newPATEnv(t)
+
+	accessToken, _, err := e.jwt.GenerateAccessToken(e.userID, "alice", "alice@example.com", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.do(http.MethodPost, "/auth/tokens", accessToken); got != http.StatusOK {
+		t.Fatalf("got %d, want 200", got)
+	}
+}
+
+func TestAPITokenUseNotRecordedWhileReadOnly(t *testing.T) {
+	e := newPATEnv(t)
+	token, plaintext := e.createToken(t, models.ScopeRead, models.ScopeWrite)
+	ctx := context.Background()
+
+	lastUsed := func() *time.Time {
+		t.Helper()
+		var at *time.Time
+		if err := e.db.QueryRow(ctx, `SELECT last_used_at FROM api_tokens WHERE id = $1`, token.ID).Scan(&at); err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+
+	if err := e.readOnly.SetEnabled(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.do(http.MethodGet, "/users/me", plaintext); got != http.StatusOK {
+		t.Fatalf("GET while read-only: got %d, want 200", got)
+	}
+	if got := e.do(http.MethodPut, "/users/me", plaintext); got != http.StatusServiceUnavailable {
+		t.Fatalf("PUT while read-only: got %d, want 503", got)
+	}
+	if at := lastUsed(); at != nil {
+		t.Errorf("last_used_at written while read-only: %s", at)
+	}
+
+	if err := e.readOnly.SetEnabled(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	e.do(http.MethodGet, "/users/me", plaintext)
+	if lastUsed() == nil {
+		t.Error("last_used_at not recorded once writable again")
+	}
+}
+
+func TestAuthMiddlewareExposesEntitlements(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	tm := jwt.NewTokenManager("test-secret", 0)
+
+	var got *jwt.Entitlements
+	router := gin.New()
+	router.GET("/me", AuthMiddleware(tm, redisClient, nil, BlacklistFailOpen), func(c *gin.Context) {
+		got = GetEntitlements(c)
+	})
+
+	token, _, err := tm.GenerateAccessToken(1, "alice", "alice@example.com", true, &jwt.Entitlements{Plan: "pro", MaxDocuments: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got == nil || got.Plan != "pro" || got.MaxDocuments != 1000 {
+		t.Errorf("entitlements in context = %+v, want the token's", got)
+	}
+}
+
+func TestContextGetters(t *testing.T) {
+	c := &gin.Context{}
+	if GetUserID(c) != 0 || GetUsername(c) != "" || GetEntitlements(c) != nil || GetAPITokenScopes(c) != nil {
+		t.Fatal("getters on an empty context aren't zero")
+	}
+
+	ent := &jwt.Entitlements{Plan: "pro"}
+	c.Set(ctxkey.UserID, int64(42))
+	c.Set(ctxkey.Username, "alice")
+	c.Set(ctxkey.Email, "alice@example.com")
+	c.Set(ctxkey.Entitlements, ent)
+	c.Set(ctxkey.APITokenScopes, []string{models.ScopeRead})
+	c.Set(ctxkey.Service, "editor")
+
+	if got := GetUserID(c); got != 42 {
+		t.Errorf("GetUserID = %d", got)
+	}
+	if got := GetUsername(c); got != "alice" {
+		t.Errorf("GetUsername = %q", got)
+	}
+	if got := GetEmail(c); got != "alice@example.com" {
+		t.Errorf("GetEmail = %q", got)
+	}
+	if got := GetEntitlements(c); got != ent {
+		t.Errorf("GetEntitlements = %+v", got)
+	}
+	if got := GetAPITokenScopes(c); len(got) != 1 || got[0] != models.ScopeRead {
+		t.Errorf("GetAPITokenScopes = %v", got)
+	}
+	if got := GetService(c); got != "editor" {
+		t.Errorf("GetService = %q", got)
+	}
+}
+
+func TestBlacklistFailurePolicy(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { redisClient.Close() })
+	tm := jwt.NewTokenManager("test-secret", 0)
+
+	token, _, err := tm.GenerateAccessToken(1, "alice", "alice@example.com", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(policy string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/me", AuthMiddleware(tm, redisClient, nil, policy), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// With Redis up, a revoked token is rejected under either policy.
+	mr.Set("revoked:"+token, "1")
+	for _, policy := range []string{BlacklistFailOpen, BlacklistFailClosed} {
+		if w := call(policy); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s, revoked: status = %d, want 401", policy, w.Code)
+		}
+	}
+
+	mr.SetError("connection lost")
+	defer mr.SetError("")
+
+	tests := []struct {
+		policy, outcome string
+		want            int
+	}{
+		{BlacklistFailOpen, "allowed", http.StatusOK},
+		{BlacklistFailClosed, "rejected", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		counter := metrics.BlacklistErrors.WithLabelValues("check", tt.outcome)
+		before := testutil.ToFloat64(counter)
+
+		w := call(tt.policy)
+		if w.Code != tt.want {
+			t.Errorf("%s during an outage: status = %d, want %d", tt.policy, w.Code, tt.want)
+		}
+		if tt.policy == BlacklistFailClosed && w.Header().Get("Retry-After") == "" {
+			t.Error("fail-closed 503 has no Retry-After")
+		}
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("%s: %s blacklist errors counted %v times, want 1", tt.policy, tt.outcome, got)
+		}
+	}
+}
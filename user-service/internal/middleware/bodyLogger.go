@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/redact"
+)
+
+const (
+	debugHeader     = "X-Debug"
+	maxCapturedBody = 64 << 10
+)
+
+// BodyLogger logs redacted request and response bodies for a sample of
+// traffic, and for requests sending "X-Debug: true" from an allowlisted IP.
+// The sample rate can be changed at runtime.
+type BodyLogger struct {
+	sampleRate atomic.Uint64
+	allowedIPs []string
+}
+
+func NewBodyLogger(sampleRate float64, allowedIPs []string) *BodyLogger {
+	b := &BodyLogger{allowedIPs: allowedIPs}
+	b.SetSampleRate(sampleRate)
+	return b
+}
+
+// SetSampleRate sets the fraction of requests captured, clamped to [0, 1].
+func (b *BodyLogger) SetSampleRate(rate float64) {
+	b.sampleRate.Store(math.Float64bits(min(max(rate, 0), 1)))
+}
+
+func (b *BodyLogger) SampleRate() float64 {
+	return math.Float64frombits(b.sampleRate.Load())
+}
+
+func (b *BodyLogger) shouldCapture(c *gin.Context) bool {
+	if c.GetHeader(debugHeader) == "true" && slices.Contains(b.allowedIPs, c.ClientIP()) {
+		return true
+	}
+	rate := b.SampleRate()
+	return rate > 0 && rand.Float64() < rate
+}
+
+func (b *BodyLogger) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !b.shouldCapture(c) {
+			c.Next()
+			return
+		}
+
+		var reqBody []byte
+		if c.Request.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, maxCapturedBody))
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), c.Request.Body))
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		log.Printf("debug body capture: %s %s -> %d request=%s response=%s",
+			c.Request.Method, c.Request.URL.Path, writer.Status(),
+			redact.JSON(reqBody), redact.JSON(writer.body.Bytes()))
+	}
+}
+
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	if room := maxCapturedBody - w.body.Len(); room > 0 {
+		w.body.Write(data[:min(len(data), room)])
+	}
+	return w.ResponseWriter.Write(data)
+}
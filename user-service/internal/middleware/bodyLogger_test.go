@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureLog sends the standard logger to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func newBodyLoggerRouter(t *testing.T, b *BodyLogger, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	r := gin.New()
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(b.Middleware())
+	r.POST("/login", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"access_token": "eyJ.secret", "username": "alice"})
+	})
+	return r
+}
+
+func postLogin(r http.Handler, remoteAddr string, header http.Header) {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"alice","password":"hunter2"}`))
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	r.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestBodyLoggerSampleRate(t *testing.T) {
+	tests := []struct {
+		rate    float64
+		want    float64
+		capture bool
+	}{
+		{rate: 0, want: 0, capture: false},
+		{rate: -0.5, want: 0, capture: false},
+		{rate: 1, want: 1, capture: true},
+		{rate: 3, want: 1, capture: true},
+	}
+	for _, tt := range tests {
+		b := NewBodyLogger(tt.rate, nil)
+		if got := b.SampleRate(); got != tt.want {
+			t.Errorf("SampleRate() after %v = %v, want %v", tt.rate, got, tt.want)
+		}
+
+		logs := captureLog(t)
+		r := newBodyLoggerRouter(t, b, nil)
+		for range 20 {
+			postLogin(r, "203.0.113.5:1234", nil)
+		}
+		captured := strings.Count(logs.String(), "debug body capture")
+		if tt.capture && captured != 20 {
+			t.Errorf("rate %v: captured %d of 20 requests, want all", tt.rate, captured)
+		}
+		if !tt.capture && captured != 0 {
+			t.Errorf("rate %v: captured %d of 20 requests, want none", tt.rate, captured)
+		}
+	}
+}
+
+func TestBodyLoggerRedactsSecrets(t *testing.T) {
+	logs := captureLog(t)
+	postLogin(newBodyLoggerRouter(t, NewBodyLogger(1, nil), nil), "203.0.113.5:1234", nil)
+
+	out := logs.String()
+	if !strings.Contains(out, `"username":"alice"`) {
+		t.Errorf("capture missing ordinary fields: %s", out)
+	}
+	for _, secret := range []string{"hunter2", "eyJ.secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("capture contains %q: %s", secret, out)
+		}
+	}
+}
+
+func TestBodyLoggerDebugHeader(t *testing.T) {
+	debug := http.Header{"X-Debug": {"true"}}
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		header         http.Header
+		trustedProxies []string
+		capture        bool
+	}{
+		{
+			name:       "allowlisted peer",
+			remoteAddr: "10.0.0.1:1234",
+			header:     debug,
+			capture:    true,
+		},
+		{
+			name:       "other peer",
+			remoteAddr: "203.0.113.5:1234",
+			header:     debug,
+			capture:    false,
+		},
+		{
+			name:       "spoofed forwarding header",
+			remoteAddr: "203.0.113.5:1234",
+			header:     http.Header{"X-Debug": {"true"}, "X-Forwarded-For": {"10.0.0.1"}},
+			capture:    false,
+		},
+		{
+			name:           "forwarded by trusted proxy",
+			remoteAddr:     "192.0.2.10:1234",
+			header:         http.Header{"X-Debug": {"true"}, "X-Forwarded-For": {"10.0.0.1"}},
+			trustedProxies: []string{"192.0.2.10"},
+			capture:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			r := newBodyLoggerRouter(t, NewBodyLogger(0, []string{"10.0.0.1"}), tt.trustedProxies)
+			postLogin(r, tt.remoteAddr, tt.header)
+
+			if got := strings.Contains(logs.String(), "debug body capture"); got != tt.capture {
+				t.Errorf("captured = %v, want %v", got, tt.capture)
+			}
+		})
+	}
+}
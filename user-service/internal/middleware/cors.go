@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+var ErrCORSCredentialsWildcard = errors.New("cors: credentials cannot be allowed with a wildcard origin")
+
+// CORSRule overrides the default CORS config for paths starting with
+// PathPrefix. It has to be applied at the router level, since preflight
+// requests never reach group middleware.
+type CORSRule struct {
+	PathPrefix string
+	Config     cors.Config
+}
+
+// CORS applies def, or the rule with the longest matching path prefix.
+func CORS(def cors.Config, rules ...CORSRule) (gin.HandlerFunc, error) {
+	if err := validateCORS(def); err != nil {
+		return nil, err
+	}
+	defHandler := cors.New(def)
+
+	rules = slices.Clone(rules)
+	slices.SortFunc(rules, func(a, b CORSRule) int {
+		return len(b.PathPrefix) - len(a.PathPrefix)
+	})
+
+	handlers := make([]gin.HandlerFunc, len(rules))
+	for i, rule := range rules {
+		if err := validateCORS(rule.Config); err != nil {
+			return nil, err
+		}
+		handlers[i] = cors.New(rule.Config)
+	}
+
+	return func(c *gin.Context) {
+		for i, rule := range rules {
+			if strings.HasPrefix(c.Request.URL.Path, rule.PathPrefix) {
+				handlers[i](c)
+				return
+			}
+		}
+		defHandler(c)
+	}, nil
+}
+
+func validateCORS(cfg cors.Config) error {
+	if cfg.AllowCredentials && (cfg.AllowAllOrigins || slices.Contains(cfg.AllowOrigins, "*")) {
+		return ErrCORSCredentialsWildcard
+	}
+	return cfg.Validate()
+}
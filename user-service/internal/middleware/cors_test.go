@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+func preflight(r http.Handler, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "X-Upload-Checksum")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSRuleOverridesDefault(t *testing.T) {
+	def := cors.Config{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:       12 * time.Hour,
+	}
+	upload := def
+	upload.AllowMethods = []string{"POST", "OPTIONS"}
+	upload.AllowHeaders = []string{"Content-Type", "Authorization", "X-Upload-Checksum"}
+	upload.MaxAge = time.Hour
+
+	mw, err := CORS(def, CORSRule{PathPrefix: "/api/v1/users/upload-avatar", Config: upload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(mw)
+
+	w := preflight(r, "/api/v1/users/upload-avatar")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("upload preflight: status = %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(strings.ToLower(got), "x-upload-checksum") {
+		t.Errorf("upload Allow-Headers = %q, want the upload header", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "3600" {
+		t.Errorf("upload Max-Age = %q, want 3600", got)
+	}
+
+	w = preflight(r, "/api/v1/users/me")
+	if got := w.Header().Get("Access-Control-Allow-Headers"); strings.Contains(strings.ToLower(got), "x-upload-checksum") {
+		t.Errorf("default Allow-Headers = %q, want no upload header", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "43200" {
+		t.Errorf("default Max-Age = %q, want 43200", got)
+	}
+}
+
+func TestCORSRejectsCredentialsWithWildcard(t *testing.T) {
+	wildcard := cors.Config{AllowOrigins: []string{"*"}, AllowCredentials: true}
+	if _, err := CORS(wildcard); !errors.Is(err, ErrCORSCredentialsWildcard) {
+		t.Errorf("default with credentials and *: %v", err)
+	}
+
+	def := cors.Config{AllowOrigins: []string{"https://app.example.com"}}
+	if _, err := CORS(def, CORSRule{PathPrefix: "/upload", Config: wildcard}); !errors.Is(err, ErrCORSCredentialsWildcard) {
+		t.Errorf("rule with credentials and *: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/gatewaysig"
+)
+
+// IdentityHeaderGuard protects against forged X-User-* headers, which only
+// the gateway may set. Duplicated identity headers are always rejected.
+// Otherwise they're kept only with a fresh, valid gateway signature; without
+// one they're stripped, or rejected when reject is set.
+func IdentityHeaderGuard(signingKey []byte, maxSkew time.Duration, reject bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var identity []string
+		for name, values := range c.Request.Header {
+			if !strings.HasPrefix(name, gatewaysig.IdentityPrefix) {
+				continue
+			}
+			if len(values) > 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "duplicate identity header " + name})
+				c.Abort()
+				return
+			}
+			identity = append(identity, name)
+		}
+
+		if len(identity) == 0 || gatewaysig.Verify(c.Request.Header, signingKey, maxSkew, time.Now()) == nil {
+			c.Next()
+			return
+		}
+
+		if reject {
+			c.JSON(http.StatusForbidden, gin.H{"error": "untrusted identity headers"})
+			c.Abort()
+			return
+		}
+
+		for _, name := range identity {
+			c.Request.Header.Del(name)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/gatewaysig"
+)
+
+var gatewayKey = []byte("gateway-signing-key")
+
+// guarded echoes the X-User-Id header the handler ends up seeing.
+func guarded(t *testing.T, reject bool, header http.Header) (int, string) {
+	t.Helper()
+
+	r := gin.New()
+	r.Use(IdentityHeaderGuard(gatewayKey, time.Minute, reject))
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetHeader("X-User-Id")})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body struct {
+		UserID string `json:"user_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body.UserID
+}
+
+func identity(userID string) http.Header {
+	h := http.Header{}
+	h.Set("X-User-Id", userID)
+	h.Set("X-User-Username", "alice")
+	return h
+}
+
+func TestIdentityHeaderGuard(t *testing.T) {
+	signed := identity("42")
+	gatewaysig.Sign(signed, gatewayKey, time.Now())
+
+	tampered := identity("42")
+	gatewaysig.Sign(tampered, gatewayKey, time.Now())
+	tampered.Set("X-User-Id", "1")
+
+	stale := identity("42")
+	gatewaysig.Sign(stale, gatewayKey, time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantStrip  string
+		wantReject int
+	}{
+		{"signed", signed, "42", http.StatusOK},
+		{"forged", identity("42"), "", http.StatusForbidden},
+		{"tampered", tampered, "", http.StatusForbidden},
+		{"stale", stale, "", http.StatusForbidden},
+		{"no identity", http.Header{}, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		code, userID := guarded(t, false, tt.header)
+		if code != http.StatusOK || userID != tt.wantStrip {
+			t.Errorf("%s, stripping: got %d with user %q, want 200 with %q", tt.name, code, userID, tt.wantStrip)
+		}
+		if code, _ := guarded(t, true, tt.header); code != tt.wantReject {
+			t.Errorf("%s, rejecting: status = %d, want %d", tt.name, code, tt.wantReject)
+		}
+	}
+}
+
+func TestIdentityHeaderGuardRejectsDuplicates(t *testing.T) {
+	h := identity("42")
+	h.Add("X-User-Id", "1")
+	gatewaysig.Sign(h, gatewayKey, time.Now())
+
+	if code, _ := guarded(t, false, h); code != http.StatusBadRequest {
+		t.Errorf("duplicate identity header: status = %d, want 400", code)
+	}
+}
+
+func TestIdentityHeaderGuardCoversForwardedClaims(t *testing.T) {
+	// Claims the gateway forwards beyond the user's identity, such as plan
+	// and roles, are signed and stripped like any other X-User-* header.
+	claims := func() http.Header {
+		h := identity("42")
+		h.Set("X-User-Plan", "free")
+		h.Set("X-User-Roles", "user")
+		return h
+	}
+
+	seen := func(header http.Header) http.Header {
+		t.Helper()
+		var got http.Header
+		r := gin.New()
+		r.Use(IdentityHeaderGuard(gatewayKey, time.Minute, false))
+		r.GET("/", func(c *gin.Context) { got = c.Request.Header.Clone() })
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header = header
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		return got
+	}
+
+	signed := claims()
+	gatewaysig.Sign(signed, gatewayKey, time.Now())
+	if got := seen(signed); got.Get("X-User-Plan") != "free" || got.Get("X-User-Roles") != "user" {
+		t.Errorf("signed claims not forwarded: %v", got)
+	}
+
+	upgraded := claims()
+	gatewaysig.Sign(upgraded, gatewayKey, time.Now())
+	upgraded.Set("X-User-Plan", "pro")
+	if got := seen(upgraded); got.Get("X-User-Plan") != "" || got.Get("X-User-Id") != "" {
+		t.Errorf("tampered plan kept: %v", got)
+	}
+
+	forged := http.Header{}
+	forged.Set("X-User-Roles", "admin")
+	if got := seen(forged); got.Get("X-User-Roles") != "" {
+		t.Errorf("unsigned roles header kept: %v", got)
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+)
+
+const internalTokenHeader = "X-Internal-Token"
+
+// InternalAuth admits only trusted services. trusted maps a service name to
+// its shared secret; the caller sends the secret in X-Internal-Token and is
+// identified by the name it matches. No user JWT is required.
+func InternalAuth(trusted map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(internalTokenHeader)
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "internal token required"})
+			c.Abort()
+			return
+		}
+
+		service := ""
+		for name, secret := range trusted {
+			if secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1 {
+				service = name
+			}
+		}
+		if service == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			c.Abort()
+			return
+		}
+
+		c.Set(ctxkey.Service, service)
+		c.Next()
+	}
+}
+
+// GetService returns the name of the trusted service that made the request.
+func GetService(c *gin.Context) string {
+	return ctxkey.Get[string](c, ctxkey.Service)
+}
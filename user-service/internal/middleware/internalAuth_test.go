@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInternalAuth(t *testing.T) {
+	r := gin.New()
+	r.GET("/internal/users", InternalAuth(map[string]string{"editor": "editor-secret", "disabled": ""}), func(c *gin.Context) {
+		c.String(http.StatusOK, GetService(c))
+	})
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"trusted service", "editor-secret", http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+		{"unknown secret", "guess", http.StatusForbidden},
+		{"user JWT", "Bearer eyJhbGciOiJIUzI1NiJ9.e30.x", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/internal/users", nil)
+		if tt.token != "" {
+			req.Header.Set("X-Internal-Token", tt.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && w.Body.String() != "editor" {
+			t.Errorf("%s: caller identified as %q, want editor", tt.name, w.Body)
+		}
+	}
+
+	// A service with an empty secret must not be matched by an empty or
+	// missing token.
+	req := httptest.NewRequest(http.MethodGet, "/internal/users", nil)
+	req.Header["X-Internal-Token"] = []string{""}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Error("empty token accepted")
+	}
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ErrorFormatCustom  = "custom"
+	ErrorFormatProblem = "problem"
+
+	problemContentType = "application/problem+json"
+)
+
+// ProblemJSON turns the JSON error bodies handlers write ({error, message,
+// fields, ...}) into RFC 7807 problem details. It applies to every request
+// when format is ErrorFormatProblem, otherwise only to requests whose
+// Accept header prefers application/problem+json. It has to be registered
+// first to see the errors of every other middleware.
+//
+// The error code becomes the problem type, typeBase + code, and is also
+// kept as a "code" member. message becomes detail, and any other members
+// are carried over as extensions.
+func ProblemJSON(format, typeBase string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		always := format == ErrorFormatProblem
+		if !always && !acceptsProblem(c.GetHeader("Accept")) {
+			c.Next()
+			return
+		}
+
+		writer := &problemWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() { c.Writer = writer.ResponseWriter }()
+
+		c.Next()
+
+		if !writer.buffering {
+			return
+		}
+		if !always {
+			writer.Header().Add("Vary", "Accept")
+		}
+		body, err := problemBody(writer.body.Bytes(), writer.Status(), typeBase, c.Request.URL.Path)
+		if err != nil {
+			// Not the error shape we know; send it unchanged.
+			writer.ResponseWriter.Write(writer.body.Bytes())
+			return
+		}
+		writer.Header().Set("Content-Type", problemContentType)
+		writer.ResponseWriter.Write(body)
+	}
+}
+
+// acceptsProblem reports whether accept lists application/problem+json with
+// a non-zero quality no lower than that of application/json. Wildcards
+// don't count: a client has to ask for problem details by name.
+func acceptsProblem(accept string) bool {
+	problemQ, jsonQ := 0.0, 0.0
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case problemContentType:
+			problemQ = max(problemQ, q)
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return problemQ > 0 && problemQ >= jsonQ
+}
+
+// problemWriter holds back JSON error bodies so they can be rewritten once
+// the handler is done.
+type problemWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	buffering bool
+}
+
+func (w *problemWriter) Write(data []byte) (int, error) {
+	if !w.buffering && w.body.Len() == 0 && w.Status() >= http.StatusBadRequest &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.buffering = true
+	}
+	if w.buffering {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *problemWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func problemBody(raw []byte, status int, typeBase, instance string) ([]byte, error) {
+	var members map[string]any
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return nil, err
+	}
+
+	problem := make(map[string]any, len(members)+4)
+	for k, v := range members {
+		problem[k] = v
+	}
+	delete(problem, "error")
+	delete(problem, "message")
+
+	problem["type"] = "about:blank"
+	problem["title"] = http.StatusText(status)
+	problem["status"] = status
+	problem["instance"] = instance
+
+	code, _ := members["error"].(string)
+	message, _ := members["message"].(string)
+	switch {
+	case isProblemCode(code):
+		problem["type"] = typeBase + code
+		problem["code"] = code
+	case code != "" && message == "":
+		// Some handlers put a human-readable message in "error".
+		message = code
+	}
+	if message != "" {
+		problem["detail"] = message
+	}
+
+	return json.Marshal(problem)
+}
+
+// isProblemCode reports whether s is a snake_case error code rather than a
+// sentence.
+func isProblemCode(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+)
+
+func TestAcceptsProblem(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/problem+json", true},
+		{"application/json, application/problem+json", true},
+		{"application/problem+json;q=0", false},
+		{"application/problem+json; q=0.0, application/json", false},
+		{"application/json;q=0.9, application/problem+json;q=0.5", false},
+		{"application/json;q=0.5, application/problem+json;q=0.9", true},
+		{"application/problem+json;q=abc", false},
+		{"text/html, application/problem+json;q=0.8", true},
+		{"application/problem+jsonx", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsProblem(tt.accept); got != tt.want {
+			t.Errorf("acceptsProblem(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func problemRouter(format string) *gin.Engine {
+	r := gin.New()
+	r.Use(ProblemJSON(format, "https://errors.example.com/"))
+	r.POST("/register", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "validation_error",
+			Message: "username: too short",
+			Fields:  map[string]string{"username": "too short"},
+		})
+	})
+	r.GET("/users/me", AuthMiddleware(jwt.NewTokenManager("test-secret", 0), nil, nil, BlacklistFailOpen), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	return r
+}
+
+func requestProblem(t *testing.T, r *gin.Engine, method, path, accept string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: body isn't JSON: %s", method, path, w.Body)
+	}
+	return w, body
+}
+
+func TestProblemJSONValidationError(t *testing.T) {
+	w, body := requestProblem(t, problemRouter(ErrorFormatCustom), http.MethodPost, "/register", problemContentType)
+
+	if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if w.Header().Get("Vary") != "Accept" {
+		t.Errorf("Vary = %q, want Accept", w.Header().Get("Vary"))
+	}
+	if body["type"] != "https://errors.example.com/validation_error" || body["code"] != "validation_error" {
+		t.Errorf("type/code = %v/%v", body["type"], body["code"])
+	}
+	if body["status"] != float64(http.StatusBadRequest) || body["detail"] != "username: too short" || body["instance"] != "/register" {
+		t.Errorf("problem = %v", body)
+	}
+	if fields, _ := body["fields"].(map[string]any); fields["username"] != "too short" {
+		t.Errorf("fields extension = %v", body["fields"])
+	}
+	if _, ok := body["error"]; ok {
+		t.Error("error member kept alongside type")
+	}
+}
+
+func TestProblemJSONAuthError(t *testing.T) {
+	w, body := requestProblem(t, problemRouter(ErrorFormatProblem), http.MethodGet, "/users/me", "")
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	// The middleware's message is a sentence, not a code.
+	if body["type"] != "about:blank" || body["title"] != "Unauthorized" || body["detail"] == nil {
+		t.Errorf("problem = %v", body)
+	}
+}
+
+func TestProblemJSONLeavesDefaultFormatAlone(t *testing.T) {
+	for _, accept := range []string{"", "application/json", "application/problem+json;q=0"} {
+		w, body := requestProblem(t, problemRouter(ErrorFormatCustom), http.MethodPost, "/register", accept)
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("Accept %q: Content-Type = %q", accept, ct)
+		}
+		if body["error"] != "validation_error" {
+			t.Errorf("Accept %q: body = %v", accept, body)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+)
+
+const (
+	readOnlyKey = "maintenance:read_only"
+
+	// readOnlyRefresh bounds how often the flag is read from Redis, and so
+	// how long an instance may lag behind a toggle.
+	readOnlyRefresh = time.Second
+)
+
+// ReadOnly rejects mutating requests while maintenance mode is on, so the
+// service keeps serving reads while the database refuses writes. Requests
+// are classified by method: GET, HEAD and OPTIONS are reads, everything else
+// is a write. Exempt paths (such as the toggle itself) are always allowed.
+//
+// Login and refresh write sessions and are rejected too; existing access
+// tokens keep working until they expire.
+//
+// The flag lives in Redis so a toggle reaches every instance. An instance
+// started with forced set is read-only regardless. If Redis can't be
+// reached the last known state is kept.
+type ReadOnly struct {
+	redis  *redis.Client
+	forced bool
+	exempt []string
+
+	mu        sync.Mutex
+	enabled   bool
+	checkedAt time.Time
+}
+
+func NewReadOnly(redisClient *redis.Client, forced bool, exemptPaths ...string) *ReadOnly {
+	return &ReadOnly{redis: redisClient, forced: forced, exempt: exemptPaths}
+}
+
+// SetEnabled turns read-only mode on or off for every instance.
+func (r *ReadOnly) SetEnabled(ctx context.Context, enabled bool) error {
+	var err error
+	if enabled {
+		err = r.redis.Set(ctx, readOnlyKey, "1", 0).Err()
+	} else {
+		err = r.redis.Del(ctx, readOnlyKey).Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.enabled, r.checkedAt = enabled, time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *ReadOnly) Enabled(ctx context.Context) bool {
+	if r.forced {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checkedAt) < readOnlyRefresh {
+		return r.enabled
+	}
+
+	n, err := r.redis.Exists(ctx, readOnlyKey).Result()
+	if err != nil {
+		log.Printf("read-only flag unavailable, keeping %t: %v", r.enabled, err)
+	} else {
+		r.enabled = n == 1
+	}
+	r.checkedAt = time.Now()
+	return r.enabled
+}
+
+// Middleware rejects writes while read-only and marks every request it lets
+// through then, so later middleware can skip incidental writes.
+func (r *ReadOnly) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !r.Enabled(c.Request.Context()) {
+			c.Next()
+			return
+		}
+		c.Set(ctxkey.ReadOnly, true)
+
+		if isSafeMethod(c.Request.Method) || slices.Contains(r.exempt, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", "60")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "read_only",
+			"message": "The service is in read-only mode for maintenance, please try again later",
+		})
+	}
+}
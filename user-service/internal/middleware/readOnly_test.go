@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func readOnlyRouter(r *ReadOnly) *gin.Engine {
+	router := gin.New()
+	router.Use(r.Middleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/users/me", ok)
+	router.POST("/users/me", ok)
+	router.POST("/admin/read-only", ok)
+	return router
+}
+
+func readOnlyStatus(router *gin.Engine, method, path string) int {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w.Code
+}
+
+func newReadOnlyRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestReadOnlyRejectsWritesOnEveryInstance(t *testing.T) {
+	_, client := newReadOnlyRedis(t)
+	first := NewReadOnly(client, false, "/admin/read-only")
+	second := readOnlyRouter(NewReadOnly(client, false, "/admin/read-only"))
+
+	if got := readOnlyStatus(second, http.MethodPost, "/users/me"); got != http.StatusNoContent {
+		t.Fatalf("POST before read-only: got %d", got)
+	}
+
+	// Toggled through one instance; the other hasn't cached the old
+	// state long enough to miss it.
+	if err := first.SetEnabled(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	second = readOnlyRouter(NewReadOnly(client, false, "/admin/read-only"))
+
+	if got := readOnlyStatus(second, http.MethodPost, "/users/me"); got != http.StatusServiceUnavailable {
+		t.Errorf("POST while read-only: got %d, want 503", got)
+	}
+	if got := readOnlyStatus(second, http.MethodGet, "/users/me"); got != http.StatusNoContent {
+		t.Errorf("GET while read-only: got %d, want 204", got)
+	}
+	if got := readOnlyStatus(second, http.MethodPost, "/admin/read-only"); got != http.StatusNoContent {
+		t.Errorf("exempt POST while read-only: got %d, want 204", got)
+	}
+}
+
+func TestReadOnlyForced(t *testing.T) {
+	_, client := newReadOnlyRedis(t)
+	r := NewReadOnly(client, true)
+
+	if err := r.SetEnabled(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readOnlyStatus(readOnlyRouter(r), http.MethodPost, "/users/me"); got != http.StatusServiceUnavailable {
+		t.Errorf("POST on a forced read-only instance: got %d, want 503", got)
+	}
+}
+
+func TestReadOnlyKeepsStateWhenRedisFails(t *testing.T) {
+	mr, client := newReadOnlyRedis(t)
+	r := NewReadOnly(client, false)
+	if err := r.SetEnabled(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.Close()
+	r.checkedAt = r.checkedAt.Add(-readOnlyRefresh)
+	if !r.Enabled(context.Background()) {
+		t.Error("read-only mode dropped when Redis went away")
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/ctxkey"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+)
+
+func verifiedRouter(users *repository.UserRepository, userID int64) *gin.Engine {
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		c.Set(ctxkey.UserID, userID)
+		c.Next()
+	}, RequireVerified(users, true), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func TestRequireVerified(t *testing.T) {
+	db := testdb.New(t)
+	users := repository.NewUserRepository(db)
+	ctx := context.Background()
+
+	unverified := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	verified := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "x"}
+	for _, u := range []*models.User{unverified, verified} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := users.MarkVerified(ctx, verified.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int64
+		want   int
+	}{
+		{"verified", verified.ID, http.StatusNoContent},
+		{"unverified", unverified.ID, http.StatusForbidden},
+		{"missing user", verified.ID + 1000, http.StatusNotFound},
+		{"no user", 0, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		verifiedRouter(users, tt.userID).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	// A lookup failure is the server's problem, not the user's.
+	db.Close()
+	w := httptest.NewRecorder()
+	verifiedRouter(users, verified.ID).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("database down: status = %d, want 500", w.Code)
+	}
+}
@@ -1,20 +1,38 @@
 package migration
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func AutoMigrate(dbURL string) error {
+const sourceDir = "/app/internal/migration/migrations"
+
+// AutoMigrate applies all pending migrations. The postgres driver serializes
+// concurrent migrators with pg_advisory_lock, so when several replicas start
+// together one applies the migrations while the others block on the lock for
+// up to lockTimeout and then find nothing left to do.
+func AutoMigrate(dbURL string, lockTimeout time.Duration) error {
+	return migrateUp(dbURL, sourceDir, lockTimeout)
+}
+
+func migrateUp(dbURL, dir string, lockTimeout time.Duration) error {
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		return fmt.Errorf("sql open error: %w", err)
 	}
+	defer db.Close()
 
 	driver, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
@@ -22,13 +40,14 @@ func AutoMigrate(dbURL string) error {
 	}
 
 	m, err := migrate.NewWithDatabaseInstance(
-		"file:///app/internal/migration/migrations",
+		"file://"+dir,
 		"postgres",
 		driver,
 	)
 	if err != nil {
 		return fmt.Errorf("migrate init error: %w", err)
 	}
+	m.LockTimeout = lockTimeout
 
 	err = m.Up()
 	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
@@ -37,3 +56,50 @@ func AutoMigrate(dbURL string) error {
 
 	return nil
 }
+
+// ExpectedVersion returns the highest migration version shipped with this
+// build, i.e. the version the schema must be at before serving traffic.
+func ExpectedVersion() (uint, error) {
+	return latestVersion(sourceDir)
+}
+
+func latestVersion(dir string) (uint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("read migrations dir: %w", err)
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if uint(version) > latest {
+			latest = uint(version)
+		}
+	}
+
+	return latest, nil
+}
+
+// SchemaVersion reports the version recorded by golang-migrate and whether a
+// previous run left it dirty.
+func SchemaVersion(ctx context.Context, db *pgxpool.Pool) (uint, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return uint(version), dirty, nil
+}
@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+)
+
+func TestConcurrentMigrationsApplyOnce(t *testing.T) {
+	dbURL := testdb.NewURL(t)
+	dir := testdb.MigrationsDir()
+
+	// Two replicas starting together: one migrates, the other waits on the
+	// advisory lock and then finds nothing to do.
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Go(func() { errs[i] = migrateUp(dbURL, dir, 30*time.Second) })
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("replica %d: %v", i, err)
+		}
+	}
+
+	pool, err := pgxpool.New(context.Background(), dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	version, dirty, err := SchemaVersion(context.Background(), pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := latestVersion(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != want || dirty {
+		t.Errorf("schema at version %d (dirty %v), want %d clean", version, dirty, want)
+	}
+}
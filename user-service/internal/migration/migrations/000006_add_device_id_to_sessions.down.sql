@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sessions_user_device;
+ALTER TABLE sessions DROP COLUMN device_id;
@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+    ADD COLUMN device_id VARCHAR(128);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_device ON sessions(user_id, device_id);
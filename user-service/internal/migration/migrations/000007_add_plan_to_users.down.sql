@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN plan;
\ No newline at end of file
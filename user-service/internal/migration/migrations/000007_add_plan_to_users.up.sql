@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN plan VARCHAR(20) NOT NULL DEFAULT 'free';
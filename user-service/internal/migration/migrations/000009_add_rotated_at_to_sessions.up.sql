@@ -0,0 +1,2 @@
+ALTER TABLE sessions
+    ADD COLUMN rotated_at TIMESTAMPTZ;
@@ -0,0 +1,11 @@
+DELETE FROM email_verifications ev
+WHERE ev.verified_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM email_verifications newer
+    WHERE newer.user_id = ev.user_id
+      AND newer.verified_at IS NULL
+      AND (newer.created_at, newer.id) > (ev.created_at, ev.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verifications_one_active
+    ON email_verifications(user_id) WHERE verified_at IS NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN deletion_reminder_sent_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS user_reports (
+    id BIGSERIAL PRIMARY KEY,
+    reporter_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    target_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(30) NOT NULL,
+    details TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolution_note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A reporter can only have one open report against the same user.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_reports_one_open
+    ON user_reports (reporter_id, target_id) WHERE status = 'open';
+
+CREATE INDEX IF NOT EXISTS idx_user_reports_status_created_at ON user_reports (status, created_at DESC);
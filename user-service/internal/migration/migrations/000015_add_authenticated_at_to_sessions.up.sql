@@ -0,0 +1,10 @@
+-- authenticated_at is when the user last entered credentials. Rotated
+-- sessions inherit it, so it bounds a session's total lifetime.
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS authenticated_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE sessions SET authenticated_at = created_at WHERE authenticated_at IS NULL;
+
+ALTER TABLE sessions
+    ALTER COLUMN authenticated_at SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN authenticated_at SET NOT NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_onboarding_enrolled;
+
+ALTER TABLE users DROP COLUMN IF EXISTS onboarding_enrolled;
+
+DROP TABLE IF EXISTS onboarding_steps;
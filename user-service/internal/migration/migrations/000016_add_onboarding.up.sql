@@ -0,0 +1,16 @@
+-- Each completed onboarding step is tracked by template name, so the
+-- sequence can be reordered or extended without re-sending or skipping
+-- emails.
+CREATE TABLE IF NOT EXISTS onboarding_steps (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    step VARCHAR(100) NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, step)
+);
+
+-- Existing users are not enrolled; the default only applies to users who
+-- sign up from now on.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS onboarding_enrolled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ALTER COLUMN onboarding_enrolled SET DEFAULT TRUE;
+
+CREATE INDEX IF NOT EXISTS idx_users_onboarding_enrolled ON users (id) WHERE onboarding_enrolled;
@@ -0,0 +1,5 @@
+-- 'all' receives every email; 'essential' only security and account emails
+-- such as verification and password resets.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_preferences VARCHAR(20) NOT NULL DEFAULT 'all'
+        CHECK (email_preferences IN ('all', 'essential'));
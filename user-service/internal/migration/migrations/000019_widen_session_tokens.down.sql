@@ -0,0 +1,3 @@
+ALTER TABLE sessions
+    ALTER COLUMN refresh_token TYPE VARCHAR(500),
+    ALTER COLUMN access_token TYPE VARCHAR(500);
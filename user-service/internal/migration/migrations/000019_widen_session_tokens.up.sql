@@ -0,0 +1,5 @@
+-- Tokens carry the username, email and a jti, and with long emails they no
+-- longer fit in 500 characters.
+ALTER TABLE sessions
+    ALTER COLUMN refresh_token TYPE TEXT,
+    ALTER COLUMN access_token TYPE TEXT;
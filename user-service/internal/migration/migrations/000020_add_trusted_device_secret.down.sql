@@ -0,0 +1 @@
+ALTER TABLE trusted_devices DROP COLUMN IF EXISTS secret_hash;
@@ -0,0 +1,5 @@
+-- A device ID is chosen by the client, so it can't prove a login came from
+-- a trusted device. Trusting a device now issues a secret the client must
+-- present; devices trusted before this have none and have to be trusted
+-- again.
+ALTER TABLE trusted_devices ADD COLUMN IF NOT EXISTS secret_hash VARCHAR(64);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_lower_email;
+DROP INDEX IF EXISTS idx_users_lower_username;
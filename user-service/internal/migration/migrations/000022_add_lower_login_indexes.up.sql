@@ -0,0 +1,4 @@
+-- Logins fall back to matching the username or email case-insensitively.
+-- Neither is unique that way, so these aren't unique indexes.
+CREATE INDEX IF NOT EXISTS idx_users_lower_username ON users (LOWER(username)) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_users_lower_email ON users (LOWER(email)) WHERE deleted_at IS NULL;
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+var ReportStatuses = []string{ReportStatusOpen, ReportStatusResolved, ReportStatusDismissed}
+
+const (
+	ReportReasonSpam          = "spam"
+	ReportReasonHarassment    = "harassment"
+	ReportReasonImpersonation = "impersonation"
+	ReportReasonInappropriate = "inappropriate_content"
+	ReportReasonOther         = "other"
+)
+
+var ReportReasons = []string{
+	ReportReasonSpam,
+	ReportReasonHarassment,
+	ReportReasonImpersonation,
+	ReportReasonInappropriate,
+	ReportReasonOther,
+}
+
+// UserReport is a user's complaint about another user, queued for
+// moderators. ReporterID is nil once the reporter's account is gone.
+type UserReport struct {
+	ID             int64      `json:"id"`
+	ReporterID     *int64     `json:"reporter_id,omitempty"`
+	TargetID       int64      `json:"target_id"`
+	Reason         string     `json:"reason"`
+	Details        *string    `json:"details,omitempty"`
+	Status         string     `json:"status"`
+	ResolvedBy     *int64     `json:"resolved_by,omitempty"`
+	ResolutionNote *string    `json:"resolution_note,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
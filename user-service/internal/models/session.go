@@ -2,16 +2,23 @@ package models
 
 import "time"
 
+// SessionInfo describes one device. ID and the timestamps belong to the
+// device's most recent session; SessionCount is how many active sessions
+// were collapsed into it.
 type SessionInfo struct {
-	ID        int64     `json:"id"`
-	UserAgent *string   `json:"user_agent,omitempty"`
-	IPAddress *string   `json:"ip_address,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
-	IsCurrent bool      `json:"is_current"`
+	ID           int64     `json:"id"`
+	DeviceID     *string   `json:"device_id,omitempty"`
+	UserAgent    *string   `json:"user_agent,omitempty"`
+	IPAddress    *string   `json:"ip_address,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	IsCurrent    bool      `json:"is_current"`
+	SessionCount int       `json:"session_count"`
 }
 
 type SessionListResponse struct {
 	Sessions []*SessionInfo `json:"sessions"`
 	Total    int            `json:"total"`
+	Limit    int            `json:"limit"`
+	Offset   int            `json:"offset"`
 }
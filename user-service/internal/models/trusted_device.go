@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// TrustedDevice is a device, identified by the client's X-Device-ID, that a
+// user has marked as their own. Logins from it that present its secret don't
+// trigger new-login alerts.
+type TrustedDevice struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	DeviceID   string     `json:"device_id"`
+	Label      *string    `json:"label,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	// Secret is only set in the response that trusts the device; the
+	// client sends it back in X-Device-Secret.
+	Secret string `json:"device_secret,omitempty"`
+}
@@ -2,16 +2,73 @@ package models
 
 import "time"
 
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+	StatusAway    = "away"
+	StatusBusy    = "busy"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+)
+
+// Email preferences: EmailPreferencesEssential opts out of everything but
+// security and account emails.
+const (
+	EmailPreferencesAll       = "all"
+	EmailPreferencesEssential = "essential"
+)
+
+var EmailPreferenceValues = []string{EmailPreferencesAll, EmailPreferencesEssential}
+
+// UserStatuses is the single source of truth for accepted presence values.
+var UserStatuses = []string{StatusOnline, StatusOffline, StatusAway, StatusBusy}
+
 type User struct {
-	ID           int64      `json:"id"`
-	Username     string     `json:"username"`
-	Email        string     `json:"email"`
-	PasswordHash string     `json:"-"`
-	DisplayName  *string    `json:"display_name,omitempty"`
-	AvatarURL    *string    `json:"avatar_url,omitempty"`
-	Bio          *string    `json:"bio,omitempty"`
-	Status       string     `json:"status"`
-	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID               int64      `json:"id"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email"`
+	PasswordHash     string     `json:"-"`
+	DisplayName      *string    `json:"display_name,omitempty"`
+	AvatarURL        *string    `json:"avatar_url,omitempty"`
+	Bio              *string    `json:"bio,omitempty"`
+	Status           string     `json:"status"`
+	Role             string     `json:"role"`
+	Plan             string     `json:"plan"`
+	IsVerified       bool       `json:"is_verified"`
+	EmailPreferences string     `json:"email_preferences"`
+	LastSeenAt       *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+}
+
+// PublicUser is what any authenticated user may see about another one.
+type PublicUser struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName *string   `json:"display_name,omitempty"`
+	AvatarURL   *string   `json:"avatar_url,omitempty"`
+	Bio         *string   `json:"bio,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (u *User) Public() *PublicUser {
+	return &PublicUser{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		AvatarURL:   u.AvatarURL,
+		Bio:         u.Bio,
+		Status:      u.Status,
+		CreatedAt:   u.CreatedAt,
+	}
 }
@@ -0,0 +1,68 @@
+// Package redact scrubs secrets from payloads before they are logged.
+package redact
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const Placeholder = "[REDACTED]"
+
+var sensitiveKeys = []string{
+	"password",
+	"token",
+	"secret",
+	"authorization",
+	"cookie",
+	"code",
+}
+
+// IsSensitiveKey reports whether a field or header name may carry a secret.
+// Matching is by substring, so "new_password" and "refresh_token" count.
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON returns body with the values of sensitive keys replaced, at any
+// depth. Bodies that aren't JSON are not returned at all, since there's no
+// way to tell what in them is secret.
+func JSON(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "[non-JSON body omitted]"
+	}
+
+	out, err := json.Marshal(scrub(value))
+	if err != nil {
+		return "[unencodable body omitted]"
+	}
+	return string(out)
+}
+
+func scrub(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			if IsSensitiveKey(key) {
+				v[key] = Placeholder
+			} else {
+				v[key] = scrub(inner)
+			}
+		}
+	case []any:
+		for i, inner := range v {
+			v[i] = scrub(inner)
+		}
+	}
+	return value
+}
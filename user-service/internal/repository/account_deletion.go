@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+// SoftDelete schedules the account for purging and revokes its sessions
+// and API tokens.
+// It returns when the deletion was requested.
+func (r *UserRepository) SoftDelete(ctx context.Context, userID int64) (time.Time, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE users
+		SET deleted_at = NOW(), deletion_reminder_sent_at = NULL, status = 'offline', updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING deleted_at
+	`
+	var deletedAt time.Time
+	if err := tx.QueryRow(ctx, query, userID).Scan(&deletedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, ErrUserNotFound
+		}
+		return time.Time{}, err
+	}
+
+	query = `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	query = `
+		UPDATE api_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	return deletedAt, tx.Commit(ctx)
+}
+
+// GetDeletedByLogin finds an account by username or email that was deleted
+// after since, i.e. one that can still be reactivated.
+func (r *UserRepository) GetDeletedByLogin(ctx context.Context, login string, since time.Time) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE (username = $1 OR LOWER(email) = LOWER($1)) AND deleted_at > $2
+	`
+
+	return r.getSingle(ctx, query, login, since)
+}
+
+// Restore cancels a pending deletion.
+func (r *UserRepository) Restore(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, deletion_reminder_sent_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+	result, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ListDeletedBefore returns up to limit accounts deleted before before. With
+// unreminded set, accounts that were already sent a reminder are skipped.
+func (r *UserRepository) ListDeletedBefore(ctx context.Context, before time.Time, unreminded bool, limit int) ([]*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			AND (NOT $2 OR deletion_reminder_sent_at IS NULL)
+		ORDER BY deleted_at
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(ctx, query, before, unreminded, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *UserRepository) MarkDeletionReminderSent(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users
+		SET deletion_reminder_sent_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, userID)
+	return err
+}
+
+// Purge permanently removes a soft-deleted account. Rows referencing the
+// user are removed by their ON DELETE CASCADE.
+func (r *UserRepository) Purge(ctx context.Context, userID int64) error {
+	query := `
+		DELETE FROM users
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+	_, err := r.db.Exec(ctx, query, userID)
+	return err
+}
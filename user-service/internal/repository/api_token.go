@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+const apiTokenColumns = `id, user_id, name, token_prefix, token_hash, scopes,
+		expires_at, last_used_at, created_at, revoked_at`
+
+func scanAPIToken(row pgx.Row) (*models.APIToken, error) {
+	token := &models.APIToken{}
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&token.TokenHash,
+		&token.Scopes,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+		&token.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+type APITokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAPITokenRepository(db *pgxpool.Pool) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+func (r *APITokenRepository) Create(ctx context.Context, token *models.APIToken) error {
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	return r.db.QueryRow(ctx, query,
+		token.UserID,
+		token.Name,
+		token.Prefix,
+		token.TokenHash,
+		token.Scopes,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *APITokenRepository) ListByUserID(ctx context.Context, userID int64) ([]*models.APIToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]*models.APIToken, 0)
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// GetByID returns an active token of userID; other users' tokens are
+// reported as not found.
+func (r *APITokenRepository) GetByID(ctx context.Context, userID, id int64) (*models.APIToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM api_tokens
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	token, err := scanAPIToken(r.db.QueryRow(ctx, query, id, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Revoke only touches tokens owned by userID, so one user can't revoke
+// another's token by guessing its id.
+func (r *APITokenRepository) Revoke(ctx context.Context, userID, id int64) error {
+	query := `
+		UPDATE api_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrAPITokenNotFound
+	}
+
+	return nil
+}
+
+// GetByPrefix returns the token regardless of its revocation or expiry state;
+// callers decide whether it is still usable.
+func (r *APITokenRepository) GetByPrefix(ctx context.Context, prefix string) (*models.APIToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM api_tokens
+		WHERE token_prefix = $1
+	`
+
+	token, err := scanAPIToken(r.db.QueryRow(ctx, query, prefix))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (r *APITokenRepository) TouchLastUsed(ctx context.Context, id int64) error {
+	query := `
+		UPDATE api_tokens
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+
+	_, err := r.db.Exec(ctx, query, id)
+	return err
+}
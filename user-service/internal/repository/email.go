@@ -3,15 +3,32 @@ package repository
 import (
 	"context"
 	"errors"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
 	"time"
 )
 
 var (
-	ErrInvalidOrExpiredToken = errors.New("invalid or expired verification token")
+	ErrVerificationNotFound = errors.New("verification token not found")
+	ErrVerificationExpired  = errors.New("verification token expired")
+	ErrAlreadyVerified      = errors.New("email already verified")
 )
 
+// VerificationExpiredError carries when an expired verification lapsed. It
+// matches ErrVerificationExpired with errors.Is.
+type VerificationExpiredError struct {
+	ExpiredAt time.Time
+}
+
+func (e *VerificationExpiredError) Error() string {
+	return ErrVerificationExpired.Error()
+}
+
+func (e *VerificationExpiredError) Is(target error) bool {
+	return target == ErrVerificationExpired
+}
+
 type EmailVerificationRepository struct {
 	db *pgxpool.Pool
 }
@@ -22,14 +39,44 @@ func NewEmailVerificationRepository(db *pgxpool.Pool) *EmailVerificationReposito
 	}
 }
 
+// Create replaces any pending verification of the user with ev, so a user
+// has at most one usable token no matter how often one is requested. The
+// user row is locked so concurrent requests can't both insert.
 func (r *EmailVerificationRepository) Create(ctx context.Context, ev *models.EmailVerification) error {
-	query := `
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT id FROM users WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, ev.UserID).Scan(&ev.UserID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	query = `
+		DELETE FROM email_verifications
+		WHERE user_id = $1 AND verified_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, ev.UserID); err != nil {
+		return err
+	}
+
+	query = `
 		INSERT INTO email_verifications (user_id, token, expires_at)
 		VALUES ($1, $2, $3)
 		RETURNING id, created_at
 	`
-	return r.db.QueryRow(ctx, query, ev.UserID, ev.Token, ev.ExpiresAt).
+	err = tx.QueryRow(ctx, query, ev.UserID, ev.Token, ev.ExpiresAt).
 		Scan(&ev.ID, &ev.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (r *EmailVerificationRepository) GetByToken(ctx context.Context, token string) (*models.EmailVerification, error) {
@@ -42,14 +89,64 @@ func (r *EmailVerificationRepository) GetByToken(ctx context.Context, token stri
 	err := r.db.QueryRow(ctx, query, token).
 		Scan(&ev.ID, &ev.UserID, &ev.Token, &ev.ExpiresAt, &ev.CreatedAt, &ev.VerifiedAt)
 	if err != nil {
-		return nil, ErrInvalidOrExpiredToken
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrVerificationNotFound
+		}
+		return nil, err
+	}
+	// Already-verified wins over expired: clicking an old link again after
+	// a successful verification is not an error for the user.
+	if ev.VerifiedAt != nil {
+		return nil, ErrAlreadyVerified
 	}
 	if time.Now().After(ev.ExpiresAt) {
-		return nil, ErrInvalidOrExpiredToken
+		return nil, &VerificationExpiredError{ExpiredAt: ev.ExpiresAt}
 	}
 	return ev, nil
 }
 
+// Consume marks the verification behind token as used and the user as
+// verified, atomically. Only the first call for a token succeeds; the rest
+// get the same errors as GetByToken, so a replayed link never re-runs the
+// effects of a verification.
+func (r *EmailVerificationRepository) Consume(ctx context.Context, token string) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE email_verifications
+		SET verified_at = NOW()
+		WHERE token = $1 AND verified_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+	var userID int64
+	err = tx.QueryRow(ctx, query, token).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			_, err = r.GetByToken(ctx, token)
+			if err == nil {
+				// Expired between the two statements.
+				err = ErrVerificationExpired
+			}
+		}
+		return 0, err
+	}
+
+	query = `
+		UPDATE users
+		SET is_verified = TRUE, updated_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit(ctx)
+}
+
 func (r *EmailVerificationRepository) MarkVerified(ctx context.Context, id int64) error {
 	query := `
 		UPDATE email_verifications
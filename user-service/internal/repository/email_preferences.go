@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+// EssentialEmailsOnly reports whether userID has opted out of non-essential
+// emails. Deleted accounts haven't.
+func (r *UserRepository) EssentialEmailsOnly(ctx context.Context, userID int64) (bool, error) {
+	query := `
+		SELECT email_preferences = $2
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	var essential bool
+	err := r.db.QueryRow(ctx, query, userID, models.EmailPreferencesEssential).Scan(&essential)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return essential, err
+}
+
+// SetEmailPreferences is used by unsubscribe links, which identify the
+// account by a signed user ID rather than by a session.
+func (r *UserRepository) SetEmailPreferences(ctx context.Context, userID int64, preferences string) error {
+	query := `
+		UPDATE users
+		SET email_preferences = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, userID, preferences)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
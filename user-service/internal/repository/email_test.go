@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+)
+
+func TestCancelledContextAbortsQuery(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := NewUserRepository(db).Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the insert below run long on the server, so the cancel arrives
+	// while the query executes rather than while it waits for a connection.
+	_, err := db.Exec(ctx, `
+		CREATE FUNCTION slow_insert() RETURNS trigger AS $$
+		BEGIN
+			PERFORM pg_sleep(30);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE TRIGGER slow_insert BEFORE INSERT ON email_verifications
+		FOR EACH ROW EXECUTE FUNCTION slow_insert();
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = NewEmailVerificationRepository(db).Create(reqCtx, &models.EmailVerification{
+		UserID:    user.ID,
+		Token:     "some-token",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Create after cancel = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Create returned %v after the cancel, want promptly", elapsed)
+	}
+}
+
+func TestCreateKeepsOneActiveVerification(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewEmailVerificationRepository(db)
+	ctx := context.Background()
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := NewUserRepository(db).Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	create := func(token string) {
+		t.Helper()
+		ev := &models.EmailVerification{UserID: user.ID, Token: token, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := repo.Create(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A used token is history, not a pending one, and is kept.
+	create("used")
+	if _, err := repo.Consume(ctx, "used"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 5 {
+		create(fmt.Sprintf("token-%d", i))
+	}
+
+	var active, total int
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) - COUNT(verified_at), COUNT(*)
+		FROM email_verifications WHERE user_id = $1
+	`, user.ID).Scan(&active, &total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active != 1 || total != 2 {
+		t.Errorf("%d active of %d rows, want 1 active plus the used one", active, total)
+	}
+
+	if _, err := repo.GetByToken(ctx, "token-4"); err != nil {
+		t.Errorf("newest token: %v", err)
+	}
+	if _, err := repo.GetByToken(ctx, "token-3"); !errors.Is(err, ErrVerificationNotFound) {
+		t.Errorf("replaced token: got %v, want ErrVerificationNotFound", err)
+	}
+
+	if err := repo.Create(ctx, &models.EmailVerification{UserID: user.ID + 1000, Token: "nobody", ExpiresAt: time.Now()}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: got %v, want ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+// ListOnboardingDue returns enrolled, verified users who haven't completed
+// step and completed previous at or before before. An empty previous means
+// step is first and counts from sign-up.
+func (r *UserRepository) ListOnboardingDue(ctx context.Context, step, previous string, before time.Time, limit int) ([]*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE onboarding_enrolled AND is_verified AND deleted_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM onboarding_steps s WHERE s.user_id = users.id AND s.step = $1
+			)
+			AND (
+				($2 = '' AND created_at <= $3)
+				OR EXISTS (
+					SELECT 1 FROM onboarding_steps p
+					WHERE p.user_id = users.id AND p.step = $2 AND p.completed_at <= $3
+				)
+			)
+		ORDER BY id
+		LIMIT $4
+	`
+
+	rows, err := r.db.Query(ctx, query, step, previous, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CompleteOnboardingStep records that userID is done with step. Completing
+// a step twice keeps the first time.
+func (r *UserRepository) CompleteOnboardingStep(ctx context.Context, userID int64, step string) error {
+	query := `
+		INSERT INTO onboarding_steps (user_id, step)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, step) DO NOTHING
+	`
+	_, err := r.db.Exec(ctx, query, userID, step)
+	return err
+}
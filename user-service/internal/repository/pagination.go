@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// UserCursor marks a position in the (created_at, id) ordering of users.
+// Keyset pagination resumes strictly after it, so rows inserted or deleted
+// between pages don't shift the results the way an offset does.
+type UserCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// Encode returns an opaque token for the cursor. Microseconds match the
+// precision Postgres stores timestamps with.
+func (c UserCursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixMicro(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeUserCursor(token string) (*UserCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var micros, id int64
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &micros, &id); err != nil || id <= 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &UserCursor{CreatedAt: time.UnixMicro(micros), ID: id}, nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+)
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	cursor := UserCursor{CreatedAt: time.UnixMicro(1_700_000_000_123_456), ID: 42}
+	got, err := DecodeUserCursor(cursor.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(cursor.CreatedAt) || got.ID != cursor.ID {
+		t.Errorf("decoded %+v, want %+v", got, cursor)
+	}
+
+	for _, token := range []string{"", "not base64!", "MTIzNA", UserCursor{ID: 0}.Encode()} {
+		if _, err := DecodeUserCursor(token); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeUserCursor(%q) = %v, want ErrInvalidCursor", token, err)
+		}
+	}
+}
+
+func TestListUsersCursorIsStableAcrossInserts(t *testing.T) {
+	repo := NewUserRepository(testdb.New(t))
+	ctx := context.Background()
+
+	n := 0
+	create := func() int64 {
+		t.Helper()
+		n++
+		user := &models.User{Username: fmt.Sprintf("user%d", n), Email: fmt.Sprintf("user%d@example.com", n), PasswordHash: "x"}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		return user.ID
+	}
+
+	want := map[int64]bool{}
+	for range 7 {
+		want[create()] = true
+	}
+
+	seen := map[int64]bool{}
+	params := ListUsersParams{Limit: 3}
+	for page := 0; ; page++ {
+		users, next, err := repo.List(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range users {
+			if seen[user.ID] {
+				t.Errorf("page %d repeats user %d", page, user.ID)
+			}
+			seen[user.ID] = true
+		}
+		if next == nil {
+			break
+		}
+		// Users signing up mid-iteration land before the cursor.
+		create()
+		params.After = next
+	}
+
+	for id := range want {
+		if !seen[id] {
+			t.Errorf("skipped user %d", id)
+		}
+	}
+	if len(seen) != len(want) {
+		t.Errorf("saw %d users, want the %d that existed when paging began", len(seen), len(want))
+	}
+}
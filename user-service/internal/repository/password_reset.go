@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrResetNotFound = errors.New("password reset token not found")
+	ErrResetExpired  = errors.New("password reset token expired")
+	ErrResetUsed     = errors.New("password reset token already used")
+	ErrResetTaken    = errors.New("password reset token already issued")
+)
+
+type PasswordResetRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPasswordResetRepository(db *pgxpool.Pool) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// Create stores a reset for userID. Only the token's hash is kept, so a
+// database leak doesn't hand out working reset links.
+func (r *PasswordResetRepository) Create(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err := r.db.Exec(ctx, query, userID, tokenHash, expiresAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrResetTaken
+	}
+	return err
+}
+
+// Replace is Create that also spends the user's outstanding resets, in one
+// transaction, so only the newest one works.
+func (r *PasswordResetRepository) Replace(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE password_resets
+		SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err = tx.Exec(ctx, query, userID, tokenHash, expiresAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrResetTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ResetPassword uses the reset behind tokenHash to set the user's password
+// and revoke all of their sessions and API tokens, in one transaction. A
+// token works once. It returns the user and the access tokens of the
+// revoked sessions, for the caller to blacklist.
+func (r *PasswordResetRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int64, []string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE password_resets
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+	var userID int64
+	err = tx.QueryRow(ctx, query, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, r.classify(ctx, tokenHash)
+		}
+		return 0, nil, err
+	}
+
+	query = `
+		UPDATE users
+		SET password_hash = $2, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	result, err := tx.Exec(ctx, query, userID, passwordHash)
+	if err != nil {
+		return 0, nil, err
+	}
+	if result.RowsAffected() == 0 {
+		return 0, nil, ErrUserNotFound
+	}
+
+	// Other outstanding resets for the user are spent too.
+	query = `
+		UPDATE password_resets
+		SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return 0, nil, err
+	}
+
+	query = `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL
+		RETURNING access_token
+	`
+	rows, err := tx.Query(ctx, query, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	accessTokens, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	query = `
+		UPDATE api_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return 0, nil, err
+	}
+
+	return userID, accessTokens, tx.Commit(ctx)
+}
+
+// classify explains why tokenHash couldn't be used.
+func (r *PasswordResetRepository) classify(ctx context.Context, tokenHash string) error {
+	query := `
+		SELECT expires_at, used_at
+		FROM password_resets
+		WHERE token_hash = $1
+	`
+	var expiresAt time.Time
+	var usedAt *time.Time
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(&expiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrResetNotFound
+		}
+		return err
+	}
+
+	if usedAt != nil {
+		return ErrResetUsed
+	}
+	return ErrResetExpired
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+var (
+	ErrReportNotFound  = errors.New("report not found")
+	ErrReportClosed    = errors.New("report already closed")
+	ErrDuplicateReport = errors.New("an open report against this user already exists")
+)
+
+const reportColumns = `id, reporter_id, target_id, reason, details, status, resolved_by, resolution_note, created_at, resolved_at`
+
+type ReportRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewReportRepository(db *pgxpool.Pool) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+func (r *ReportRepository) Create(ctx context.Context, report *models.UserReport) error {
+	query := `
+		INSERT INTO user_reports (reporter_id, target_id, reason, details)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, report.ReporterID, report.TargetID, report.Reason, report.Details).
+		Scan(&report.ID, &report.Status, &report.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateReport
+	}
+	return err
+}
+
+// List returns reports oldest first, so moderators work the queue in
+// order. An empty status lists reports in every state.
+func (r *ReportRepository) List(ctx context.Context, status string, limit, offset int) ([]*models.UserReport, error) {
+	query := `
+		SELECT ` + reportColumns + `
+		FROM user_reports
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at, id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*models.UserReport{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// Resolve closes an open report with status, recording who closed it.
+func (r *ReportRepository) Resolve(ctx context.Context, id, adminID int64, status string, note *string) (*models.UserReport, error) {
+	query := `
+		UPDATE user_reports
+		SET status = $3, resolved_by = $2, resolution_note = $4, resolved_at = NOW()
+		WHERE id = $1 AND status = 'open'
+		RETURNING ` + reportColumns
+
+	report, err := scanReport(r.db.QueryRow(ctx, query, id, adminID, status, note))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return report, err
+	}
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM user_reports WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrReportClosed
+	}
+	return nil, ErrReportNotFound
+}
+
+func scanReport(row pgx.Row) (*models.UserReport, error) {
+	report := &models.UserReport{}
+	err := row.Scan(
+		&report.ID,
+		&report.ReporterID,
+		&report.TargetID,
+		&report.Reason,
+		&report.Details,
+		&report.Status,
+		&report.ResolvedBy,
+		&report.ResolutionNote,
+		&report.CreatedAt,
+		&report.ResolvedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -19,9 +19,40 @@ type Session struct {
 	AccessToken  string
 	UserAgent    *string
 	IPAddress    *string
+	DeviceID     *string
 	ExpiresAt    time.Time
 	CreatedAt    time.Time
 	RevokedAt    *time.Time
+	RotatedAt    *time.Time
+
+	// AuthenticatedAt is when the user logged in. Rotations carry it over;
+	// Create defaults it to now.
+	AuthenticatedAt time.Time
+}
+
+const sessionColumns = `id, user_id, refresh_token, access_token, user_agent, ip_address::text,
+		device_id, expires_at, created_at, revoked_at, rotated_at, authenticated_at`
+
+func scanSession(row pgx.Row) (*Session, error) {
+	session := &Session{}
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshToken,
+		&session.AccessToken,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.DeviceID,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&session.RevokedAt,
+		&session.RotatedAt,
+		&session.AuthenticatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
 }
 
 type SessionRepository struct {
@@ -33,45 +64,46 @@ func NewSessionRepository(db *pgxpool.Pool) *SessionRepository {
 }
 
 func (r *SessionRepository) Create(ctx context.Context, session *Session) error {
+	return insertSession(ctx, r.db, session)
+}
+
+// insertSession is Create on db, which may be a transaction.
+func insertSession(ctx context.Context, db interface {
+	QueryRow(context.Context, string, ...any) pgx.Row
+}, session *Session) error {
 	query := `
-		INSERT INTO sessions (user_id, refresh_token, access_token, user_agent, ip_address, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at
+		INSERT INTO sessions (user_id, refresh_token, access_token, user_agent, ip_address, device_id, expires_at, authenticated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, NOW()))
+		RETURNING id, created_at, authenticated_at
 	`
 
-	err := r.db.QueryRow(ctx, query,
+	var authenticatedAt *time.Time
+	if !session.AuthenticatedAt.IsZero() {
+		authenticatedAt = &session.AuthenticatedAt
+	}
+
+	err := db.QueryRow(ctx, query,
 		session.UserID,
 		session.RefreshToken,
 		session.AccessToken,
 		session.UserAgent,
 		session.IPAddress,
+		session.DeviceID,
 		session.ExpiresAt,
-	).Scan(&session.ID, &session.CreatedAt)
+		authenticatedAt,
+	).Scan(&session.ID, &session.CreatedAt, &session.AuthenticatedAt)
 
 	return err
 }
 
 func (r *SessionRepository) GetByRefreshToken(ctx context.Context, refreshToken string) (*Session, error) {
 	query := `
-		SELECT id, user_id, refresh_token, access_token, user_agent, ip_address::text, 
-		       expires_at, created_at, revoked_at
+		SELECT ` + sessionColumns + `
 		FROM sessions
 		WHERE refresh_token = $1
 	`
 
-	session := &Session{}
-	err := r.db.QueryRow(ctx, query, refreshToken).Scan(
-		&session.ID,
-		&session.UserID,
-		&session.RefreshToken,
-		&session.AccessToken,
-		&session.UserAgent,
-		&session.IPAddress,
-		&session.ExpiresAt,
-		&session.CreatedAt,
-		&session.RevokedAt,
-	)
-
+	session, err := scanSession(r.db.QueryRow(ctx, query, refreshToken))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrSessionNotFound
@@ -90,13 +122,52 @@ func (r *SessionRepository) GetByRefreshToken(ctx context.Context, refreshToken
 	return session, nil
 }
 
+// GetActiveByAccessToken returns the unrevoked, unexpired session that
+// issued accessToken.
+func (r *SessionRepository) GetActiveByAccessToken(ctx context.Context, userID int64, accessToken string) (*Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND access_token = $2 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, userID, accessToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// FindByRefreshToken returns the session regardless of whether it's revoked
+// or expired.
+func (r *SessionRepository) FindByRefreshToken(ctx context.Context, refreshToken string) (*Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE refresh_token = $1
+	`
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, refreshToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
 func (r *SessionRepository) GetAllByUserID(ctx context.Context, userID int64) ([]*Session, error) {
 	query := `
-		SELECT id, user_id, refresh_token, access_token, user_agent, ip_address::text,
-		       expires_at, created_at, revoked_at
+		SELECT ` + sessionColumns + `
 		FROM sessions
 		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 	`
 
 	rows, err := r.db.Query(ctx, query, userID)
@@ -107,19 +178,7 @@ func (r *SessionRepository) GetAllByUserID(ctx context.Context, userID int64) ([
 
 	var sessions []*Session
 	for rows.Next() {
-		session := &Session{}
-		err := rows.Scan(
-			&session.ID,
-			&session.UserID,
-			&session.RefreshToken,
-			&session.AccessToken,
-			&session.UserAgent,
-			&session.IPAddress,
-			&session.ExpiresAt,
-			&session.CreatedAt,
-			&session.RevokedAt,
-		)
-
+		session, err := scanSession(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -127,7 +186,37 @@ func (r *SessionRepository) GetAllByUserID(ctx context.Context, userID int64) ([
 		sessions = append(sessions, session)
 	}
 
-	return sessions, nil
+	return sessions, rows.Err()
+}
+
+// EachByUserID calls fn for every session of userID created since since,
+// revoked and expired ones included, newest first. Rows are streamed so a
+// long history isn't loaded into memory at once.
+func (r *SessionRepository) EachByUserID(ctx context.Context, userID int64, since time.Time, fn func(*Session) error) error {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND created_at >= $2
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
 }
 
 func (r *SessionRepository) Revoke(ctx context.Context, refreshToken string) error {
@@ -149,6 +238,40 @@ func (r *SessionRepository) Revoke(ctx context.Context, refreshToken string) err
 	return nil
 }
 
+// Rotate revokes a session because its refresh token was exchanged for a new
+// one. Only one caller can rotate a given session; the others get
+// ErrSessionNotFound.
+// Rotate ends the session of refreshToken and creates next in its place,
+// in one transaction, so a failed refresh leaves the old session usable.
+func (r *SessionRepository) Rotate(ctx context.Context, refreshToken string, next *Session) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP, rotated_at = CURRENT_TIMESTAMP
+		WHERE refresh_token = $1 AND revoked_at IS NULL
+	`
+
+	result, err := tx.Exec(ctx, query, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+
+	if err := insertSession(ctx, tx, next); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
 func (r *SessionRepository) RevokeAllByUserID(ctx context.Context, userID int64) error {
 	query := `
 		UPDATE sessions
@@ -192,3 +315,15 @@ func (r *SessionRepository) UpdateAccessToken(ctx context.Context, refreshToken,
 
 	return nil
 }
+
+func (r *SessionRepository) CountActiveByUserID(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+
+	var count int
+	err := r.db.QueryRow(ctx, query, userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+)
+
+func TestSessionStoresMaxLengthTokens(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := NewUserRepository(db).Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	username := strings.Repeat("ж", jwt.MaxUsernameLength)
+	email := strings.Repeat("a", jwt.MaxEmailLength-len("@example.com")) + "@example.com"
+	tm := jwt.NewTokenManager("test-secret", 0)
+	access, _, err := tm.GenerateAccessToken(user.ID, username, email, true, &jwt.Entitlements{Plan: "pro"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, expiresAt, err := tm.GenerateRefreshToken(user.ID, username, email, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := NewSessionRepository(db)
+	err = sessions.Create(ctx, &Session{
+		UserID:       user.ID,
+		RefreshToken: refresh,
+		AccessToken:  access,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("create session with %d/%d character tokens: %v", len(access), len(refresh), err)
+	}
+
+	session, err := sessions.GetByRefreshToken(ctx, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.AccessToken != access {
+		t.Fatal("access token was truncated")
+	}
+}
+
+func TestRotateRollsBackWhenNewSessionFails(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := NewUserRepository(db).Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := NewSessionRepository(db)
+	old := &Session{UserID: user.ID, RefreshToken: "old-refresh", AccessToken: "old-access", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := sessions.Create(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replacement reuses the old refresh token, which is unique.
+	next := &Session{UserID: user.ID, RefreshToken: "old-refresh", AccessToken: "new-access", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := sessions.Rotate(ctx, "old-refresh", next); err == nil {
+		t.Fatal("Rotate succeeded with a conflicting new session")
+	}
+
+	session, err := sessions.GetByRefreshToken(ctx, "old-refresh")
+	if err != nil {
+		t.Fatalf("old session unusable after a failed rotation: %v", err)
+	}
+	if session.RotatedAt != nil {
+		t.Error("old session marked rotated after a failed rotation")
+	}
+}
@@ -0,0 +1,31 @@
+package repository
+
+import "context"
+
+// AvatarOwners returns the avatar key ("" for none) of each of the given
+// users that still exists, soft-deleted ones included. Users missing from
+// the result have been purged or never existed.
+func (r *UserRepository) AvatarOwners(ctx context.Context, userIDs []int64) (map[int64]string, error) {
+	query := `
+		SELECT id, COALESCE(avatar_url, '')
+		FROM users
+		WHERE id = ANY($1)
+	`
+
+	rows, err := r.db.Query(ctx, query, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners := make(map[int64]string, len(userIDs))
+	for rows.Next() {
+		var id int64
+		var avatar string
+		if err := rows.Scan(&id, &avatar); err != nil {
+			return nil, err
+		}
+		owners[id] = avatar
+	}
+	return owners, rows.Err()
+}
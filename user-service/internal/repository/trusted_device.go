@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+var ErrTrustedDeviceNotFound = errors.New("trusted device not found")
+
+type TrustedDeviceRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTrustedDeviceRepository(db *pgxpool.Pool) *TrustedDeviceRepository {
+	return &TrustedDeviceRepository{db: db}
+}
+
+// Trust marks deviceID as trusted for userID, provable with the secret
+// hashing to secretHash. Trusting a device again replaces its secret and,
+// if one is given, its label.
+func (r *TrustedDeviceRepository) Trust(ctx context.Context, userID int64, deviceID, secretHash string, label *string) (*models.TrustedDevice, error) {
+	query := `
+		INSERT INTO trusted_devices (user_id, device_id, secret_hash, label)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, device_id) DO UPDATE SET
+			secret_hash = EXCLUDED.secret_hash,
+			label = COALESCE(EXCLUDED.label, trusted_devices.label)
+		RETURNING id, user_id, device_id, label, created_at, last_used_at
+	`
+
+	device := &models.TrustedDevice{}
+	err := r.db.QueryRow(ctx, query, userID, deviceID, secretHash, label).Scan(
+		&device.ID,
+		&device.UserID,
+		&device.DeviceID,
+		&device.Label,
+		&device.CreatedAt,
+		&device.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// Touch records a login from deviceID and reports whether it is trusted,
+// which takes the secret issued when it was trusted.
+func (r *TrustedDeviceRepository) Touch(ctx context.Context, userID int64, deviceID, secretHash string) (bool, error) {
+	query := `
+		UPDATE trusted_devices
+		SET last_used_at = NOW()
+		WHERE user_id = $1 AND device_id = $2 AND secret_hash = $3
+	`
+	result, err := r.db.Exec(ctx, query, userID, deviceID, secretHash)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+func (r *TrustedDeviceRepository) ListByUserID(ctx context.Context, userID int64) ([]*models.TrustedDevice, error) {
+	query := `
+		SELECT id, user_id, device_id, label, created_at, last_used_at
+		FROM trusted_devices
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []*models.TrustedDevice{}
+	for rows.Next() {
+		device := &models.TrustedDevice{}
+		if err := rows.Scan(
+			&device.ID,
+			&device.UserID,
+			&device.DeviceID,
+			&device.Label,
+			&device.CreatedAt,
+			&device.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+func (r *TrustedDeviceRepository) Untrust(ctx context.Context, userID, id int64) error {
+	query := `
+		DELETE FROM trusted_devices
+		WHERE id = $1 AND user_id = $2
+		RETURNING id
+	`
+	err := r.db.QueryRow(ctx, query, id, userID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTrustedDeviceNotFound
+	}
+	return err
+}
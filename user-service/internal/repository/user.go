@@ -3,19 +3,59 @@ package repository
 import (
 	"context"
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"golang.org/x/sync/singleflight"
 )
 
 var ErrUserNotFound = errors.New("user not found")
 var ErrUserAlreadyExists = errors.New("user already exists")
 
+const userColumns = `id, username, email, password_hash, display_name, avatar_url,
+		bio, status, role, plan, COALESCE(is_verified, FALSE), email_preferences, last_seen_at, created_at, updated_at, deleted_at`
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.DisplayName,
+		&user.AvatarURL,
+		&user.Bio,
+		&user.Status,
+		&user.Role,
+		&user.Plan,
+		&user.IsVerified,
+		&user.EmailPreferences,
+		&user.LastSeenAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.DeletedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
 type UserRepository struct {
 	db *pgxpool.Pool
+
+	// lookups coalesces concurrent identical reads on hot paths, so a
+	// popular profile costs one query per burst instead of one per request.
+	lookups singleflight.Group
 }
 
 func NewUserRepository(db *pgxpool.Pool) *UserRepository {
@@ -26,7 +66,7 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	query := `
 		INSERT INTO users (username, email, password_hash, display_name, status)
 		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at
+		RETURNING id, role, plan, email_preferences, created_at, updated_at
 	`
 
 	err := r.db.QueryRow(ctx, query,
@@ -34,8 +74,8 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 		user.Email,
 		user.PasswordHash,
 		user.DisplayName,
-		"offline",
-	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		models.StatusOffline,
+	).Scan(&user.ID, &user.Role, &user.Plan, &user.EmailPreferences, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate") {
@@ -44,112 +84,298 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 		return err
 	}
 
-	user.Status = "offline"
+	user.Status = models.StatusOffline
 	return nil
 }
 
-func (r *UserRepository) GetByID(ctx context.Context, id int64) (*models.User, error) {
-	query := `
-		SELECT id, username, email, password_hash, display_name, avatar_url, 
-		       bio, status, last_seen_at, created_at, updated_at
-		FROM users
-		WHERE id = $1 AND deleted_at IS NULL
-	`
+// lookupTimeout bounds a query shared through UserRepository.lookups. The
+// query doesn't belong to any one caller, so no caller's deadline applies.
+const lookupTimeout = 5 * time.Second
+
+// coalesce runs fn once for all concurrent callers with the same key. fn gets
+// its own context limited to timeout; a caller whose ctx ends stops waiting
+// and gets ctx.Err() while the others keep the shared call.
+func coalesce[T any](ctx context.Context, g *singleflight.Group, key string, timeout time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	ch := g.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return fn(ctx)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			var zero T
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
 
-	user := &models.User{}
-	err := r.db.QueryRow(ctx, query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.DisplayName,
-		&user.AvatarURL,
-		&user.Bio,
-		&user.Status,
-		&user.LastSeenAt,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+func (r *UserRepository) GetByID(ctx context.Context, id int64) (*models.User, error) {
+	return r.getByID(ctx, id)
+}
 
+// GetByIDShared is GetByID sharing one query between concurrent callers
+// asking for the same user. A caller may join a query that started before
+// its own write, so only use it where a slightly stale user is fine, such
+// as showing a profile. Each caller gets its own deep copy of the result.
+func (r *UserRepository) GetByIDShared(ctx context.Context, id int64) (*models.User, error) {
+	user, err := coalesce(ctx, &r.lookups, "user:"+strconv.FormatInt(id, 10), lookupTimeout, func(ctx context.Context) (*models.User, error) {
+		return r.getByID(ctx, id)
+	})
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrUserNotFound
-		}
 		return nil, err
 	}
+	return copyUser(user), nil
+}
 
-	return user, nil
+// copyUser copies u along with the values behind its pointer fields.
+func copyUser(u *models.User) *models.User {
+	c := *u
+	c.DisplayName = copyPtr(u.DisplayName)
+	c.AvatarURL = copyPtr(u.AvatarURL)
+	c.Bio = copyPtr(u.Bio)
+	c.LastSeenAt = copyPtr(u.LastSeenAt)
+	c.DeletedAt = copyPtr(u.DeletedAt)
+	return &c
+}
+
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func (r *UserRepository) getByID(ctx context.Context, id int64) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	return scanUser(r.db.QueryRow(ctx, query, id))
 }
 
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, avatar_url,
-		       bio, status, last_seen_at, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = $1 AND deleted_at IS NULL
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRow(ctx, query, email).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.DisplayName,
-		&user.AvatarURL,
-		&user.Bio,
-		&user.Status,
-		&user.LastSeenAt,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	return scanUser(r.db.QueryRow(ctx, query, email))
+}
+
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE username = $1 AND deleted_at IS NULL
+	`
+
+	return scanUser(r.db.QueryRow(ctx, query, username))
+}
+
+// GetByUsernameFold matches username case-insensitively. Usernames are
+// unique only case-sensitively, so it returns ErrUserNotFound unless exactly
+// one user matches.
+func (r *UserRepository) GetByUsernameFold(ctx context.Context, username string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE LOWER(username) = LOWER($1) AND deleted_at IS NULL
+		LIMIT 2
+	`
+
+	return r.getSingle(ctx, query, username)
+}
+
+// GetByEmailFold is the email counterpart of GetByUsernameFold.
+func (r *UserRepository) GetByEmailFold(ctx context.Context, email string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL
+		LIMIT 2
+	`
 
+	return r.getSingle(ctx, query, email)
+}
+
+func (r *UserRepository) getSingle(ctx context.Context, query string, args ...any) (*models.User, error) {
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var found *models.User
+	for rows.Next() {
+		if found != nil {
 			return nil, ErrUserNotFound
 		}
+		found, err = scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if found == nil {
+		return nil, ErrUserNotFound
+	}
 
-	return user, nil
+	return found, nil
 }
 
-func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
-	query := `
-		SELECT id, username, email, password_hash, display_name, avatar_url,
-		       bio, status, last_seen_at, created_at, updated_at
+// ListUsersParams selects a page of users, newest first. After takes
+// precedence over Offset.
+type ListUsersParams struct {
+	Limit  int
+	Offset int
+	After  *UserCursor
+}
+
+// List returns up to params.Limit users and the cursor of the next page, or
+// nil when this is the last one.
+func (r *UserRepository) List(ctx context.Context, params ListUsersParams) ([]*models.User, *UserCursor, error) {
+	var rows pgx.Rows
+	var err error
+
+	if params.After != nil {
+		query := `
+			SELECT ` + userColumns + `
+			FROM users
+			WHERE deleted_at IS NULL AND (created_at, id) < ($1, $2)
+			ORDER BY created_at DESC, id DESC
+			LIMIT $3
+		`
+		rows, err = r.db.Query(ctx, query, params.After.CreatedAt, params.After.ID, params.Limit+1)
+	} else {
+		query := `
+			SELECT ` + userColumns + `
+			FROM users
+			WHERE deleted_at IS NULL
+			ORDER BY created_at DESC, id DESC
+			LIMIT $1 OFFSET $2
+		`
+		rows, err = r.db.Query(ctx, query, params.Limit+1, params.Offset)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// One extra row was fetched to learn whether another page exists.
+	var next *UserCursor
+	if len(users) > params.Limit {
+		users = users[:params.Limit]
+		last := users[len(users)-1]
+		next = &UserCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	return users, next, nil
+}
+
+// likeEscaper escapes LIKE wildcards so user input only matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Search matches query as a case-insensitive prefix of the username or
+// display name, ordered by username. It returns one page of public
+// profiles and the total number of matches.
+func (r *UserRepository) Search(ctx context.Context, query string, limit, offset int) ([]*models.PublicUser, int, error) {
+	pattern := likeEscaper.Replace(query) + "%"
+
+	countQuery := `
+		SELECT COUNT(*)
 		FROM users
-		WHERE username = $1 AND deleted_at IS NULL
+		WHERE deleted_at IS NULL AND (username ILIKE $1 OR display_name ILIKE $1)
 	`
+	var total int
+	if err := r.db.QueryRow(ctx, countQuery, pattern).Scan(&total); err != nil {
+		return nil, 0, err
+	}
 
-	user := &models.User{}
-	err := r.db.QueryRow(ctx, query, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.DisplayName,
-		&user.AvatarURL,
-		&user.Bio,
-		&user.Status,
-		&user.LastSeenAt,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
+	searchQuery := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE deleted_at IS NULL AND (username ILIKE $1 OR display_name ILIKE $1)
+		ORDER BY username, id
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.Query(ctx, searchQuery, pattern, limit, offset)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrUserNotFound
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]*models.PublicUser, 0, limit)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
 		}
-		return nil, err
+		users = append(users, user.Public())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
 	}
 
-	return user, nil
+	return users, total, nil
+}
+
+// UsernameTaken also counts soft-deleted users, matching the unique constraint.
+func (r *UserRepository) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`
+
+	var taken bool
+	err := r.db.QueryRow(ctx, query, username).Scan(&taken)
+	return taken, err
+}
+
+// EmailTaken also counts soft-deleted users, matching the unique constraint.
+func (r *UserRepository) EmailTaken(ctx context.Context, email string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
+
+	var taken bool
+	err := r.db.QueryRow(ctx, query, email).Scan(&taken)
+	return taken, err
 }
 
 func (r *UserRepository) GetAvatarURL(ctx context.Context, userID int64) (string, error) {
+	return r.getAvatarURL(ctx, userID)
+}
+
+// GetAvatarURLShared coalesces concurrent lookups like GetByIDShared, with
+// the same caveat about stale results.
+func (r *UserRepository) GetAvatarURLShared(ctx context.Context, userID int64) (string, error) {
+	return coalesce(ctx, &r.lookups, "avatar:"+strconv.FormatInt(userID, 10), lookupTimeout, func(ctx context.Context) (string, error) {
+		return r.getAvatarURL(ctx, userID)
+	})
+}
+
+func (r *UserRepository) getAvatarURL(ctx context.Context, userID int64) (string, error) {
 	query := `
-		SELECT avatar_url
+		SELECT COALESCE(avatar_url, '')
 		FROM users
 		WHERE id = $1 AND deleted_at IS NULL
 	`
@@ -166,10 +392,38 @@ func (r *UserRepository) GetAvatarURL(ctx context.Context, userID int64) (string
 	return avatarURL, nil
 }
 
+// GetAvatarURLs returns the avatar object keys of the given users. Users
+// without an avatar, and unknown users, are left out.
+func (r *UserRepository) GetAvatarURLs(ctx context.Context, userIDs []int64) (map[int64]string, error) {
+	query := `
+		SELECT id, avatar_url
+		FROM users
+		WHERE id = ANY($1) AND deleted_at IS NULL AND avatar_url IS NOT NULL AND avatar_url <> ''
+	`
+
+	rows, err := r.db.Query(ctx, query, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := make(map[int64]string, len(userIDs))
+	for rows.Next() {
+		var id int64
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			return nil, err
+		}
+		urls[id] = url
+	}
+
+	return urls, rows.Err()
+}
+
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET display_name = $2, bio = $3, status = $4, updated_at = CURRENT_TIMESTAMP
+		SET display_name = $2, bio = $3, status = $4, email_preferences = $5, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1 AND deleted_at IS NULL
 		RETURNING updated_at
 	`
@@ -179,6 +433,7 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 		user.DisplayName,
 		user.Bio,
 		user.Status,
+		user.EmailPreferences,
 	).Scan(&user.UpdatedAt)
 
 	if err != nil {
@@ -196,25 +451,32 @@ func (r *UserRepository) UpdateAvatar(ctx context.Context, userID int64, objectN
 		UPDATE users
 		SET avatar_url = $2, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1 AND deleted_at IS NULL
-		RETURNING updated_at
 	`
-	user, err := r.GetByID(ctx, userID)
+	result, err := r.db.Exec(ctx, query, userID, objectName)
 	if err != nil {
 		return err
 	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
 
-	err = r.db.QueryRow(ctx, query,
-		userID,
-		objectName,
-	).Scan(&user.UpdatedAt)
+	return nil
+}
 
+// ClearAvatar unsets userID's avatar. Clearing an absent avatar succeeds.
+func (r *UserRepository) ClearAvatar(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users
+		SET avatar_url = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	result, err := r.db.Exec(ctx, query, userID)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return ErrUserNotFound
-		}
 		return err
 	}
-
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
 	return nil
 }
 
@@ -238,3 +500,68 @@ func (r *UserRepository) MarkVerified(ctx context.Context, userID int64) error {
 	_, err := r.db.Exec(ctx, query, userID)
 	return err
 }
+
+// ChangePassword sets userID's password and, in the same transaction,
+// revokes every session but keepSessionID (0 keeps none) and every API
+// token, and spends any outstanding password resets.
+func (r *UserRepository) ChangePassword(ctx context.Context, userID int64, passwordHash string, keepSessionID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE users
+		SET password_hash = $2, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	result, err := tx.Exec(ctx, query, userID, passwordHash)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	query = `
+		UPDATE password_resets
+		SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, userID, keepSessionID); err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE api_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdatePasswordHash replaces oldHash with newHash, e.g. to raise its cost.
+// It does nothing if the password changed since oldHash was read.
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, userID int64, oldHash, newHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $3
+		WHERE id = $1 AND password_hash = $2
+	`
+	_, err := r.db.Exec(ctx, query, userID, oldHash, newHash)
+	return err
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+	"golang.org/x/sync/singleflight"
+)
+
+func TestCoalesceSharesOneCall(t *testing.T) {
+	const callers = 50
+
+	var g singleflight.Group
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return "avatars/1", nil
+	}
+
+	results := make(chan string, callers)
+	var wg sync.WaitGroup
+	call := func() {
+		defer wg.Done()
+		v, err := coalesce(context.Background(), &g, "avatar:1", time.Second, fn)
+		if err != nil {
+			t.Errorf("coalesce: %v", err)
+		}
+		results <- v
+	}
+
+	wg.Add(1)
+	go call()
+	<-started
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go call()
+	}
+	// Give the late callers time to join the call still in flight.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("backend called %d times, want 1", n)
+	}
+	for v := range results {
+		if v != "avatars/1" {
+			t.Errorf("result = %q, want avatars/1", v)
+		}
+	}
+}
+
+func TestCoalesceCallerCancellationLeavesSharedCall(t *testing.T) {
+	var g singleflight.Group
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 42, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	other := make(chan error, 1)
+	go func() {
+		v, err := coalesce(context.Background(), &g, "k", time.Second, fn)
+		if err == nil && v != 42 {
+			err = errors.New("wrong value")
+		}
+		other <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := coalesce(ctx, &g, "k", time.Second, fn); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller err = %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if err := <-other; err != nil {
+		t.Fatalf("remaining caller: %v", err)
+	}
+}
+
+func TestCoalesceTimesOutSharedCall(t *testing.T) {
+	var g singleflight.Group
+	fn := func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+
+	_, err := coalesce(context.Background(), &g, "k", 10*time.Millisecond, fn)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestCopyUserIsDeep(t *testing.T) {
+	name := "Alice"
+	seen := time.Now()
+	shared := &models.User{ID: 1, DisplayName: &name, LastSeenAt: &seen}
+
+	a := copyUser(shared)
+	b := copyUser(shared)
+	*a.DisplayName = "Mallory"
+	*a.LastSeenAt = time.Time{}
+
+	if *b.DisplayName != "Alice" || *shared.DisplayName != "Alice" {
+		t.Error("changing one copy's display name leaked into another")
+	}
+	if !b.LastSeenAt.Equal(seen) {
+		t.Error("changing one copy's last_seen_at leaked into another")
+	}
+	if b.AvatarURL != nil {
+		t.Error("nil pointer field became non-nil")
+	}
+}
+
+func TestGetByIDSeesOwnWritesDuringSharedLookup(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+	users := NewUserRepository(db)
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	// A shared lookup that read alice before the write below is still in
+	// flight.
+	release := make(chan struct{})
+	stale := users.lookups.DoChan(fmt.Sprintf("user:%d", user.ID), func() (any, error) {
+		<-release
+		return &models.User{ID: user.ID, Username: "alice"}, nil
+	})
+	staleAvatar := users.lookups.DoChan(fmt.Sprintf("avatar:%d", user.ID), func() (any, error) {
+		<-release
+		return "", nil
+	})
+	defer func() {
+		close(release)
+		<-stale
+		<-staleAvatar
+	}()
+
+	if err := users.UpdateAvatar(ctx, user.ID, "avatars/new.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Joining the stale lookup would block until the deadline.
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	got, err := users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AvatarURL == nil || *got.AvatarURL != "avatars/new.png" {
+		t.Errorf("GetByID after the update: avatar = %v, want avatars/new.png", got.AvatarURL)
+	}
+	url, err := users.GetAvatarURL(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "avatars/new.png" {
+		t.Errorf("GetAvatarURL after the update = %q, want avatars/new.png", url)
+	}
+}
+
+func TestUpdateAvatarUnknownUser(t *testing.T) {
+	users := NewUserRepository(testdb.New(t))
+
+	if err := users.UpdateAvatar(context.Background(), 404, "avatars/x.png"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+	users := NewUserRepository(db)
+
+	create := func(username, displayName string) *models.User {
+		t.Helper()
+		u := &models.User{Username: username, Email: username + "@example.com", PasswordHash: "x"}
+		if displayName != "" {
+			u.DisplayName = &displayName
+		}
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	create("alice", "")
+	create("Alfred", "")
+	create("bob", "Alina B")
+	create("carol", "")
+	create("al_x", "")
+	create("alyx", "")
+	create("percent", "100%_sure")
+	create("x100pct", "100 percent")
+	deleted := create("alastair", "")
+	if _, err := db.Exec(ctx, `UPDATE users SET deleted_at = NOW() WHERE id = $1`, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query string, limit, offset int) ([]string, int) {
+		t.Helper()
+		found, total, err := users.Search(ctx, query, limit, offset)
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		names := make([]string, 0, len(found))
+		for _, u := range found {
+			names = append(names, u.Username)
+		}
+		return names, total
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Case-insensitive prefix of either name; deleted users never match.
+		{"AL", []string{"Alfred", "al_x", "alice", "alyx", "bob"}},
+		{"ali", []string{"alice", "bob"}},
+		{"lice", nil},
+		// Wildcards only match themselves.
+		{"al_", []string{"al_x"}},
+		{"100%", []string{"percent"}},
+		{"%", nil},
+	}
+	for _, tt := range tests {
+		// The order of mixed case and punctuation depends on the collation.
+		got, total := search(tt.query, 10, 0)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) || total != len(tt.want) {
+			t.Errorf("search %q = %v (total %d), want %v", tt.query, got, total, tt.want)
+		}
+	}
+
+	// Pages split the ordered matches, and every page reports the same total.
+	var paged []string
+	for offset := 0; ; offset += 2 {
+		page, total := search("al", 2, offset)
+		if total != 5 {
+			t.Errorf("offset %d: total = %d, want 5", offset, total)
+		}
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, page...)
+	}
+	if all, _ := search("al", 10, 0); !slices.Equal(paged, all) {
+		t.Errorf("pages = %v, want %v", paged, all)
+	}
+}
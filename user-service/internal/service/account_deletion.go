@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DeleteAccount deactivates the account and signs it out everywhere. It is
+// purged by AccountPurger once the grace period passes unless the user
+// reactivates it first. It returns when the purge is due.
+func (s *AuthService) DeleteAccount(ctx context.Context, userID int64) (time.Time, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.blacklistAccessTokens(ctx, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	deletedAt, err := s.userRepo.SoftDelete(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	purgeAt := deletedAt.Add(s.deletionGrace)
+
+	if err := s.emailSender.SendAccountDeletionEmail(user.Email, user.Username, purgeAt); err != nil {
+		log.Printf("failed to send deletion confirmation to user %d: %v", userID, err)
+	}
+
+	return purgeAt, nil
+}
+
+// ReactivateAccount cancels a pending deletion, given the account's
+// credentials, and signs the user in.
+func (s *AuthService) ReactivateAccount(ctx context.Context, req *dto.LoginRequest, client ClientInfo) (*dto.AuthResponse, error) {
+	user, err := s.userRepo.GetDeletedByLogin(ctx, strings.TrimSpace(req.Login), time.Now().Add(-s.deletionGrace))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrNothingToReactivate
+		}
+		return nil, err
+	}
+
+	if err := s.acquireHashSlot(); err != nil {
+		return nil, err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	s.releaseHashSlot()
+	if err != nil {
+		return nil, ErrNothingToReactivate
+	}
+
+	if err := s.userRepo.Restore(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	user.DeletedAt = nil
+	log.Printf("user %d reactivated their account", user.ID)
+
+	if s.requireVerified && !user.IsVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	return s.createSession(ctx, user, client, s.refreshTTL)
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+const purgeBatchSize = 100
+
+// AccountPurger permanently removes accounts whose deletion grace period
+// has passed, along with their stored objects, and reminds users shortly
+// before that happens. Only one instance works at a time.
+type AccountPurger struct {
+	users   *repository.UserRepository
+	storage *Minio
+	mailer  EmailSender
+	locker  *RedisLocker
+
+	grace        time.Duration
+	remindBefore time.Duration
+	interval     time.Duration
+}
+
+func NewAccountPurger(users *repository.UserRepository, storage *Minio, mailer EmailSender, locker *RedisLocker, grace, remindBefore, interval time.Duration) *AccountPurger {
+	return &AccountPurger{
+		users:        users,
+		storage:      storage,
+		mailer:       mailer,
+		locker:       locker,
+		grace:        grace,
+		remindBefore: remindBefore,
+		interval:     interval,
+	}
+}
+
+func (p *AccountPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.runOnce(ctx)
+		}
+	}
+}
+
+func (p *AccountPurger) runOnce(ctx context.Context) {
+	release, err := p.locker.Acquire(ctx, "account_purge", p.interval)
+	if err != nil {
+		if !errors.Is(err, ErrLockHeld) {
+			log.Printf("account purge: unable to acquire lock: %v", err)
+		}
+		return
+	}
+	defer release()
+
+	if p.remindBefore > 0 && p.remindBefore < p.grace {
+		p.sendReminders(ctx)
+	}
+	p.purge(ctx)
+}
+
+func (p *AccountPurger) sendReminders(ctx context.Context) {
+	users, err := p.users.ListDeletedBefore(ctx, time.Now().Add(p.remindBefore-p.grace), true, purgeBatchSize)
+	if err != nil {
+		log.Printf("account purge: listing reminders failed: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		purgeAt := user.DeletedAt.Add(p.grace)
+		if err := p.mailer.SendAccountDeletionReminderEmail(user.Email, user.Username, purgeAt); err != nil {
+			log.Printf("account purge: reminder to user %d failed: %v", user.ID, err)
+			continue
+		}
+		if err := p.users.MarkDeletionReminderSent(ctx, user.ID); err != nil {
+			log.Printf("account purge: marking reminder for user %d failed: %v", user.ID, err)
+		}
+	}
+}
+
+func (p *AccountPurger) purge(ctx context.Context) {
+	users, err := p.users.ListDeletedBefore(ctx, time.Now().Add(-p.grace), false, purgeBatchSize)
+	if err != nil {
+		log.Printf("account purge: listing accounts failed: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		var avatar string
+		if user.AvatarURL != nil {
+			avatar = *user.AvatarURL
+		}
+
+		// Objects go first: a failed purge is retried next run, while rows
+		// deleted before their objects would leave the objects orphaned.
+		if err := p.storage.RemoveUserObjects(ctx, user.ID, avatar); err != nil {
+			log.Printf("account purge: removing objects of user %d failed: %v", user.ID, err)
+			continue
+		}
+		if err := p.users.Purge(ctx, user.ID); err != nil {
+			log.Printf("account purge: deleting user %d failed: %v", user.ID, err)
+			continue
+		}
+		log.Printf("account purge: user %d purged", user.ID)
+	}
+}
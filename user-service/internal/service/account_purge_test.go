@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/s3test"
+)
+
+func TestPurgeSelectsOnlyPastGraceAccounts(t *testing.T) {
+	e := newTestEnv(t, nil)
+	ctx := context.Background()
+
+	store, client := s3test.New(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: e.redis.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	const grace = 30 * 24 * time.Hour
+	p := NewAccountPurger(e.users, &Minio{MinioClient: client}, e.sender, NewRedisLocker(redisClient),
+		grace, 3*24*time.Hour, time.Hour)
+
+	deletedAgo := func(username string, ago time.Duration) int64 {
+		t.Helper()
+		user := e.createUser(t, username)
+		_, err := e.db.Exec(ctx, `UPDATE users SET deleted_at = $1 WHERE id = $2`, time.Now().Add(-ago), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Put(AvatarKey(user.ID, strings.Repeat("ab", 32)), []byte(username), time.Now())
+		return user.ID
+	}
+
+	active := e.createUser(t, "active").ID
+	store.Put(AvatarKey(active, strings.Repeat("ab", 32)), []byte("active"), time.Now())
+	recent := deletedAgo("recent", 24*time.Hour)
+	dueSoon := deletedAgo("duesoon", grace-2*24*time.Hour)
+	expired := deletedAgo("expired", grace+time.Hour)
+
+	p.runOnce(ctx)
+
+	var remaining []int64
+	rows, err := e.db.Query(ctx, `SELECT id FROM users ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		remaining = append(remaining, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int64{active, recent, dueSoon} {
+		if !slices.Contains(remaining, id) {
+			t.Errorf("user %d was purged within the grace period", id)
+		}
+		if len(store.Keys(AvatarUserPrefix(id))) != 1 {
+			t.Errorf("objects of user %d were removed", id)
+		}
+	}
+	if slices.Contains(remaining, expired) {
+		t.Error("account past the grace period was not purged")
+	}
+	if keys := store.Keys(AvatarUserPrefix(expired)); len(keys) != 0 {
+		t.Errorf("purged account left objects %v", keys)
+	}
+	if _, err := e.users.GetByID(ctx, expired); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetByID of purged user = %v, want ErrUserNotFound", err)
+	}
+
+	// Only the account nearing its purge is reminded, and only once.
+	p.runOnce(ctx)
+	var reminded []string
+	for _, email := range e.sender.emails("deletion_reminder") {
+		reminded = append(reminded, email.To)
+	}
+	if !slices.Contains(reminded, "duesoon@example.com") || slices.Contains(reminded, "recent@example.com") {
+		t.Errorf("reminded %v, want the account due for purge", reminded)
+	}
+	if n := strings.Count(strings.Join(reminded, ","), "duesoon@"); n != 1 {
+		t.Errorf("duesoon was reminded %d times, want once", n)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
+)
+
+// apiTokenPrefix marks personal access tokens so they can be told apart from
+// JWTs (and spotted by secret scanners).
+const apiTokenPrefix = "apx_"
+
+var ErrInvalidAPIToken = errors.New("invalid, expired or revoked api token")
+
+// IsAPIToken reports whether token looks like a personal access token
+// rather than a JWT.
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
+
+type APITokenService struct {
+	tokenRepo *repository.APITokenRepository
+}
+
+func NewAPITokenService(tokenRepo *repository.APITokenRepository) *APITokenService {
+	return &APITokenService{tokenRepo: tokenRepo}
+}
+
+// Create issues a token of the form apx_<id>_<secret> and returns it in
+// plaintext alongside the stored record. The plaintext is not recoverable
+// afterwards.
+func (s *APITokenService) Create(ctx context.Context, userID int64, name string, scopes []string, ttl time.Duration) (*models.APIToken, string, error) {
+	var errs validator.FieldErrors
+	for _, scope := range scopes {
+		if !slices.Contains(models.APITokenScopes, scope) {
+			errs = errs.Add("scopes", "unknown scope "+scope)
+		}
+	}
+	if errs != nil {
+		return nil, "", errs
+	}
+	if len(scopes) == 0 {
+		scopes = []string{models.ScopeRead}
+	}
+
+	id, err := randomHex(6)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &models.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    apiTokenPrefix + id,
+		TokenHash: hashAPITokenSecret(secret),
+		Scopes:    scopes,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, "", err
+	}
+
+	return token, token.Prefix + "_" + secret, nil
+}
+
+func (s *APITokenService) List(ctx context.Context, userID int64) ([]*models.APIToken, error) {
+	return s.tokenRepo.ListByUserID(ctx, userID)
+}
+
+func (s *APITokenService) Get(ctx context.Context, userID, id int64) (*models.APIToken, error) {
+	return s.tokenRepo.GetByID(ctx, userID, id)
+}
+
+func (s *APITokenService) Revoke(ctx context.Context, userID, id int64) error {
+	if err := s.tokenRepo.Revoke(ctx, userID, id); err != nil {
+		return err
+	}
+	metrics.Revocations.WithLabelValues("api_token").Inc()
+	return nil
+}
+
+// Authenticate resolves a plaintext personal access token to its record. The
+// secret is compared against the stored hash in constant time.
+func (s *APITokenService) Authenticate(ctx context.Context, plaintext string) (*models.APIToken, error) {
+	rest, ok := strings.CutPrefix(plaintext, apiTokenPrefix)
+	if !ok {
+		return nil, ErrInvalidAPIToken
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidAPIToken
+	}
+
+	token, err := s.tokenRepo.GetByPrefix(ctx, apiTokenPrefix+id)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPITokenNotFound) {
+			return nil, ErrInvalidAPIToken
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(secret)), []byte(token.TokenHash)) != 1 {
+		return nil, ErrInvalidAPIToken
+	}
+	if token.RevokedAt != nil {
+		return nil, ErrInvalidAPIToken
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	return token, nil
+}
+
+// TouchLastUsed records that the token was just used. It's best effort:
+// failing to record it is no reason to fail the request.
+func (s *APITokenService) TouchLastUsed(ctx context.Context, id int64) {
+	_ = s.tokenRepo.TouchLastUsed(ctx, id)
+}
+
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
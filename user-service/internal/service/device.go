@@ -0,0 +1,56 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	maxDeviceIDLength = 128
+
+	// fingerprintPrefix marks device IDs the server derived itself, so they
+	// can't collide with client-provided ones.
+	fingerprintPrefix = "fp:"
+)
+
+// NormalizeDeviceID trims and lowercases a client-provided device ID. IDs
+// that are empty, too long or contain anything but letters, digits and
+// "-_.:" are rejected, as are IDs posing as server fingerprints.
+func NormalizeDeviceID(raw string) (string, bool) {
+	id := strings.ToLower(strings.TrimSpace(raw))
+	if id == "" || len(id) > maxDeviceIDLength || strings.HasPrefix(id, fingerprintPrefix) {
+		return "", false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', strings.ContainsRune("-_.:", r):
+		default:
+			return "", false
+		}
+	}
+	return id, true
+}
+
+// deviceID is the client's device ID, or a fingerprint of its user agent
+// and IP address when it didn't send one. A fingerprint is only as stable
+// as those two values; clients should send X-Device-ID.
+func (c ClientInfo) deviceID() *string {
+	if c.DeviceID != nil {
+		return c.DeviceID
+	}
+	if c.UserAgent == nil && c.IPAddress == nil {
+		return nil
+	}
+
+	var ua, ip string
+	if c.UserAgent != nil {
+		ua = *c.UserAgent
+	}
+	if c.IPAddress != nil {
+		ip = *c.IPAddress
+	}
+	sum := sha256.Sum256([]byte(ua + "\x00" + ip))
+	id := fingerprintPrefix + hex.EncodeToString(sum[:16])
+	return &id
+}
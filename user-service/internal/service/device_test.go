@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+)
+
+func TestNormalizeDeviceID(t *testing.T) {
+	tests := []struct {
+		raw, want string
+		ok        bool
+	}{
+		{"  Phone-1 ", "phone-1", true},
+		{"a1b2:c3_d4.e5", "a1b2:c3_d4.e5", true},
+		{"", "", false},
+		{"has space", "", false},
+		{"emoji-📱", "", false},
+		{"fp:0123456789abcdef", "", false},
+		{strings.Repeat("a", 129), "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := NormalizeDeviceID(tt.raw); got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizeDeviceID(%q) = %q, %v, want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDeviceIDPersistsAcrossRefreshes(t *testing.T) {
+	e := newTestEnv(t, nil)
+	alice := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	sessionDevice := func(refreshToken string) string {
+		t.Helper()
+		var id *string
+		if err := e.db.QueryRow(ctx, `SELECT device_id FROM sessions WHERE refresh_token = $1`, refreshToken).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		if id == nil {
+			return ""
+		}
+		return *id
+	}
+	refreshFrom := func(resp *dto.AuthResponse, client ClientInfo) *dto.AuthResponse {
+		t.Helper()
+		resp, err := e.auth.RefreshToken(ctx, resp.RefreshToken, client)
+		if err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("client provided", func(t *testing.T) {
+		device := "phone-1"
+		resp, err := e.auth.Login(ctx, &dto.LoginRequest{Login: "alice", Password: testPassword}, ClientInfo{DeviceID: &device})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Refreshes that don't repeat the ID, even from elsewhere, keep it.
+		ua, ip := "Other/1.0", "203.0.113.9"
+		for range 3 {
+			resp = refreshFrom(resp, ClientInfo{UserAgent: &ua, IPAddress: &ip})
+			if got := sessionDevice(resp.RefreshToken); got != device {
+				t.Fatalf("refreshed session device = %q, want %q", got, device)
+			}
+		}
+
+		sessions, err := e.auth.GetActiveSessions(ctx, alice.ID, resp.RefreshToken, 50, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, s := range sessions.Sessions {
+			found = found || (s.IsCurrent && s.DeviceID != nil && *s.DeviceID == device)
+		}
+		if !found {
+			t.Error("current session isn't listed with its device ID")
+		}
+	})
+
+	t.Run("fingerprint", func(t *testing.T) {
+		ua, ip := "Browser/2.0", "198.51.100.7"
+		resp, err := e.auth.Login(ctx, &dto.LoginRequest{Login: "alice", Password: testPassword}, ClientInfo{UserAgent: &ua, IPAddress: &ip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fingerprint := sessionDevice(resp.RefreshToken)
+		if !strings.HasPrefix(fingerprint, fingerprintPrefix) {
+			t.Fatalf("device = %q, want a fingerprint", fingerprint)
+		}
+
+		// Moving to another network doesn't re-fingerprint the session.
+		moved := "192.0.2.44"
+		resp = refreshFrom(resp, ClientInfo{UserAgent: &ua, IPAddress: &moved})
+		if got := sessionDevice(resp.RefreshToken); got != fingerprint {
+			t.Errorf("refreshed session device = %q, want %q", got, fingerprint)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+)
+
+var planMaxDocuments = map[string]int{
+	models.PlanFree: 20,
+	models.PlanPro:  1000,
+}
+
+// entitlementsFor resolves the claims embedded in a user's access token.
+// They're re-resolved on every login and refresh, so a plan change reaches
+// downstream services within one access-token lifetime.
+func entitlementsFor(user *models.User) *jwt.Entitlements {
+	plan := user.Plan
+	if _, ok := planMaxDocuments[plan]; !ok {
+		plan = models.PlanFree
+	}
+
+	return &jwt.Entitlements{
+		Plan:         plan,
+		MaxDocuments: planMaxDocuments[plan],
+	}
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+)
+
+func TestLoginEmbedsPlanEntitlements(t *testing.T) {
+	e := newTestEnv(t, nil)
+	user := e.createUser(t, "alice")
+	if _, err := e.db.Exec(context.Background(), `UPDATE users SET plan = $1 WHERE id = $2`, models.PlanPro, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := e.login(t, "alice")
+	claims, err := jwt.NewTokenManager(e.cfg.JWTSecret, e.cfg.JWTAccessMaxAge).ValidateAccessToken(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (jwt.Entitlements{Plan: models.PlanPro, MaxDocuments: planMaxDocuments[models.PlanPro]}); claims.Entitlements == nil || *claims.Entitlements != want {
+		t.Errorf("entitlements = %+v, want %+v", claims.Entitlements, want)
+	}
+}
+
+func TestEntitlementsForUnknownPlan(t *testing.T) {
+	got := entitlementsFor(&models.User{Plan: "enterprise-trial"})
+	if got.Plan != models.PlanFree || got.MaxDocuments != planMaxDocuments[models.PlanFree] {
+		t.Errorf("unknown plan resolved to %+v, want the free plan", got)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testImage is a w×h PNG with a red pixel at (0, 0) and white elsewhere.
+func testImage(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodePNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	return img
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r == 0xffff && g == 0 && b == 0
+}
+
+func TestTransformImageCrop(t *testing.T) {
+	crop := image.Rect(0, 0, 3, 2)
+	data, contentType, err := TransformImage(bytes.NewReader(testImage(t, 8, 6)), ImageTransform{Crop: &crop})
+	if err != nil {
+		t.Fatalf("TransformImage: %v", err)
+	}
+	if contentType != "image/png" {
+		t.Errorf("content type = %q, want image/png", contentType)
+	}
+
+	img := decodePNG(t, data)
+	if got := img.Bounds().Size(); got != image.Pt(3, 2) {
+		t.Errorf("size = %v, want (3,2)", got)
+	}
+	if !isRed(img.At(0, 0)) {
+		t.Error("cropped image lost the marker pixel")
+	}
+}
+
+func TestTransformImageCropOutOfBounds(t *testing.T) {
+	for name, crop := range map[string]image.Rectangle{
+		"past right edge": image.Rect(5, 0, 9, 4),
+		"negative origin": image.Rect(-1, 0, 3, 3),
+		"empty":           image.Rect(2, 2, 2, 2),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := TransformImage(bytes.NewReader(testImage(t, 8, 6)), ImageTransform{Crop: &crop})
+			if !errors.Is(err, ErrCropOutOfBounds) {
+				t.Fatalf("err = %v, want ErrCropOutOfBounds", err)
+			}
+		})
+	}
+}
+
+func TestTransformImageRotate90(t *testing.T) {
+	data, _, err := TransformImage(bytes.NewReader(testImage(t, 8, 6)), ImageTransform{Rotate: 90})
+	if err != nil {
+		t.Fatalf("TransformImage: %v", err)
+	}
+
+	img := decodePNG(t, data)
+	if got := img.Bounds().Size(); got != image.Pt(6, 8) {
+		t.Fatalf("size = %v, want (6,8)", got)
+	}
+	// Turned clockwise, the top-left corner ends up top-right.
+	if !isRed(img.At(5, 0)) {
+		t.Error("marker pixel not at the top-right after a 90° rotation")
+	}
+	if isRed(img.At(0, 0)) {
+		t.Error("marker pixel still at the top-left")
+	}
+}
+
+func TestTransformImageInvalidRotation(t *testing.T) {
+	_, _, err := TransformImage(bytes.NewReader(testImage(t, 2, 2)), ImageTransform{Rotate: 45})
+	if !errors.Is(err, ErrInvalidRotation) {
+		t.Fatalf("err = %v, want ErrInvalidRotation", err)
+	}
+}
+
+// hugePNGHeader is a PNG signature and IHDR chunk declaring a w×h image,
+// with no pixel data behind it.
+func hugePNGHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestTransformImageRejectsOversizedBeforeDecoding(t *testing.T) {
+	_, _, err := TransformImage(bytes.NewReader(hugePNGHeader(100_000, 100_000)), ImageTransform{
+		Rotate:    90,
+		MaxPixels: 40_000_000,
+	})
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("err = %v, want ErrImageTooLarge", err)
+	}
+}
+
+func TestTransformImageAtPixelLimit(t *testing.T) {
+	_, _, err := TransformImage(bytes.NewReader(testImage(t, 8, 6)), ImageTransform{Rotate: 90, MaxPixels: 48})
+	if err != nil {
+		t.Fatalf("image at the limit rejected: %v", err)
+	}
+	_, _, err = TransformImage(bytes.NewReader(testImage(t, 8, 6)), ImageTransform{Rotate: 90, MaxPixels: 47})
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("err = %v, want ErrImageTooLarge", err)
+	}
+}
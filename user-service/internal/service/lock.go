@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrLockHeld = errors.New("lock is held by another operation")
+
+// releaseScript deletes the lock only if it still holds our token, so a slow
+// holder whose lock already expired can't release someone else's.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type RedisLocker struct {
+	redisClient *redis.Client
+}
+
+func NewRedisLocker(redisClient *redis.Client) *RedisLocker {
+	return &RedisLocker{redisClient: redisClient}
+}
+
+// Acquire takes a short-lived lock on key. The returned release func must be
+// called once the protected work is done; the ttl only guards against a
+// holder that crashes.
+func (l *RedisLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+
+	ok, err := l.redisClient.SetNX(ctx, "lock:"+key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockHeld
+	}
+
+	release := func() {
+		_ = releaseScript.Run(context.Background(), l.redisClient, []string{"lock:" + key}, token).Err()
+	}
+	return release, nil
+}
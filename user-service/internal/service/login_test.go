@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+)
+
+func TestLoginIgnoresCaseAndWhitespace(t *testing.T) {
+	e := newTestEnv(t, nil)
+	user := e.createUser(t, "Alice")
+	ctx := context.Background()
+
+	for _, login := range []string{"Alice", "alice", "  ALICE\t", "Alice@example.com", " alice@EXAMPLE.com "} {
+		resp, err := e.auth.Login(ctx, &dto.LoginRequest{Login: login, Password: testPassword}, ClientInfo{})
+		if err != nil {
+			t.Errorf("login as %q: %v", login, err)
+			continue
+		}
+		if resp.User.ID != user.ID {
+			t.Errorf("login as %q got user %d, want %d", login, resp.User.ID, user.ID)
+		}
+	}
+}
+
+func TestLoginCaseFoldNeedsSingleMatch(t *testing.T) {
+	e := newTestEnv(t, nil)
+	lower := e.createUser(t, "bob")
+	upper := e.createUser(t, "Bob")
+	ctx := context.Background()
+
+	// Exact matches still pick their own user.
+	for login, want := range map[string]int64{"bob": lower.ID, "Bob": upper.ID} {
+		resp, err := e.auth.Login(ctx, &dto.LoginRequest{Login: login, Password: testPassword}, ClientInfo{})
+		if err != nil {
+			t.Fatalf("login as %q: %v", login, err)
+		}
+		if resp.User.ID != want {
+			t.Errorf("login as %q got user %d, want %d", login, resp.User.ID, want)
+		}
+	}
+
+	_, err := e.auth.Login(ctx, &dto.LoginRequest{Login: "BOB", Password: testPassword}, ClientInfo{})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("ambiguous case-folded login = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLoginAndRefreshSurviveRedisOutage(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "alice")
+	e.redis.SetError("connection lost")
+
+	resp := e.login(t, "alice")
+	if _, err := e.auth.RefreshToken(context.Background(), resp.RefreshToken, ClientInfo{}); err != nil {
+		t.Fatalf("refresh during a Redis outage: %v", err)
+	}
+}
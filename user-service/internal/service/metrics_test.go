@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
+)
+
+func TestFailedLoginCounted(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	failed := metrics.Logins.WithLabelValues(metrics.ResultInvalidCredentials)
+	succeeded := metrics.Logins.WithLabelValues(metrics.ResultSuccess)
+	failedBefore, succeededBefore := testutil.ToFloat64(failed), testutil.ToFloat64(succeeded)
+
+	if _, err := e.auth.Login(ctx, &dto.LoginRequest{Login: "alice", Password: "wrong-password"}, ClientInfo{}); err == nil {
+		t.Fatal("login with the wrong password succeeded")
+	}
+	if got := testutil.ToFloat64(failed) - failedBefore; got != 1 {
+		t.Errorf("invalid_credentials went up by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(succeeded) - succeededBefore; got != 0 {
+		t.Errorf("success went up by %v on a failed login", got)
+	}
+
+	e.login(t, "alice")
+	if got := testutil.ToFloat64(succeeded) - succeededBefore; got != 1 {
+		t.Errorf("success went up by %v, want 1", got)
+	}
+}
+
+func TestFailedLogoutNotCounted(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	logouts := metrics.Logouts.WithLabelValues("session")
+	before := testutil.ToFloat64(logouts)
+
+	if err := e.auth.Logout(ctx, "not-a-refresh-token", ""); err == nil {
+		t.Fatal("logout with an unknown token succeeded")
+	}
+	if got := testutil.ToFloat64(logouts) - before; got != 0 {
+		t.Errorf("failed logout counted (%v)", got)
+	}
+
+	resp := e.login(t, "alice")
+	if err := e.auth.Logout(ctx, resp.RefreshToken, resp.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(logouts) - before; got != 1 {
+		t.Errorf("logouts went up by %v, want 1", got)
+	}
+}
@@ -2,22 +2,80 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
 )
 
+const BucketName = "avatars"
+
+// Per-user objects are grouped by feature prefix first (<feature>/<userID>/...)
+// so listing, cleanup and lifecycle rules can target one feature at a time.
+const AvatarPrefix = "avatars/"
+
+// AvatarUserPrefix is the prefix holding every avatar object of a user.
+func AvatarUserPrefix(userID int64) string {
+	return fmt.Sprintf("%s%d/", AvatarPrefix, userID)
+}
+
+// AvatarKey is content-addressed: hash is the hex SHA-256 of the image, so a
+// key never changes content and can be cached forever.
+func AvatarKey(userID int64, hash string) string {
+	return AvatarUserPrefix(userID) + hash
+}
+
+// AvatarHash extracts the content hash from a key built by AvatarKey. It
+// returns false for legacy and non content-addressed keys.
+func AvatarHash(userID int64, key string) (string, bool) {
+	hash, ok := strings.CutPrefix(key, AvatarUserPrefix(userID))
+	if !ok || !IsContentHash(hash) {
+		return "", false
+	}
+	return hash, true
+}
+
+func IsContentHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// LegacyAvatarKey is where avatars were stored before per-user prefixes.
+func LegacyAvatarKey(userID int64) string {
+	return fmt.Sprintf("%d/avatar", userID)
+}
+
+// IsLegacyAvatarKey reports whether key uses the old un-namespaced
+// "<userID>/avatar" layout. Such keys stay readable through users.avatar_url
+// and are replaced on the user's next upload.
+func IsLegacyAvatarKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, AvatarPrefix)
+}
+
 type Minio struct {
 	MinioClient *minio.Client
 }
 
-func NewMinioService(cfg *config.Config) *Minio {
-	var err error
+func NewMinioService(ctx context.Context, cfg *config.Config, tlsConfig *tls.Config) *Minio {
+	transport, err := minio.DefaultTransport(cfg.MinioUseTLS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	transport.TLSClientConfig = tlsConfig.Clone()
+
 	minioClient, err := minio.New(cfg.MinioHost+":"+cfg.MinioApiPort, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.MinioUser, cfg.MinioPass, ""),
-		Secure: false,
+		Creds:     credentials.NewStaticV4(cfg.MinioUser, cfg.MinioPass, ""),
+		Secure:    cfg.MinioUseTLS,
+		Transport: transport,
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -25,8 +83,7 @@ func NewMinioService(cfg *config.Config) *Minio {
 
 	log.Printf("minio client is ready: %#v\n", minioClient)
 
-	ctx := context.Background()
-	bucketName := "avatars"
+	bucketName := BucketName
 
 	exists, err := minioClient.BucketExists(ctx, bucketName)
 	if err != nil {
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAvatarKeysUseFeaturePrefix(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	key := AvatarKey(1, hash)
+	if key != "avatars/1/"+hash {
+		t.Fatalf("AvatarKey = %q", key)
+	}
+	if !strings.HasPrefix(key, AvatarPrefix) || !strings.HasPrefix(key, AvatarUserPrefix(1)) {
+		t.Errorf("%q isn't under the avatar and user prefixes", key)
+	}
+	// One user's prefix must not match another user's keys.
+	if strings.HasPrefix(AvatarKey(12, hash), AvatarUserPrefix(1)) {
+		t.Error("user 1's prefix matches user 12's avatar")
+	}
+
+	if got, ok := AvatarHash(1, key); !ok || got != hash {
+		t.Errorf("AvatarHash(1, %q) = %q, %v", key, got, ok)
+	}
+	for _, other := range []string{AvatarKey(2, hash), LegacyAvatarKey(1), "avatars/1/not-a-hash", "exports/1/" + hash} {
+		if _, ok := AvatarHash(1, other); ok {
+			t.Errorf("AvatarHash(1, %q) accepted a key that isn't user 1's avatar", other)
+		}
+	}
+}
+
+func TestLegacyAvatarKeys(t *testing.T) {
+	if !IsLegacyAvatarKey(LegacyAvatarKey(7)) {
+		t.Error("legacy key not recognized")
+	}
+	if IsLegacyAvatarKey(AvatarKey(7, strings.Repeat("0", 64))) || IsLegacyAvatarKey("") {
+		t.Error("namespaced or empty key treated as legacy")
+	}
+}
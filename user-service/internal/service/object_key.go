@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const maxObjectKeyLength = 1024
+
+var ErrInvalidObjectKey = errors.New("invalid object key")
+
+// ValidateObjectKey rejects keys that could escape their prefix or confuse
+// downstream tooling: empty or over-long keys, absolute keys, ".." or "."
+// segments, empty segments, backslashes, invalid UTF-8 and control
+// characters.
+func ValidateObjectKey(key string) error {
+	if key == "" || len(key) > maxObjectKeyLength || !utf8.ValidString(key) {
+		return ErrInvalidObjectKey
+	}
+	if strings.HasPrefix(key, "/") || strings.ContainsRune(key, '\\') {
+		return ErrInvalidObjectKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidObjectKey
+		}
+	}
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return ErrInvalidObjectKey
+		}
+	}
+	return nil
+}
+
+// PutObject stores an object in the bucket after validating its key. All
+// writes should go through it rather than the raw client.
+func (m *Minio) PutObject(ctx context.Context, key string, body io.Reader, size int64, opts minio.PutObjectOptions) error {
+	if err := ValidateObjectKey(key); err != nil {
+		return err
+	}
+	_, err := m.MinioClient.PutObject(ctx, BucketName, key, body, size, opts)
+	return err
+}
+
+// RemoveObject deletes an object from the bucket after validating its key.
+func (m *Minio) RemoveObject(ctx context.Context, key string) error {
+	if err := ValidateObjectKey(key); err != nil {
+		return err
+	}
+	return m.MinioClient.RemoveObject(ctx, BucketName, key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/s3test"
+)
+
+func TestValidateObjectKey(t *testing.T) {
+	valid := []string{
+		AvatarKey(7, strings.Repeat("ab", 32)),
+		LegacyAvatarKey(7),
+		"exports/7/2024-01-01.zip",
+		"documents/7/résumé.pdf",
+		strings.Repeat("a", maxObjectKeyLength),
+	}
+	for _, key := range valid {
+		if err := ValidateObjectKey(key); err != nil {
+			t.Errorf("ValidateObjectKey(%q) = %v, want nil", key, err)
+		}
+	}
+
+	malicious := []string{
+		"",
+		"../secrets",
+		"avatars/7/../../8/avatar",
+		"avatars/./7",
+		"avatars/7/..",
+		"/etc/passwd",
+		"avatars//7",
+		"avatars/7/",
+		`avatars\..\8`,
+		"avatars/7\x00.png",
+		"avatars/7\r\nX-Injected: 1",
+		"avatars/7\x7f",
+		"avatars/\xff\xfe",
+		strings.Repeat("a", maxObjectKeyLength+1),
+	}
+	for _, key := range malicious {
+		if err := ValidateObjectKey(key); !errors.Is(err, ErrInvalidObjectKey) {
+			t.Errorf("ValidateObjectKey(%q) = %v, want ErrInvalidObjectKey", key, err)
+		}
+	}
+}
+
+func TestObjectWritesRejectMaliciousKeys(t *testing.T) {
+	store, client := s3test.New(t)
+	m := &Minio{MinioClient: client}
+	ctx := context.Background()
+
+	store.Put("avatars/8/avatar", []byte("someone else"), time.Now())
+
+	key := "avatars/7/../8/avatar"
+	if err := m.PutObject(ctx, key, bytes.NewReader([]byte("x")), 1, minio.PutObjectOptions{}); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("PutObject(%q) = %v, want ErrInvalidObjectKey", key, err)
+	}
+	if err := m.RemoveObject(ctx, key); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("RemoveObject(%q) = %v, want ErrInvalidObjectKey", key, err)
+	}
+	if data, ok := store.Get("avatars/8/avatar"); !ok || string(data) != "someone else" {
+		t.Error("another user's object was touched")
+	}
+
+	if err := m.PutObject(ctx, "avatars/7/avatar", bytes.NewReader([]byte("x")), 1, minio.PutObjectOptions{}); err != nil {
+		t.Fatalf("PutObject with a valid key: %v", err)
+	}
+	if err := m.RemoveObject(ctx, "avatars/7/avatar"); err != nil || store.Has("avatars/7/avatar") {
+		t.Errorf("RemoveObject with a valid key: %v", err)
+	}
+}
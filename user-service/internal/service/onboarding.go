@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+const onboardingBatchSize = 100
+
+// OnboardingStep is one email of the onboarding sequence. It goes out
+// Delay after the previous step (or after sign-up, for the first one).
+// With OnlyIfIncomplete set it is skipped for users whose profile is
+// already filled in.
+type OnboardingStep struct {
+	Template         string
+	Delay            time.Duration
+	OnlyIfIncomplete bool
+}
+
+// ParseOnboardingSequence parses steps written as "name:delay" or
+// "name:delay:incomplete", e.g. "welcome:0s,tips:72h:incomplete".
+func ParseOnboardingSequence(items []string) ([]OnboardingStep, error) {
+	steps := make([]OnboardingStep, 0, len(items))
+	for _, item := range items {
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid onboarding step %q", item)
+		}
+
+		delay, err := time.ParseDuration(parts[1])
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid delay in onboarding step %q", item)
+		}
+
+		step := OnboardingStep{Template: parts[0], Delay: delay}
+		if len(parts) == 3 {
+			if parts[2] != "incomplete" {
+				return nil, fmt.Errorf("unknown condition in onboarding step %q", item)
+			}
+			step.OnlyIfIncomplete = true
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// Onboarding walks newly registered users through the onboarding email
+// sequence. Completed steps are stored by template name, so the sequence
+// survives restarts and reordering, and every step goes out at most once.
+// Only one instance works at a time.
+type Onboarding struct {
+	users  *repository.UserRepository
+	mailer EmailSender
+	locker *RedisLocker
+
+	steps    []OnboardingStep
+	interval time.Duration
+}
+
+func NewOnboarding(users *repository.UserRepository, mailer EmailSender, locker *RedisLocker, steps []OnboardingStep, interval time.Duration) *Onboarding {
+	return &Onboarding{
+		users:    users,
+		mailer:   mailer,
+		locker:   locker,
+		steps:    steps,
+		interval: interval,
+	}
+}
+
+func (o *Onboarding) Run(ctx context.Context) {
+	if len(o.steps) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.runOnce(ctx)
+		}
+	}
+}
+
+func (o *Onboarding) runOnce(ctx context.Context) {
+	release, err := o.locker.Acquire(ctx, "onboarding", o.interval)
+	if err != nil {
+		if !errors.Is(err, ErrLockHeld) {
+			log.Printf("onboarding: unable to acquire lock: %v", err)
+		}
+		return
+	}
+	defer release()
+
+	previous := ""
+	for _, step := range o.steps {
+		o.sendStep(ctx, step, previous)
+		previous = step.Template
+	}
+}
+
+func (o *Onboarding) sendStep(ctx context.Context, step OnboardingStep, previous string) {
+	users, err := o.users.ListOnboardingDue(ctx, step.Template, previous, time.Now().Add(-step.Delay), onboardingBatchSize)
+	if err != nil {
+		log.Printf("onboarding: listing users for %s failed: %v", step.Template, err)
+		return
+	}
+
+	for _, user := range users {
+		if !step.OnlyIfIncomplete || !profileComplete(user) {
+			// A failed send leaves the step incomplete to be retried
+			// next run.
+			if err := o.mailer.SendOnboardingEmail(user.ID, user.Email, user.Username, step.Template); err != nil {
+				log.Printf("onboarding: %s email to user %d failed: %v", step.Template, user.ID, err)
+				continue
+			}
+		}
+		if err := o.users.CompleteOnboardingStep(ctx, user.ID, step.Template); err != nil {
+			log.Printf("onboarding: completing %s for user %d failed: %v", step.Template, user.ID, err)
+		}
+	}
+}
+
+func profileComplete(user *models.User) bool {
+	return user.DisplayName != nil && *user.DisplayName != "" &&
+		user.AvatarURL != nil && *user.AvatarURL != ""
+}
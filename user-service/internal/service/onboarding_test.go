@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+func TestParseOnboardingSequence(t *testing.T) {
+	steps, err := ParseOnboardingSequence([]string{"welcome:0s", "tips:72h:incomplete"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OnboardingStep{
+		{Template: "welcome"},
+		{Template: "tips", Delay: 72 * time.Hour, OnlyIfIncomplete: true},
+	}
+	if !slices.Equal(steps, want) {
+		t.Errorf("steps = %+v, want %+v", steps, want)
+	}
+
+	for _, item := range []string{"welcome", ":1h", "tips:soon", "tips:-1h", "tips:1h:always", "a:1h:incomplete:x"} {
+		if _, err := ParseOnboardingSequence([]string{item}); err == nil {
+			t.Errorf("%q parsed, want an error", item)
+		}
+	}
+}
+
+func TestProfileComplete(t *testing.T) {
+	name, avatar, empty := "Alice", "https://cdn.example.com/a.png", ""
+	tests := []struct {
+		user *models.User
+		want bool
+	}{
+		{&models.User{DisplayName: &name, AvatarURL: &avatar}, true},
+		{&models.User{DisplayName: &name}, false},
+		{&models.User{AvatarURL: &avatar}, false},
+		{&models.User{DisplayName: &empty, AvatarURL: &avatar}, false},
+	}
+	for i, tt := range tests {
+		if got := profileComplete(tt.user); got != tt.want {
+			t.Errorf("case %d: profileComplete = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func (e *testEnv) onboarding(t *testing.T, sequence ...string) *Onboarding {
+	t.Helper()
+
+	steps, err := ParseOnboardingSequence(sequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: e.redis.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewOnboarding(e.users, e.sender, NewRedisLocker(client), steps, time.Minute)
+}
+
+func (e *testEnv) onboardingSent() []string {
+	var steps []string
+	for _, email := range e.sender.emails("onboarding") {
+		steps = append(steps, email.Token)
+	}
+	return steps
+}
+
+// backdateOnboarding moves every completed step back by d, as if d had
+// passed since.
+func (e *testEnv) backdateOnboarding(t *testing.T, d time.Duration) {
+	t.Helper()
+	rows, err := e.db.Query(context.Background(), `SELECT user_id, step, completed_at FROM onboarding_steps`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type done struct {
+		userID int64
+		step   string
+		at     time.Time
+	}
+	var steps []done
+	for rows.Next() {
+		var s done
+		if err := rows.Scan(&s.userID, &s.step, &s.at); err != nil {
+			t.Fatal(err)
+		}
+		steps = append(steps, s)
+	}
+	rows.Close()
+	for _, s := range steps {
+		_, err := e.db.Exec(context.Background(),
+			`UPDATE onboarding_steps SET completed_at = $3 WHERE user_id = $1 AND step = $2`, s.userID, s.step, s.at.Add(-d))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOnboardingSendsStepsInOrderAfterDelay(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "alice")
+	o := e.onboarding(t, "welcome:0s", "tips:72h")
+	ctx := context.Background()
+
+	o.runOnce(ctx)
+	if got := e.onboardingSent(); !slices.Equal(got, []string{"welcome"}) {
+		t.Fatalf("after the first run sent %v, want only welcome", got)
+	}
+
+	o.runOnce(ctx)
+	if got := e.onboardingSent(); len(got) != 1 {
+		t.Fatalf("tips went out before its delay: %v", got)
+	}
+
+	e.backdateOnboarding(t, 73*time.Hour)
+	o.runOnce(ctx)
+	o.runOnce(ctx)
+	if got := e.onboardingSent(); !slices.Equal(got, []string{"welcome", "tips"}) {
+		t.Errorf("after the delay sent %v, want welcome then tips once", got)
+	}
+}
+
+func TestOnboardingSkipsIncompleteStepForCompleteProfile(t *testing.T) {
+	e := newTestEnv(t, nil)
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+	_, err := e.db.Exec(ctx, `UPDATE users SET display_name = 'Alice', avatar_url = 'https://cdn.example.com/a.png' WHERE id = $1`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := e.onboarding(t, "welcome:0s", "tips:0s:incomplete", "survey:0s")
+	for range 3 {
+		o.runOnce(ctx)
+	}
+	if got := e.onboardingSent(); !slices.Equal(got, []string{"welcome", "survey"}) {
+		t.Errorf("sent %v, want tips skipped and the sequence continuing", got)
+	}
+}
+
+func TestOnboardingSurvivesReordering(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	e.onboarding(t, "welcome:0s", "tips:0s").runOnce(ctx)
+	if got := e.onboardingSent(); !slices.Equal(got, []string{"welcome", "tips"}) {
+		t.Fatalf("sent %v, want welcome and tips", got)
+	}
+
+	// A step inserted in the middle goes out; reordered steps that were
+	// already sent don't go out again.
+	reordered := e.onboarding(t, "tips:0s", "intro:0s", "welcome:0s")
+	reordered.runOnce(ctx)
+	reordered.runOnce(ctx)
+	if got := e.onboardingSent(); !slices.Equal(got, []string{"welcome", "tips", "intro"}) {
+		t.Errorf("after reordering sent %v, want only intro added", got)
+	}
+}
+
+func TestOnboardingIgnoresUnverifiedUsers(t *testing.T) {
+	e := newTestEnv(t, nil)
+	ctx := context.Background()
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := e.users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	e.onboarding(t, "welcome:0s").runOnce(ctx)
+	if got := e.onboardingSent(); len(got) != 0 {
+		t.Errorf("sent %v to an unverified user", got)
+	}
+}
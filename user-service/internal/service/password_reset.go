@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password reset delivery modes.
+const (
+	PasswordResetLink = "link"
+	PasswordResetCode = "code"
+)
+
+// maxResetCodeAttempts is how many codes may be tried per address within
+// the reset TTL; a six-digit code must not be guessable.
+const maxResetCodeAttempts = 5
+
+var ErrResetAttemptsExceeded = errors.New("too many password reset attempts")
+
+// RequestPasswordReset emails a single-use reset link, or a code in code
+// mode, to email if it belongs to an account. Like ResendVerification it returns nil for unknown and
+// throttled addresses, so it can't be used to enumerate accounts.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) (err error) {
+	defer func() { metrics.PasswordResets.WithLabelValues("request", outcome(err)).Inc() }()
+
+	email = strings.TrimSpace(email)
+
+	key := "password_reset:" + strings.ToLower(email)
+	allowed, err := s.redisClient.SetNX(ctx, key, 1, s.resendInterval).Result()
+	if err != nil {
+		log.Printf("password reset throttle unavailable: %v", err)
+	} else if !allowed {
+		return nil
+	}
+
+	user, err := s.findByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if s.resetMode == PasswordResetCode {
+		return s.sendResetCode(ctx, user.ID, user.Email, user.Username)
+	}
+
+	token, err := s.generateVerificationToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.resetRepo.Create(ctx, user.ID, hashToken(token), time.Now().Add(s.resetTTL)); err != nil {
+		return err
+	}
+
+	return s.emailSender.SendPasswordResetEmail(user.Email, user.Username, token, s.resetTTL)
+}
+
+// sendResetCode stores and emails a six-digit code, spending any the user
+// was sent before so at most one code can be guessed at a time. Codes are
+// only unique per user, so the stored hash covers the user ID too.
+func (s *AuthService) sendResetCode(ctx context.Context, userID int64, email, username string) error {
+	for range 3 {
+		n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+		if err != nil {
+			return err
+		}
+		code := fmt.Sprintf("%06d", n.Int64())
+
+		err = s.resetRepo.Replace(ctx, userID, resetCodeHash(userID, code), time.Now().Add(s.resetTTL))
+		if errors.Is(err, repository.ErrResetTaken) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return s.emailSender.SendPasswordResetCodeEmail(email, username, code, s.resetTTL)
+	}
+	return repository.ErrResetTaken
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset
+// and signs the user out everywhere, API tokens included.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	defer func() { metrics.PasswordResets.WithLabelValues("complete", outcome(err)).Inc() }()
+
+	if err := validator.Password(newPassword, s.passwordPolicy); err != nil {
+		return validator.FieldErrors{}.Add("new_password", err.Error())
+	}
+
+	// Link tokens are 64 hex characters. Anything else could be the
+	// preimage of a code hash and bypass the code attempt limit.
+	if len(token) != 64 || strings.ToLower(token) != token {
+		return repository.ErrResetNotFound
+	}
+	if _, err := hex.DecodeString(token); err != nil {
+		return repository.ErrResetNotFound
+	}
+
+	return s.resetPassword(ctx, hashToken(token), newPassword)
+}
+
+// ConfirmPasswordReset is ResetPassword for code mode: the user proves
+// ownership of email with the code sent to it.
+func (s *AuthService) ConfirmPasswordReset(ctx context.Context, email, code, newPassword string) (err error) {
+	defer func() { metrics.PasswordResets.WithLabelValues("complete", outcome(err)).Inc() }()
+
+	if err := validator.Password(newPassword, s.passwordPolicy); err != nil {
+		return validator.FieldErrors{}.Add("new_password", err.Error())
+	}
+
+	email = strings.TrimSpace(email)
+
+	key := "password_reset_attempts:" + strings.ToLower(email)
+	pipe := s.redisClient.TxPipeline()
+	attempts := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, s.resetTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Without the counter codes could be brute-forced.
+		return err
+	}
+	if attempts.Val() > maxResetCodeAttempts {
+		return ErrResetAttemptsExceeded
+	}
+
+	user, err := s.findByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return repository.ErrResetNotFound
+		}
+		return err
+	}
+
+	if err := s.resetPassword(ctx, resetCodeHash(user.ID, code), newPassword); err != nil {
+		return err
+	}
+
+	s.redisClient.Del(ctx, key)
+	return nil
+}
+
+// findByEmail looks email up like findByLogin: an exact match wins, and a
+// case-insensitive one is only used when it is unambiguous.
+func (s *AuthService) findByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return s.userRepo.GetByEmailFold(ctx, email)
+	}
+	return user, err
+}
+
+func (s *AuthService) resetPassword(ctx context.Context, resetHash, newPassword string) error {
+	if err := s.acquireHashSlot(); err != nil {
+		return err
+	}
+	hashedPassword, err := s.hashPassword(newPassword)
+	s.releaseHashSlot()
+	if err != nil {
+		return err
+	}
+
+	userID, accessTokens, err := s.resetRepo.ResetPassword(ctx, resetHash, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+
+	for _, accessToken := range accessTokens {
+		s.blacklistAccessToken(ctx, accessToken)
+	}
+
+	log.Printf("password reset for user %d, all sessions and api tokens revoked", userID)
+	metrics.Revocations.WithLabelValues("password_reset").Inc()
+	return nil
+}
+
+func resetCodeHash(userID int64, code string) string {
+	return hashToken(fmt.Sprintf("%d:%s", userID, code))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ChangePassword sets a new password for a signed-in user who knows the
+// current one. The session that issued accessToken stays signed in; every
+// other session and every API token is revoked.
+func (s *AuthService) ChangePassword(ctx context.Context, userID int64, accessToken, currentPassword, newPassword string) error {
+	if err := validator.Password(newPassword, s.passwordPolicy); err != nil {
+		return validator.FieldErrors{}.Add("new_password", err.Error())
+	}
+	if newPassword == currentPassword {
+		return validator.FieldErrors{}.Add("new_password", "must differ from the current password")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.acquireHashSlot(); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		s.releaseHashSlot()
+		return ErrInvalidCredentials
+	}
+	hashedPassword, err := s.hashPassword(newPassword)
+	s.releaseHashSlot()
+	if err != nil {
+		return err
+	}
+
+	// API tokens have no session; then every session is revoked.
+	var keepSessionID int64
+	if current, err := s.sessionRepo.GetActiveByAccessToken(ctx, userID, accessToken); err == nil {
+		keepSessionID = current.ID
+	}
+	sessions, err := s.sessionRepo.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.ChangePassword(ctx, userID, string(hashedPassword), keepSessionID); err != nil {
+		return err
+	}
+
+	for _, sess := range sessions {
+		if sess.ID != keepSessionID && sess.AccessToken != "" {
+			s.blacklistAccessToken(ctx, sess.AccessToken)
+		}
+	}
+
+	log.Printf("password changed for user %d, other sessions and api tokens revoked", userID)
+	metrics.Revocations.WithLabelValues("password_change").Inc()
+	return nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+const newTestPassword = "battery-staple"
+
+// requestResetLink requests a reset for user and returns the emailed token.
+func (e *testEnv) requestResetLink(t *testing.T, user *models.User) string {
+	t.Helper()
+
+	if err := e.auth.RequestPasswordReset(context.Background(), user.Email); err != nil {
+		t.Fatalf("request reset: %v", err)
+	}
+	sent := e.sender.emails("reset")
+	if len(sent) == 0 {
+		t.Fatal("no reset email sent")
+	}
+	return sent[len(sent)-1].Token
+}
+
+func TestPasswordResetLinkSignsOutEverywhere(t *testing.T) {
+	e := newTestEnv(t, nil)
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	session := e.login(t, "alice")
+	apiTokens := NewAPITokenService(repository.NewAPITokenRepository(e.db))
+	_, pat, err := apiTokens.Create(ctx, user.ID, "ci", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := e.requestResetLink(t, user)
+	if err := e.auth.ResetPassword(ctx, token, newTestPassword); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+
+	if !e.redis.Exists("revoked:" + session.AccessToken) {
+		t.Error("access token of the revoked session wasn't blacklisted")
+	}
+	if _, err := e.auth.RefreshToken(ctx, session.RefreshToken, ClientInfo{}); err == nil {
+		t.Error("refresh token still works after reset")
+	}
+	if _, err := apiTokens.Authenticate(ctx, pat); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("api token after reset: got %v, want ErrInvalidAPIToken", err)
+	}
+
+	_, err = e.auth.Login(ctx, &dto.LoginRequest{Login: "alice", Password: newTestPassword}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("login with new password: %v", err)
+	}
+}
+
+func TestPasswordResetLinkIsSingleUse(t *testing.T) {
+	e := newTestEnv(t, nil)
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	token := e.requestResetLink(t, user)
+	if err := e.auth.ResetPassword(ctx, token, newTestPassword); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := e.auth.ResetPassword(ctx, token, "another-password"); !errors.Is(err, repository.ErrResetUsed) {
+		t.Fatalf("second use: got %v, want ErrResetUsed", err)
+	}
+}
+
+func TestPasswordResetLinkExpires(t *testing.T) {
+	e := newTestEnv(t, nil)
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	token := e.requestResetLink(t, user)
+	_, err := e.db.Exec(ctx, `UPDATE password_resets SET expires_at = $1 WHERE user_id = $2`,
+		time.Now().Add(-time.Minute), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.auth.ResetPassword(ctx, token, newTestPassword); !errors.Is(err, repository.ErrResetExpired) {
+		t.Fatalf("got %v, want ErrResetExpired", err)
+	}
+}
+
+func TestPasswordResetUnknownEmailSendsNothing(t *testing.T) {
+	e := newTestEnv(t, nil)
+
+	if err := e.auth.RequestPasswordReset(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := e.sender.emails("reset"); len(sent) != 0 {
+		t.Fatalf("sent %d emails for an unknown address", len(sent))
+	}
+}
+
+func TestResetCodeSupersedesEarlierCodes(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.PasswordResetMode = PasswordResetCode })
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	for range 2 {
+		if err := e.auth.RequestPasswordReset(ctx, user.Email); err != nil {
+			t.Fatal(err)
+		}
+		// Past the resend throttle.
+		e.redis.FastForward(e.cfg.VerificationResendInterval + time.Second)
+	}
+	codes := e.sender.emails("reset_code")
+	if len(codes) != 2 {
+		t.Fatalf("sent %d codes, want 2", len(codes))
+	}
+
+	if err := e.auth.ConfirmPasswordReset(ctx, user.Email, codes[0].Token, newTestPassword); !errors.Is(err, repository.ErrResetUsed) {
+		t.Fatalf("earlier code: got %v, want ErrResetUsed", err)
+	}
+	if err := e.auth.ConfirmPasswordReset(ctx, user.Email, codes[1].Token, newTestPassword); err != nil {
+		t.Fatalf("latest code: %v", err)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessionsAndAPITokens(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.MaxConcurrentHashes = 1 })
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	current := e.login(t, "alice")
+	other := e.login(t, "alice")
+	apiTokens := NewAPITokenService(repository.NewAPITokenRepository(e.db))
+	_, pat, err := apiTokens.Create(ctx, user.ID, "ci", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong current password must give the hash slot back too, or the
+	// next attempt would be shed.
+	if err := e.auth.ChangePassword(ctx, user.ID, current.AccessToken, "wrong-password", newTestPassword); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong current password: got %v, want ErrInvalidCredentials", err)
+	}
+	if err := e.auth.ChangePassword(ctx, user.ID, current.AccessToken, testPassword, newTestPassword); err != nil {
+		t.Fatalf("change password: %v", err)
+	}
+
+	if _, err := apiTokens.Authenticate(ctx, pat); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("api token after change: got %v, want ErrInvalidAPIToken", err)
+	}
+	if _, err := e.auth.RefreshToken(ctx, other.RefreshToken, ClientInfo{}); err == nil {
+		t.Error("other session's refresh token still works")
+	}
+	if _, err := e.auth.RefreshToken(ctx, current.RefreshToken, ClientInfo{}); err != nil {
+		t.Errorf("current session's refresh token: %v", err)
+	}
+}
+
+func TestPasswordResetPrefersExactEmail(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.PasswordResetMode = PasswordResetCode })
+	e.createUser(t, "bob")
+	upper := e.createUser(t, "Bob")
+	ctx := context.Background()
+
+	// Bob@example.com matches one account exactly, although two fold to it.
+	if err := e.auth.RequestPasswordReset(ctx, upper.Email); err != nil {
+		t.Fatal(err)
+	}
+	codes := e.sender.emails("reset_code")
+	if len(codes) != 1 || codes[0].To != upper.Email {
+		t.Fatalf("sent %+v, want one code to %s", codes, upper.Email)
+	}
+	if err := e.auth.ConfirmPasswordReset(ctx, upper.Email, codes[0].Token, newTestPassword); err != nil {
+		t.Fatalf("confirm with the exact email: %v", err)
+	}
+	resp, err := e.auth.Login(ctx, &dto.LoginRequest{Login: "Bob", Password: newTestPassword}, ClientInfo{})
+	if err != nil || resp.User.ID != upper.ID {
+		t.Fatalf("login with the new password: %v", err)
+	}
+
+	// BOB@example.com only matches case-insensitively, and ambiguously.
+	// Past the resend throttle, which is shared by both spellings.
+	e.redis.FastForward(e.cfg.VerificationResendInterval + time.Second)
+	if err := e.auth.RequestPasswordReset(ctx, "BOB@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := e.sender.emails("reset_code"); len(sent) != 1 {
+		t.Errorf("sent %d codes, want none for an ambiguous address", len(sent)-1)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+)
+
+const reconcileBatchSize = 500
+
+// ReconcileReport counts what a reconciliation pass found. Skipped objects
+// have keys no known feature produces and are left alone.
+type ReconcileReport struct {
+	Scanned int
+	Orphans int
+	Deleted int
+	Skipped int
+}
+
+// StorageReconciler deletes objects that no user references anymore: any
+// object of a user that no longer exists, and legacy avatars that are no
+// longer a user's current avatar. Objects younger than minAge are never
+// touched, so an upload whose database update is still in flight isn't
+// mistaken for an orphan. In dry-run mode orphans are only counted.
+type StorageReconciler struct {
+	users   *repository.UserRepository
+	storage *Minio
+	locker  *RedisLocker
+
+	interval time.Duration
+	minAge   time.Duration
+	dryRun   bool
+}
+
+func NewStorageReconciler(users *repository.UserRepository, storage *Minio, locker *RedisLocker, interval, minAge time.Duration, dryRun bool) *StorageReconciler {
+	return &StorageReconciler{
+		users:    users,
+		storage:  storage,
+		locker:   locker,
+		interval: interval,
+		minAge:   minAge,
+		dryRun:   dryRun,
+	}
+}
+
+func (r *StorageReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			release, err := r.locker.Acquire(ctx, "storage_reconcile", r.interval)
+			if err != nil {
+				if !errors.Is(err, ErrLockHeld) {
+					log.Printf("storage reconcile: unable to acquire lock: %v", err)
+				}
+				continue
+			}
+
+			report, err := r.Reconcile(ctx)
+			release()
+			if err != nil {
+				log.Printf("storage reconcile: %v", err)
+			}
+			log.Printf("storage reconcile (dry run %t): scanned=%d orphans=%d deleted=%d skipped=%d",
+				r.dryRun, report.Scanned, report.Orphans, report.Deleted, report.Skipped)
+		}
+	}
+}
+
+// Reconcile makes one pass over the bucket.
+func (r *StorageReconciler) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	var report ReconcileReport
+	cutoff := time.Now().Add(-r.minAge)
+
+	batch := make([]ownedObject, 0, reconcileBatchSize)
+	for object := range r.storage.MinioClient.ListObjects(ctx, BucketName, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return report, object.Err
+		}
+		report.Scanned++
+
+		owned, ok := objectOwner(object.Key)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		if object.LastModified.After(cutoff) {
+			continue
+		}
+
+		batch = append(batch, owned)
+		if len(batch) == reconcileBatchSize {
+			if err := r.reconcileBatch(ctx, batch, &report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := r.reconcileBatch(ctx, batch, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (r *StorageReconciler) reconcileBatch(ctx context.Context, batch []ownedObject, report *ReconcileReport) error {
+	ids := make([]int64, 0, len(batch))
+	for _, object := range batch {
+		ids = append(ids, object.userID)
+	}
+
+	owners, err := r.users.AvatarOwners(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range batch {
+		avatar, exists := owners[object.userID]
+		if exists && (!object.legacy || avatar == object.key) {
+			continue
+		}
+
+		report.Orphans++
+		if r.dryRun {
+			continue
+		}
+		if err := r.storage.RemoveObject(ctx, object.key); err != nil {
+			log.Printf("storage reconcile: removing %s failed: %v", object.key, err)
+			continue
+		}
+		report.Deleted++
+	}
+	return nil
+}
+
+type ownedObject struct {
+	key    string
+	userID int64
+	legacy bool
+}
+
+// objectOwner works out which user an object belongs to from its key:
+// "avatars/<userID>/<hash>" or the legacy "<userID>/avatar".
+func objectOwner(key string) (ownedObject, bool) {
+	rest, ok := strings.CutPrefix(key, AvatarPrefix)
+	legacy := !ok
+	if legacy {
+		rest = key
+	}
+
+	id, name, ok := strings.Cut(rest, "/")
+	if !ok {
+		return ownedObject{}, false
+	}
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || userID <= 0 {
+		return ownedObject{}, false
+	}
+	if legacy && name != "avatar" {
+		return ownedObject{}, false
+	}
+
+	return ownedObject{key: key, userID: userID, legacy: legacy}, true
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/s3test"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+)
+
+func TestObjectOwner(t *testing.T) {
+	tests := []struct {
+		key    string
+		userID int64
+		legacy bool
+		ok     bool
+	}{
+		{"avatars/7/abc123", 7, false, true},
+		{"7/avatar", 7, true, true},
+		{"7/banner", 0, false, false},
+		{"avatars/0/abc", 0, false, false},
+		{"avatars/-1/abc", 0, false, false},
+		{"avatars/x/abc", 0, false, false},
+		{"avatars/7", 0, false, false},
+		{"exports/report.csv", 0, false, false},
+		{"avatar", 0, false, false},
+	}
+	for _, tt := range tests {
+		got, ok := objectOwner(tt.key)
+		if ok != tt.ok {
+			t.Errorf("objectOwner(%q) ok = %v, want %v", tt.key, ok, tt.ok)
+			continue
+		}
+		if ok && (got.userID != tt.userID || got.legacy != tt.legacy || got.key != tt.key) {
+			t.Errorf("objectOwner(%q) = %+v, want user %d legacy %v", tt.key, got, tt.userID, tt.legacy)
+		}
+	}
+}
+
+// seedReconcile stores objects for a user with a current avatar, a user on
+// a legacy avatar, and a user who no longer exists.
+func seedReconcile(t *testing.T) (*StorageReconciler, *s3test.Server, map[string]bool) {
+	t.Helper()
+
+	db := testdb.New(t)
+	users := repository.NewUserRepository(db)
+	ctx := context.Background()
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "x"}
+	for _, u := range []*models.User{alice, bob} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gone := bob.ID + 100
+
+	store, client := s3test.New(t)
+	old := time.Now().Add(-48 * time.Hour)
+	want := map[string]bool{ // key -> survives
+		AvatarKey(alice.ID, "current"): true,
+		AvatarKey(alice.ID, "older"):   true, // retained version
+		LegacyAvatarKey(alice.ID):      false,
+		LegacyAvatarKey(bob.ID):        true,
+		AvatarKey(gone, "abc"):         false,
+		LegacyAvatarKey(gone):          false,
+		"exports/report.csv":           true,
+	}
+	for key := range want {
+		store.Put(key, []byte(key), old)
+	}
+	// Too young to judge, even though its owner is gone.
+	store.Put(AvatarKey(gone, "uploading"), []byte("new"), time.Now())
+	want[AvatarKey(gone, "uploading")] = true
+
+	for id, avatar := range map[int64]string{alice.ID: AvatarKey(alice.ID, "current"), bob.ID: LegacyAvatarKey(bob.ID)} {
+		if _, err := db.Exec(ctx, `UPDATE users SET avatar_url = $2 WHERE id = $1`, id, avatar); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewStorageReconciler(users, &Minio{MinioClient: client}, nil, time.Hour, time.Hour, false)
+	return r, store, want
+}
+
+func TestReconcileDeletesOrphans(t *testing.T) {
+	r, store, want := seedReconcile(t)
+
+	report, err := r.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantReport := ReconcileReport{Scanned: len(want), Orphans: 3, Deleted: 3, Skipped: 1}
+	if report != wantReport {
+		t.Errorf("report = %+v, want %+v", report, wantReport)
+	}
+	for key, survives := range want {
+		if store.Has(key) != survives {
+			t.Errorf("%s: present = %v, want %v", key, store.Has(key), survives)
+		}
+	}
+}
+
+func TestReconcileDryRunDeletesNothing(t *testing.T) {
+	r, store, want := seedReconcile(t)
+	r.dryRun = true
+
+	report, err := r.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Orphans != 3 || report.Deleted != 0 {
+		t.Errorf("report = %+v, want 3 orphans and nothing deleted", report)
+	}
+
+	var keys []string
+	for key := range want {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if got := store.Keys(""); !slices.Equal(got, keys) {
+		t.Errorf("objects = %v, want all of %v", got, keys)
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+)
+
+func (e *testEnv) login(t *testing.T, username string) *dto.AuthResponse {
+	t.Helper()
+
+	resp, err := e.auth.Login(context.Background(), &dto.LoginRequest{Login: username, Password: testPassword}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return resp
+}
+
+func TestRefreshWithinGraceWindowReturnsRotatedPair(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	first := e.login(t, "alice")
+
+	rotated, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+
+	// A second tab refreshing with the same token gets the same pair.
+	again, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("concurrent refresh: %v", err)
+	}
+	if again.RefreshToken != rotated.RefreshToken || again.AccessToken != rotated.AccessToken {
+		t.Fatal("concurrent refresh got a different pair than the rotation")
+	}
+
+	if _, err := e.auth.RefreshToken(ctx, rotated.RefreshToken, ClientInfo{}); err != nil {
+		t.Fatalf("rotated token no longer works: %v", err)
+	}
+}
+
+func TestRefreshReplayAfterGraceWindowRevokesSessions(t *testing.T) {
+	// rotated_at must not depend on the database session's time zone.
+	poolConfig := testdb.New(t).Config()
+	poolConfig.ConnConfig.RuntimeParams["timezone"] = "America/Los_Angeles"
+	db, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	e := newTestEnvWithDB(t, db, nil)
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	first := e.login(t, "alice")
+	rotated, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	e.redis.FastForward(e.cfg.RefreshRaceWindow + time.Second)
+	_, err = e.db.Exec(ctx, `UPDATE sessions SET rotated_at = $1 WHERE refresh_token = $2`,
+		time.Now().Add(-e.cfg.RefreshRaceWindow-time.Minute), first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay: got %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := e.auth.RefreshToken(ctx, rotated.RefreshToken, ClientInfo{}); err == nil {
+		t.Fatal("session issued by the rotation survived a replay")
+	}
+}
+
+func TestRotatedAtHasTimeZone(t *testing.T) {
+	e := newTestEnv(t, nil)
+
+	var dataType string
+	err := e.db.QueryRow(context.Background(), `
+		SELECT data_type FROM information_schema.columns
+		WHERE table_name = 'sessions' AND column_name = 'rotated_at'
+	`).Scan(&dataType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataType != "timestamp with time zone" {
+		t.Fatalf("rotated_at is %q", dataType)
+	}
+}
+
+func TestConcurrentRefreshWithSameTokenSucceedsOnce(t *testing.T) {
+	// Without a grace window a second use can't be answered with the
+	// rotated pair, so only the request that rotated the token succeeds.
+	e := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RefreshRaceWindow = 0
+		cfg.RefreshSingleUse = true
+	})
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	first := e.login(t, "alice")
+
+	const requests = 8
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for range requests {
+		wg.Go(func() {
+			if _, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{}); err == nil {
+				succeeded.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := succeeded.Load(); n != 1 {
+		t.Fatalf("%d of %d refreshes succeeded, want exactly 1", n, requests)
+	}
+
+	var sessions int
+	if err := e.db.QueryRow(ctx, `SELECT COUNT(*) FROM sessions WHERE user_id = $1`, user.ID).Scan(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	if sessions != 2 {
+		t.Errorf("user has %d sessions, want the login and one rotation", sessions)
+	}
+}
+
+func TestRefreshRequiresVerifiedEmail(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.RequireEmailVerification = true })
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	resp := e.login(t, "alice")
+	if _, err := e.db.Exec(ctx, `UPDATE users SET is_verified = false WHERE id = $1`, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.auth.RefreshToken(ctx, resp.RefreshToken, ClientInfo{}); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("refresh for an unverified user = %v, want ErrEmailNotVerified", err)
+	}
+}
+
+func TestRefreshGraceWindowIsConfigurable(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.RefreshRaceWindow = 2 * time.Minute })
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	first := e.login(t, "alice")
+	rotated, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	rotatedAgo := func(ago time.Duration) {
+		t.Helper()
+		e.redis.FastForward(ago)
+		_, err := e.db.Exec(ctx, `UPDATE sessions SET rotated_at = $1 WHERE refresh_token = $2`, time.Now().Add(-ago), first.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A minute in is past a short default window but inside this one.
+	rotatedAgo(time.Minute)
+	again, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{})
+	if err != nil || again.RefreshToken != rotated.RefreshToken {
+		t.Fatalf("refresh a minute after rotation = %v, want the rotated pair", err)
+	}
+
+	rotatedAgo(2*time.Minute + time.Second)
+	if _, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("refresh past the window = %v, want ErrRefreshTokenReused", err)
+	}
+}
+
+func TestRefreshRaceWithoutRotatedPair(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	first := e.login(t, "alice")
+	rotated, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// Within the window but with the pair gone, the client is told to retry
+	// rather than treated as a thief.
+	e.redis.Del(rotationKey(first.RefreshToken))
+	if _, err := e.auth.RefreshToken(ctx, first.RefreshToken, ClientInfo{}); !errors.Is(err, ErrRefreshRace) {
+		t.Fatalf("refresh without the pair = %v, want ErrRefreshRace", err)
+	}
+	if _, err := e.auth.RefreshToken(ctx, rotated.RefreshToken, ClientInfo{}); err != nil {
+		t.Errorf("rotated session was revoked: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+)
+
+func TestRegisterShedsLoadOverHashLimit(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.MaxConcurrentHashes = 2 })
+	ctx := context.Background()
+
+	// Every slot is taken by hashes already running.
+	for range cap(e.auth.hashSlots) {
+		e.auth.hashSlots <- struct{}{}
+	}
+
+	req := &dto.RegisterUserRequest{Username: "alice", Email: "alice@example.com", Password: testPassword}
+	if _, err := e.auth.Register(ctx, req, ClientInfo{}); !errors.Is(err, ErrServiceBusy) {
+		t.Fatalf("register with every slot taken: got %v, want ErrServiceBusy", err)
+	}
+	if taken, err := e.auth.userRepo.UsernameTaken(ctx, "alice"); err != nil || taken {
+		t.Fatalf("shed registration created a user (taken %v, err %v)", taken, err)
+	}
+
+	<-e.auth.hashSlots
+	if _, err := e.auth.Register(ctx, req, ClientInfo{}); err != nil {
+		t.Fatalf("register with a free slot: %v", err)
+	}
+	if n := len(e.auth.hashSlots); n != cap(e.auth.hashSlots)-1 {
+		t.Errorf("%d slots taken after registering, want %d", n, cap(e.auth.hashSlots)-1)
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
+)
+
+var (
+	ErrCannotReportSelf  = errors.New("users cannot report themselves")
+	ErrReportRateLimited = errors.New("too many reports, try again later")
+)
+
+// ReportRateLimitError is ErrReportRateLimited with the time left until the
+// reporter's window resets.
+type ReportRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ReportRateLimitError) Error() string { return ErrReportRateLimited.Error() }
+func (e *ReportRateLimitError) Unwrap() error { return ErrReportRateLimited }
+
+type ReportService struct {
+	reports     *repository.ReportRepository
+	users       *repository.UserRepository
+	redisClient *redis.Client
+
+	limit  int64
+	window time.Duration
+}
+
+// NewReportService lets each reporter file at most limit reports per
+// window. A limit of 0 disables the check.
+func NewReportService(reports *repository.ReportRepository, users *repository.UserRepository, redisClient *redis.Client, limit int, window time.Duration) *ReportService {
+	return &ReportService{
+		reports:     reports,
+		users:       users,
+		redisClient: redisClient,
+		limit:       int64(limit),
+		window:      window,
+	}
+}
+
+// ReportUser files a report by reporterID against targetID.
+func (s *ReportService) ReportUser(ctx context.Context, reporterID, targetID int64, reason string, details *string) (*models.UserReport, error) {
+	if !slices.Contains(models.ReportReasons, reason) {
+		return nil, validator.FieldErrors{}.Add("reason", "unknown reason "+reason)
+	}
+	if reporterID == targetID {
+		return nil, ErrCannotReportSelf
+	}
+	if _, err := s.users.GetByID(ctx, targetID); err != nil {
+		return nil, err
+	}
+	if ok, retryAfter := s.allow(ctx, reporterID); !ok {
+		return nil, &ReportRateLimitError{RetryAfter: retryAfter}
+	}
+
+	report := &models.UserReport{
+		ReporterID: &reporterID,
+		TargetID:   targetID,
+		Reason:     reason,
+		Details:    details,
+	}
+	if err := s.reports.Create(ctx, report); err != nil {
+		// Only reports that were filed count, so a duplicate doesn't use
+		// up the reporter's quota.
+		s.refund(ctx, reporterID)
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s *ReportService) List(ctx context.Context, status string, limit, offset int) ([]*models.UserReport, error) {
+	return s.reports.List(ctx, status, limit, offset)
+}
+
+// Resolve closes a report as resolved or dismissed. Acting on the reported
+// user is a separate, deliberate step.
+func (s *ReportService) Resolve(ctx context.Context, id, adminID int64, status string, note *string) (*models.UserReport, error) {
+	if status != models.ReportStatusResolved && status != models.ReportStatusDismissed {
+		return nil, validator.FieldErrors{}.Add("status", "must be resolved or dismissed")
+	}
+	report, err := s.reports.Resolve(ctx, id, adminID, status, note)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("admin %d %s report %d against user %d", adminID, status, id, report.TargetID)
+	return report, nil
+}
+
+func reportRateKey(reporterID int64) string {
+	return "report_rate:" + strconv.FormatInt(reporterID, 10)
+}
+
+// allow counts a report by reporterID in the current window and, when it's
+// over the limit, returns how long until the window resets. If Redis is
+// unreachable reports are let through; the one-open-report-per-target
+// constraint still bounds the damage.
+func (s *ReportService) allow(ctx context.Context, reporterID int64) (bool, time.Duration) {
+	if s.limit <= 0 {
+		return true, 0
+	}
+
+	key := reportRateKey(reporterID)
+	pipe := s.redisClient.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, s.window)
+	ttl := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("report rate limit unavailable: %v", err)
+		return true, 0
+	}
+	if count.Val() <= s.limit {
+		return true, 0
+	}
+
+	retryAfter := ttl.Val()
+	if retryAfter <= 0 {
+		retryAfter = s.window
+	}
+	return false, retryAfter
+}
+
+// refund takes back a report counted by allow that wasn't filed.
+func (s *ReportService) refund(ctx context.Context, reporterID int64) {
+	if s.limit <= 0 {
+		return
+	}
+	if err := s.redisClient.Decr(ctx, reportRateKey(reporterID)).Err(); err != nil {
+		log.Printf("failed to refund report rate limit: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/testdb"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct-horse"
+
+// sentEmail is one call recorded by fakeSender.
+type sentEmail struct {
+	Kind  string
+	To    string
+	Token string
+}
+
+// fakeSender records emails instead of sending them.
+type fakeSender struct {
+	mu   sync.Mutex
+	sent []sentEmail
+	err  error
+	// block, if set, holds every send until it is closed.
+	block chan struct{}
+}
+
+func (f *fakeSender) record(kind, to, token string) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, sentEmail{Kind: kind, To: to, Token: token})
+	return nil
+}
+
+func (f *fakeSender) emails(kind string) []sentEmail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []sentEmail
+	for _, e := range f.sent {
+		if e.Kind == kind {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (f *fakeSender) SendVerificationEmail(to, username, token string) error {
+	return f.record("verification", to, token)
+}
+
+func (f *fakeSender) SendPasswordResetEmail(to, username, token string, ttl time.Duration) error {
+	return f.record("reset", to, token)
+}
+
+func (f *fakeSender) SendPasswordResetCodeEmail(to, username, code string, ttl time.Duration) error {
+	return f.record("reset_code", to, code)
+}
+
+func (f *fakeSender) SendLoginAlertEmail(userID int64, to, username, device, ipAddress string, at time.Time) error {
+	return f.record("login_alert", to, device)
+}
+
+func (f *fakeSender) SendAccountDeletionEmail(to, username string, purgeAt time.Time) error {
+	return f.record("deletion", to, "")
+}
+
+func (f *fakeSender) SendAccountDeletionReminderEmail(to, username string, purgeAt time.Time) error {
+	return f.record("deletion_reminder", to, "")
+}
+
+func (f *fakeSender) SendOnboardingEmail(userID int64, to, username, step string) error {
+	return f.record("onboarding", to, step)
+}
+
+// testEnv is an AuthService on a fresh database and an in-memory Redis.
+type testEnv struct {
+	db     *pgxpool.Pool
+	redis  *miniredis.Miniredis
+	cfg    *config.Config
+	sender *fakeSender
+	auth   *AuthService
+	users  *repository.UserRepository
+
+	// workers is where the service runs background emails; Wait on it
+	// before checking what was sent.
+	workers sync.WaitGroup
+}
+
+func newTestEnv(t *testing.T, configure func(*config.Config)) *testEnv {
+	t.Helper()
+	return newTestEnvWithDB(t, testdb.New(t), configure)
+}
+
+func newTestEnvWithDB(t *testing.T, db *pgxpool.Pool, configure func(*config.Config)) *testEnv {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	cfg := config.LoadConfig()
+	cfg.BcryptCost = bcrypt.MinCost
+	if configure != nil {
+		configure(cfg)
+	}
+
+	env := &testEnv{
+		db:     db,
+		redis:  mr,
+		cfg:    cfg,
+		sender: &fakeSender{},
+		users:  repository.NewUserRepository(db),
+	}
+	env.auth = NewAuthService(
+		env.users,
+		jwt.NewTokenManager(cfg.JWTSecret, cfg.JWTAccessMaxAge),
+		repository.NewSessionRepository(db),
+		repository.NewEmailVerificationRepository(db),
+		repository.NewPasswordResetRepository(db),
+		repository.NewTrustedDeviceRepository(db),
+		env.sender,
+		redisClient,
+		&env.workers,
+		cfg,
+	)
+	return env
+}
+
+// createUser inserts a verified user with testPassword.
+func (e *testEnv) createUser(t *testing.T, username string) *models.User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{
+		Username:     username,
+		Email:        username + "@example.com",
+		PasswordHash: string(hash),
+	}
+	if err := e.users.Create(context.Background(), user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := e.users.MarkVerified(context.Background(), user.ID); err != nil {
+		t.Fatalf("verify user: %v", err)
+	}
+	user.IsVerified = true
+	return user
+}
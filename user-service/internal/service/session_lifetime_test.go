@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+)
+
+func TestSessionTTL(t *testing.T) {
+	s := &AuthService{sessionMaxLifetime: 2 * time.Hour}
+	now := time.Now()
+
+	if got := s.sessionTTL(time.Hour, now); got != time.Hour {
+		t.Errorf("fresh session: ttl = %s, want the full hour", got)
+	}
+	if got := s.sessionTTL(time.Hour, now.Add(-90*time.Minute)); got > 30*time.Minute || got < 29*time.Minute {
+		t.Errorf("90 minutes in: ttl = %s, want what's left of the max lifetime", got)
+	}
+	if got := s.sessionTTL(time.Hour, now.Add(-3*time.Hour)); got > 0 {
+		t.Errorf("past the max lifetime: ttl = %s, want none", got)
+	}
+
+	s.sessionMaxLifetime = 0
+	if got := s.sessionTTL(time.Hour, now.Add(-3*time.Hour)); got != time.Hour {
+		t.Errorf("no max lifetime: ttl = %s, want the full hour", got)
+	}
+}
+
+func TestSlidingRefreshStopsAtMaxLifetime(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) {
+		cfg.JWTRefreshTTL = time.Hour
+		cfg.SessionSliding = true
+		cfg.SessionMaxLifetime = 2 * time.Hour
+	})
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	// age pretends the session was logged into ago, with remaining left
+	// on its refresh token.
+	age := func(refreshToken string, ago, remaining time.Duration) {
+		t.Helper()
+		_, err := e.db.Exec(ctx, `UPDATE sessions SET authenticated_at = $2, expires_at = $3 WHERE refresh_token = $1`,
+			refreshToken, time.Now().Add(-ago), time.Now().Add(remaining))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := e.login(t, "alice")
+
+	age(resp.RefreshToken, 30*time.Minute, 30*time.Minute)
+	resp, err := e.auth.RefreshToken(ctx, resp.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if resp.RefreshExpiresIn < int64((59 * time.Minute).Seconds()) {
+		t.Errorf("refresh expires in %ds, want it slid forward to a full hour", resp.RefreshExpiresIn)
+	}
+
+	age(resp.RefreshToken, 100*time.Minute, 30*time.Minute)
+	resp, err = e.auth.RefreshToken(ctx, resp.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("refresh near the max lifetime: %v", err)
+	}
+	if resp.RefreshExpiresIn > int64((20 * time.Minute).Seconds()) {
+		t.Errorf("refresh expires in %ds, want it capped at the 20 minutes left", resp.RefreshExpiresIn)
+	}
+
+	age(resp.RefreshToken, 3*time.Hour, 30*time.Minute)
+	if _, err := e.auth.RefreshToken(ctx, resp.RefreshToken, ClientInfo{}); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("refresh past the max lifetime = %v, want ErrRefreshTokenExpired", err)
+	}
+}
+
+func TestRememberMeLifetimes(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) {
+		cfg.JWTRefreshTTL = time.Hour
+		cfg.JWTRememberMeTTL = 30 * 24 * time.Hour
+		cfg.SessionSliding = true
+		cfg.SessionMaxLifetime = 0
+	})
+	e.createUser(t, "alice")
+	ctx := context.Background()
+
+	within := func(got int64, want time.Duration) bool {
+		return got <= int64(want.Seconds()) && got >= int64((want-time.Minute).Seconds())
+	}
+	sessionExpiry := func(refreshToken string) time.Duration {
+		t.Helper()
+		var expiresAt time.Time
+		if err := e.db.QueryRow(ctx, `SELECT expires_at FROM sessions WHERE refresh_token = $1`, refreshToken).Scan(&expiresAt); err != nil {
+			t.Fatal(err)
+		}
+		return time.Until(expiresAt)
+	}
+
+	for _, tt := range []struct {
+		rememberMe bool
+		want       time.Duration
+	}{
+		{false, time.Hour},
+		{true, 30 * 24 * time.Hour},
+	} {
+		resp, err := e.auth.Login(ctx, &dto.LoginRequest{Login: "alice", Password: testPassword, RememberMe: tt.rememberMe}, ClientInfo{})
+		if err != nil {
+			t.Fatalf("remember me %v: %v", tt.rememberMe, err)
+		}
+		if !within(resp.RefreshExpiresIn, tt.want) {
+			t.Errorf("remember me %v: refresh expires in %ds, want %s", tt.rememberMe, resp.RefreshExpiresIn, tt.want)
+		}
+		if got := sessionExpiry(resp.RefreshToken); got > tt.want || got < tt.want-time.Minute {
+			t.Errorf("remember me %v: session expires in %s, want %s", tt.rememberMe, got, tt.want)
+		}
+
+		// Rotation keeps the lifetime the session was issued with.
+		resp, err = e.auth.RefreshToken(ctx, resp.RefreshToken, ClientInfo{})
+		if err != nil {
+			t.Fatalf("remember me %v: refresh: %v", tt.rememberMe, err)
+		}
+		if !within(resp.RefreshExpiresIn, tt.want) {
+			t.Errorf("remember me %v: refreshed token expires in %ds, want %s", tt.rememberMe, resp.RefreshExpiresIn, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRefreshesOnOneDeviceListOnce(t *testing.T) {
+	e := newTestEnv(t, nil)
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	laptop, phone := "laptop-1", "phone-1"
+	resp := e.loginFrom(t, "alice", ClientInfo{DeviceID: &laptop})
+	for range 3 {
+		next, err := e.auth.RefreshToken(ctx, resp.RefreshToken, ClientInfo{DeviceID: &laptop})
+		if err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		resp = next
+	}
+	e.loginFrom(t, "alice", ClientInfo{DeviceID: &phone})
+
+	list, err := e.auth.GetActiveSessions(ctx, user.ID, resp.RefreshToken, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 2 || len(list.Sessions) != 2 {
+		t.Fatalf("listed %d devices (total %d), want laptop and phone", len(list.Sessions), list.Total)
+	}
+
+	for _, info := range list.Sessions {
+		if info.DeviceID == nil {
+			t.Fatalf("device without an ID: %+v", info)
+		}
+		switch *info.DeviceID {
+		case laptop:
+			if !info.IsCurrent {
+				t.Error("laptop isn't marked current")
+			}
+		case phone:
+			if info.IsCurrent || info.SessionCount != 1 {
+				t.Errorf("phone = %+v, want one session, not current", info)
+			}
+		default:
+			t.Errorf("unexpected device %q", *info.DeviceID)
+		}
+	}
+
+	page, err := e.auth.GetActiveSessions(ctx, user.ID, "", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Sessions) != 1 {
+		t.Errorf("second page of one = %d devices (total %d), want 1 of 2", len(page.Sessions), page.Total)
+	}
+}
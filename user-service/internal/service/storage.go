@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// userPrefixes lists every feature prefix that holds per-user objects and
+// therefore counts against the user's storage quota.
+func userPrefixes(userID int64) []string {
+	return []string{
+		AvatarUserPrefix(userID),
+	}
+}
+
+// StorageQuota is the per-user byte limit, with optional per-plan overrides.
+type StorageQuota struct {
+	Default int64
+	Plans   map[string]int64
+}
+
+func (q StorageQuota) For(plan string) int64 {
+	if limit, ok := q.Plans[plan]; ok {
+		return limit
+	}
+	return q.Default
+}
+
+// StorageUsage sums the size of all objects a user owns across features.
+func (m *Minio) StorageUsage(ctx context.Context, userID int64) (int64, error) {
+	var total int64
+	for _, prefix := range userPrefixes(userID) {
+		for object := range m.MinioClient.ListObjects(ctx, BucketName, minio.ListObjectsOptions{
+			Prefix:    prefix,
+			Recursive: true,
+		}) {
+			if object.Err != nil {
+				return 0, object.Err
+			}
+			total += object.Size
+		}
+	}
+
+	return total, nil
+}
+
+// ObjectSize returns the size of key, or 0 if it doesn't exist.
+func (m *Minio) ObjectSize(ctx context.Context, key string) (int64, error) {
+	info, err := m.MinioClient.StatObject(ctx, BucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return info.Size, nil
+}
+
+// PruneAvatars keeps current plus the newest keep-1 other avatar versions
+// of a user and removes the rest, returning how many were removed. keep
+// below 1 is treated as 1.
+func (m *Minio) PruneAvatars(ctx context.Context, userID int64, current string, keep int) (int, error) {
+	var older []minio.ObjectInfo
+	for object := range m.MinioClient.ListObjects(ctx, BucketName, minio.ListObjectsOptions{
+		Prefix:    AvatarUserPrefix(userID),
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return 0, object.Err
+		}
+		if object.Key != current {
+			older = append(older, object)
+		}
+	}
+
+	keep = max(keep, 1) - 1
+	if len(older) <= keep {
+		return 0, nil
+	}
+
+	slices.SortFunc(older, func(a, b minio.ObjectInfo) int {
+		return b.LastModified.Compare(a.LastModified)
+	})
+
+	removed := 0
+	for _, object := range older[keep:] {
+		if err := m.RemoveObject(ctx, object.Key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// RemoveAvatars deletes every avatar version of a user, and legacyAvatar if
+// it is a legacy key. Objects that are already gone are not an error.
+func (m *Minio) RemoveAvatars(ctx context.Context, userID int64, legacyAvatar string) error {
+	if err := m.removeLegacyAvatars(ctx, userID, legacyAvatar); err != nil {
+		return err
+	}
+
+	for object := range m.MinioClient.ListObjects(ctx, BucketName, minio.ListObjectsOptions{
+		Prefix:    AvatarUserPrefix(userID),
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if err := m.RemoveObject(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveUserObjects deletes every object a user owns, including a legacy
+// avatar stored outside the per-user prefixes.
+func (m *Minio) RemoveUserObjects(ctx context.Context, userID int64, legacyAvatar string) error {
+	if err := m.removeLegacyAvatars(ctx, userID, legacyAvatar); err != nil {
+		return err
+	}
+
+	for _, prefix := range userPrefixes(userID) {
+		for object := range m.MinioClient.ListObjects(ctx, BucketName, minio.ListObjectsOptions{
+			Prefix:    prefix,
+			Recursive: true,
+		}) {
+			if object.Err != nil {
+				return object.Err
+			}
+			if err := m.RemoveObject(ctx, object.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeLegacyAvatars deletes the user's object at LegacyAvatarKey, which
+// is checked whether or not the user still points at it: a retried delete
+// finds the pointer already cleared. legacyAvatar is removed too if it is
+// some other legacy key.
+func (m *Minio) removeLegacyAvatars(ctx context.Context, userID int64, legacyAvatar string) error {
+	legacy := LegacyAvatarKey(userID)
+	_, err := m.MinioClient.StatObject(ctx, BucketName, legacy, minio.StatObjectOptions{})
+	switch {
+	case err == nil:
+		if err := m.RemoveObject(ctx, legacy); err != nil {
+			return err
+		}
+	case minio.ToErrorResponse(err).Code != "NoSuchKey":
+		return err
+	}
+
+	if IsLegacyAvatarKey(legacyAvatar) && legacyAvatar != legacy {
+		return m.RemoveObject(ctx, legacyAvatar)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/s3test"
+)
+
+func TestRemoveAvatarsTwice(t *testing.T) {
+	store, client := s3test.New(t)
+	m := &Minio{MinioClient: client}
+	ctx := context.Background()
+
+	now := time.Now()
+	current := AvatarKey(7, "aa")
+	store.Put(current, []byte("new"), now)
+	store.Put(AvatarKey(7, "bb"), []byte("older"), now.Add(-time.Hour))
+	store.Put(LegacyAvatarKey(7), []byte("legacy"), now.Add(-24*time.Hour))
+	store.Put(AvatarKey(8, "cc"), []byte("someone else"), now)
+
+	if err := m.RemoveAvatars(ctx, 7, current); err != nil {
+		t.Fatalf("first delete: %v", err)
+	}
+	// A retry after the pointer was cleared passes no key at all.
+	if err := m.RemoveAvatars(ctx, 7, ""); err != nil {
+		t.Fatalf("second delete: %v", err)
+	}
+
+	if keys := store.Keys(AvatarUserPrefix(7)); len(keys) != 0 {
+		t.Errorf("avatar versions left: %v", keys)
+	}
+	if store.Has(LegacyAvatarKey(7)) {
+		t.Error("legacy avatar left")
+	}
+	if !store.Has(AvatarKey(8, "cc")) {
+		t.Error("another user's avatar was removed")
+	}
+}
+
+func TestRemoveAvatarsRetryFindsLegacyKey(t *testing.T) {
+	store, client := s3test.New(t)
+	m := &Minio{MinioClient: client}
+
+	// The first attempt cleared the pointer and died before removing
+	// anything; the retry only knows the user.
+	store.Put(LegacyAvatarKey(7), []byte("legacy"), time.Now())
+
+	if err := m.RemoveAvatars(context.Background(), 7, ""); err != nil {
+		t.Fatalf("RemoveAvatars: %v", err)
+	}
+	if store.Has(LegacyAvatarKey(7)) {
+		t.Error("legacy avatar survived the retry")
+	}
+}
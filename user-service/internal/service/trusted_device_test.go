@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+)
+
+func (e *testEnv) loginFrom(t *testing.T, username string, client ClientInfo) *dto.AuthResponse {
+	t.Helper()
+
+	resp, err := e.auth.Login(context.Background(), &dto.LoginRequest{Login: username, Password: testPassword}, client)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	e.workers.Wait()
+	return resp
+}
+
+func TestLoginAlertsSkipTrustedDevice(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.LoginAlertsEnabled = true })
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	deviceID := "laptop-1"
+	resp := e.loginFrom(t, "alice", ClientInfo{DeviceID: &deviceID})
+	if got := len(e.sender.emails("login_alert")); got != 1 {
+		t.Fatalf("first login from a new device sent %d alerts, want 1", got)
+	}
+
+	device, err := e.auth.TrustCurrentDevice(ctx, user.ID, resp.AccessToken, nil)
+	if err != nil {
+		t.Fatalf("TrustCurrentDevice: %v", err)
+	}
+	if len(device.Secret) != 64 {
+		t.Fatalf("device secret = %q, want 32 random bytes in hex", device.Secret)
+	}
+
+	e.loginFrom(t, "alice", ClientInfo{DeviceID: &deviceID, DeviceSecret: &device.Secret})
+	if got := len(e.sender.emails("login_alert")); got != 1 {
+		t.Errorf("login from the trusted device sent an alert (%d total)", got)
+	}
+}
+
+func TestLoginAlertsRequireDeviceSecret(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.LoginAlertsEnabled = true })
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	deviceID := "laptop-1"
+	resp := e.loginFrom(t, "alice", ClientInfo{DeviceID: &deviceID})
+	device, err := e.auth.TrustCurrentDevice(ctx, user.ID, resp.AccessToken, nil)
+	if err != nil {
+		t.Fatalf("TrustCurrentDevice: %v", err)
+	}
+
+	wrong := "00" + device.Secret[2:]
+	// Knowing the device ID alone, or guessing at the secret, isn't enough.
+	e.loginFrom(t, "alice", ClientInfo{DeviceID: &deviceID})
+	e.loginFrom(t, "alice", ClientInfo{DeviceID: &deviceID, DeviceSecret: &wrong})
+	if got := len(e.sender.emails("login_alert")); got != 3 {
+		t.Errorf("sent %d alerts, want one per login without the secret (3)", got)
+	}
+}
+
+func TestTrustingDeviceAgainReplacesSecret(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.LoginAlertsEnabled = true })
+	user := e.createUser(t, "alice")
+	ctx := context.Background()
+
+	deviceID := "laptop-1"
+	resp := e.loginFrom(t, "alice", ClientInfo{DeviceID: &deviceID})
+	first, err := e.auth.TrustCurrentDevice(ctx, user.ID, resp.AccessToken, nil)
+	if err != nil {
+		t.Fatalf("TrustCurrentDevice: %v", err)
+	}
+	second, err := e.auth.TrustCurrentDevice(ctx, user.ID, resp.AccessToken, nil)
+	if err != nil {
+		t.Fatalf("TrustCurrentDevice again: %v", err)
+	}
+	if first.Secret == second.Secret {
+		t.Fatal("trusting again returned the same secret")
+	}
+
+	e.loginFrom(t, "alice", ClientInfo{DeviceID: &deviceID, DeviceSecret: &first.Secret})
+	e.loginFrom(t, "alice", ClientInfo{DeviceID: &deviceID, DeviceSecret: &second.Secret})
+	if got := len(e.sender.emails("login_alert")); got != 2 {
+		t.Errorf("sent %d alerts, want 2: the first login and the replaced secret", got)
+	}
+}
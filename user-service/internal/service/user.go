@@ -4,26 +4,58 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/repository"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/validator"
 	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 )
 
+const verificationTTL = 24 * time.Hour
+
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrAlreadyUserExists  = errors.New("user already exists")
+	ErrServiceBusy        = errors.New("service is busy, try again later")
+
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrSessionRevoked      = errors.New("session revoked")
+	ErrRefreshRace         = errors.New("refresh token was just rotated, retry with the new token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, all sessions revoked")
+	ErrDeviceIDRequired    = errors.New("session has no device id")
+	ErrNothingToReactivate = errors.New("no account pending deletion matches these credentials")
+	ErrEmailNotVerified    = errors.New("email address is not verified")
 )
 
+// ClientInfo identifies the client a session is created for. Any field may
+// be nil when the client didn't provide it.
+type ClientInfo struct {
+	UserAgent    *string
+	IPAddress    *string
+	DeviceID     *string
+	DeviceSecret *string
+}
+
 type EmailSender interface {
 	SendVerificationEmail(to, username, token string) error
+	SendPasswordResetEmail(to, username, token string, ttl time.Duration) error
+	SendPasswordResetCodeEmail(to, username, code string, ttl time.Duration) error
+	SendLoginAlertEmail(userID int64, to, username, device, ipAddress string, at time.Time) error
+	SendAccountDeletionEmail(to, username string, purgeAt time.Time) error
+	SendAccountDeletionReminderEmail(to, username string, purgeAt time.Time) error
+	SendOnboardingEmail(userID int64, to, username, step string) error
 }
 
 type AuthService struct {
@@ -31,8 +63,46 @@ type AuthService struct {
 	tokenManager *jwt.TokenManager
 	sessionRepo  *repository.SessionRepository
 	emailRepo    *repository.EmailVerificationRepository
+	resetRepo    *repository.PasswordResetRepository
+	trustedRepo  *repository.TrustedDeviceRepository
 	emailSender  EmailSender
 	redisClient  *redis.Client
+
+	// workers tracks emails sent in the background, so shutdown can wait
+	// for them.
+	workers *sync.WaitGroup
+
+	// hashSlots bounds the number of bcrypt operations running at once so a
+	// registration/login flood sheds load instead of saturating the CPU.
+	hashSlots chan struct{}
+	// bcryptCost is used for new hashes; older hashes with a lower cost are
+	// upgraded on login.
+	bcryptCost int
+
+	refreshTTL    time.Duration
+	rememberMeTTL time.Duration
+
+	// refreshRaceWindow is the grace period after a rotation during which
+	// the old refresh token returns the pair it was rotated into instead of
+	// being treated as a replay.
+	refreshRaceWindow time.Duration
+
+	requireVerified    bool
+	slidingSessions    bool
+	sessionMaxLifetime time.Duration
+	singleUseRefresh   bool
+
+	blacklistFailOpen     bool
+	verifyTokenRateLimit  int64
+	verifyTokenRateWindow time.Duration
+
+	passwordPolicy validator.PasswordPolicy
+	emailDomains   []string
+	resendInterval time.Duration
+	resetTTL       time.Duration
+	resetMode      string
+	loginAlerts    bool
+	deletionGrace  time.Duration
 }
 
 func NewAuthService(
@@ -40,106 +110,200 @@ func NewAuthService(
 	tokenManager *jwt.TokenManager,
 	sessionRepo *repository.SessionRepository,
 	emailRepo *repository.EmailVerificationRepository,
+	resetRepo *repository.PasswordResetRepository,
+	trustedRepo *repository.TrustedDeviceRepository,
 	emailSender EmailSender,
 	redisClient *redis.Client,
+	workers *sync.WaitGroup,
+	cfg *config.Config,
 ) *AuthService {
+	if workers == nil {
+		workers = &sync.WaitGroup{}
+	}
+	maxHashes := cfg.MaxConcurrentHashes
+	if maxHashes < 1 {
+		maxHashes = 1
+	}
+
 	return &AuthService{
 		userRepo:     userRepo,
 		tokenManager: tokenManager,
 		sessionRepo:  sessionRepo,
 		emailRepo:    emailRepo,
+		resetRepo:    resetRepo,
+		trustedRepo:  trustedRepo,
 		emailSender:  emailSender,
 		redisClient:  redisClient,
+		workers:      workers,
+		hashSlots:    make(chan struct{}, maxHashes),
+		bcryptCost:   cfg.BcryptCost,
+
+		refreshTTL:    cfg.JWTRefreshTTL,
+		rememberMeTTL: cfg.JWTRememberMeTTL,
+
+		refreshRaceWindow: cfg.RefreshRaceWindow,
+
+		requireVerified:    cfg.RequireEmailVerification,
+		slidingSessions:    cfg.SessionSliding,
+		sessionMaxLifetime: cfg.SessionMaxLifetime,
+		singleUseRefresh:   cfg.RefreshSingleUse,
+
+		blacklistFailOpen:     cfg.BlacklistFailurePolicy == "open",
+		verifyTokenRateLimit:  int64(cfg.VerifyTokenRateLimit),
+		verifyTokenRateWindow: cfg.VerifyTokenRateWindow,
+
+		passwordPolicy: validator.PasswordPolicy{
+			MinLength:     cfg.PasswordMinLength,
+			MaxLength:     cfg.PasswordMaxLength,
+			RequireUpper:  cfg.PasswordRequireUpper,
+			RequireLower:  cfg.PasswordRequireLower,
+			RequireDigit:  cfg.PasswordRequireDigit,
+			RequireSymbol: cfg.PasswordRequireSymbol,
+		},
+		emailDomains:   cfg.RegistrationEmailDomains,
+		resendInterval: cfg.VerificationResendInterval,
+		resetTTL:       cfg.PasswordResetTTL,
+		resetMode:      cfg.PasswordResetMode,
+		loginAlerts:    cfg.LoginAlertsEnabled,
+		deletionGrace:  cfg.AccountDeletionGrace,
+	}
+}
+
+func (s *AuthService) registrationRules() validator.RegistrationRules {
+	return validator.RegistrationRules{
+		Password:     s.passwordPolicy,
+		EmailDomains: s.emailDomains,
 	}
 }
 
-func (s *AuthService) Register(ctx context.Context, req *dto.RegisterUserRequest, userAgent, ipAddress *string) (*dto.AuthResponse, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+func (s *AuthService) acquireHashSlot() error {
+	select {
+	case s.hashSlots <- struct{}{}:
+		return nil
+	default:
+		return ErrServiceBusy
+	}
+}
+
+func (s *AuthService) releaseHashSlot() {
+	<-s.hashSlots
+}
+
+// hashPassword hashes password at the configured cost. Callers hold a hash
+// slot.
+func (s *AuthService) hashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+}
+
+// rehashPassword returns a new hash of password if hash, which password was
+// just verified against, uses a lower cost than configured, and nil
+// otherwise. Callers hold a hash slot.
+func (s *AuthService) rehashPassword(hash, password string) []byte {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil || cost >= s.bcryptCost {
+		return nil
+	}
+
+	rehashed, err := s.hashPassword(password)
 	if err != nil {
-		return nil, err
+		log.Printf("password rehash failed: %v", err)
+		return nil
 	}
+	return rehashed
+}
 
-	user := &models.User{
-		Username:     req.Username,
-		Email:        req.Email,
-		PasswordHash: string(hashedPassword),
+// ValidateRegistration runs the same checks as Register plus username and
+// email availability, without writing anything or sending email.
+func (s *AuthService) ValidateRegistration(ctx context.Context, req *dto.RegisterUserRequest) error {
+	if errs := validator.ValidateRegisterRequest(req, s.registrationRules()); errs != nil {
+		return errs
 	}
 
-	if req.DisplayName != "" {
-		user.DisplayName = &req.DisplayName
+	taken, err := s.takenFields(ctx, req)
+	if err != nil {
+		return err
 	}
+	if taken != nil {
+		return taken
+	}
+	return nil
+}
 
-	err = s.userRepo.Create(ctx, user)
+// takenFields reports which of the username and email of req belong to
+// another user already.
+func (s *AuthService) takenFields(ctx context.Context, req *dto.RegisterUserRequest) (validator.FieldErrors, error) {
+	var errs validator.FieldErrors
+
+	taken, err := s.userRepo.UsernameTaken(ctx, req.Username)
 	if err != nil {
-		if errors.Is(err, repository.ErrUserAlreadyExists) {
-			return nil, ErrAlreadyUserExists
-		}
 		return nil, err
 	}
+	if taken {
+		errs = errs.Add("username", "is already taken")
+	}
 
-	token, err := s.generateVerificationToken()
+	taken, err = s.userRepo.EmailTaken(ctx, req.Email)
 	if err != nil {
 		return nil, err
 	}
+	if taken {
+		errs = errs.Add("email", "is already registered")
+	}
 
-	ev := &models.EmailVerification{
-		UserID:    user.ID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(time.Hour * 24),
+	return errs, nil
+}
+
+func (s *AuthService) Register(ctx context.Context, req *dto.RegisterUserRequest, client ClientInfo) (resp *dto.AuthResponse, err error) {
+	defer func() { metrics.Registrations.WithLabelValues(outcome(err)).Inc() }()
+
+	if errs := validator.ValidateRegisterRequest(req, s.registrationRules()); errs != nil {
+		return nil, errs
 	}
 
-	if err = s.emailRepo.Create(ctx, ev); err != nil {
+	if err := s.acquireHashSlot(); err != nil {
 		return nil, err
 	}
-
-	log.Println("helloworld")
-
-	err = s.emailSender.SendVerificationEmail(user.Email, user.Username, token)
+	hashedPassword, err := s.hashPassword(req.Password)
+	s.releaseHashSlot()
 	if err != nil {
 		return nil, err
 	}
 
-	accessToken, expiresAt, err := s.tokenManager.GenerateAccessToken(user.ID, user.Username, user.Email)
-	if err != nil {
-		return nil, err
+	user := &models.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: string(hashedPassword),
 	}
 
-	refreshToken, refreshExpiresAt, err := s.tokenManager.GenerateRefreshToken(user.ID, user.Username, user.Email)
+	if req.DisplayName != "" {
+		user.DisplayName = &req.DisplayName
+	}
+
+	err = s.userRepo.Create(ctx, user)
 	if err != nil {
+		if errors.Is(err, repository.ErrUserAlreadyExists) {
+			return nil, ErrAlreadyUserExists
+		}
 		return nil, err
 	}
 
-	session := &repository.Session{
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		AccessToken:  accessToken,
-		UserAgent:    userAgent,
-		IPAddress:    ipAddress,
-		ExpiresAt:    refreshExpiresAt,
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		return nil, err
 	}
 
-	if err := s.sessionRepo.Create(ctx, session); err != nil {
-		return nil, err
+	// Until the email is verified there is nothing to sign in to; the
+	// response carries only the user.
+	if s.requireVerified {
+		return &dto.AuthResponse{User: user}, nil
 	}
 
-	return &dto.AuthResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
-		User:         user,
-	}, nil
+	return s.createSession(ctx, user, client, s.refreshTTL)
 }
 
-func (s *AuthService) Login(ctx context.Context, req *dto.LoginRequest, userAgent, ipAddress *string) (*dto.AuthResponse, error) {
-	var user *models.User
-	var err error
-
-	if strings.Contains(req.Login, "@") {
-		user, err = s.userRepo.GetByEmail(ctx, req.Login)
-	} else {
-		user, err = s.userRepo.GetByUsername(ctx, req.Login)
-	}
+func (s *AuthService) Login(ctx context.Context, req *dto.LoginRequest, client ClientInfo) (resp *dto.AuthResponse, err error) {
+	defer func() { metrics.Logins.WithLabelValues(outcome(err)).Inc() }()
 
+	user, err := s.findByLogin(ctx, req.Login)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			return nil, ErrInvalidCredentials
@@ -147,72 +311,128 @@ func (s *AuthService) Login(ctx context.Context, req *dto.LoginRequest, userAgen
 		return nil, err
 	}
 
+	if err := s.acquireHashSlot(); err != nil {
+		return nil, err
+	}
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	var rehashed []byte
+	if err == nil {
+		rehashed = s.rehashPassword(user.PasswordHash, req.Password)
+	}
+	s.releaseHashSlot()
 	if err != nil {
 		return nil, ErrInvalidCredentials
 	}
 
-	accessToken, expiresAt, err := s.tokenManager.GenerateAccessToken(user.ID, user.Username, user.Email)
-	if err != nil {
-		return nil, err
+	// A failed upgrade only means the old hash stays until the next login.
+	if rehashed != nil {
+		if err := s.userRepo.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, string(rehashed)); err != nil {
+			log.Printf("failed to upgrade password hash for user %d: %v", user.ID, err)
+		}
 	}
 
-	refreshToken, refreshExpiresAt, err := s.tokenManager.GenerateRefreshToken(user.ID, user.Username, user.Email)
-	if err != nil {
-		return nil, err
+	if s.requireVerified && !user.IsVerified {
+		return nil, ErrEmailNotVerified
 	}
 
-	session := &repository.Session{
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		AccessToken:  accessToken,
-		UserAgent:    userAgent,
-		IPAddress:    ipAddress,
-		ExpiresAt:    refreshExpiresAt,
+	refreshTTL := s.refreshTTL
+	if req.RememberMe {
+		refreshTTL = s.rememberMeTTL
 	}
 
-	if err := s.sessionRepo.Create(ctx, session); err != nil {
+	authResp, err := s.createSession(ctx, user, client, refreshTTL)
+	if err != nil {
 		return nil, err
 	}
 
 	_ = s.userRepo.UpdateLastSeen(ctx, user.ID)
+	s.alertNewLogin(ctx, user, client)
 
-	return &dto.AuthResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
-		User:         user,
-	}, nil
+	return authResp, nil
 }
 
-func (s *AuthService) Logout(ctx context.Context, refreshToken, accessToken string) error {
-	claims, err := s.tokenManager.ValidateToken(accessToken)
-	if err == nil {
-		ttl := time.Until(claims.ExpiresAt.Time)
-		if ttl > 0 {
-			key := fmt.Sprintf("revoked:%s", accessToken)
-			_ = s.redisClient.Set(ctx, key, "revoked", ttl).Err()
-			log.Printf("tokens blacklisted for userID=%s (accessToken=%s..., refreshToken=%s...)",
-				claims.UserId, accessToken[:10], refreshToken[:10])
+// alertNewLogin emails user about a login from a device they haven't
+// trusted. A device only counts as trusted when the client presents both
+// its ID and the secret issued when it was trusted. The email goes out in
+// the background so a slow SMTP server doesn't hold up the login.
+func (s *AuthService) alertNewLogin(ctx context.Context, user *models.User, client ClientInfo) {
+	if client.DeviceID != nil && client.DeviceSecret != nil {
+		trusted, err := s.trustedRepo.Touch(ctx, user.ID, *client.DeviceID, hashToken(*client.DeviceSecret))
+		if err != nil {
+			log.Printf("trusted device lookup failed for user %d: %v", user.ID, err)
+			return
 		}
-	} else {
-		return err
+		if trusted {
+			return
+		}
+	}
+
+	if !s.loginAlerts {
+		return
+	}
+
+	device, ipAddress := "Unknown device", "Unknown"
+	if client.UserAgent != nil {
+		device = *client.UserAgent
+	}
+	if client.IPAddress != nil {
+		ipAddress = *client.IPAddress
+	}
+
+	at := time.Now()
+	s.workers.Go(func() {
+		if err := s.emailSender.SendLoginAlertEmail(user.ID, user.Email, user.Username, device, ipAddress, at); err != nil {
+			log.Printf("failed to send login alert to user %d: %v", user.ID, err)
+		}
+	})
+}
+
+// findByLogin resolves a username or email, forgiving surrounding whitespace
+// and casing. An exact match always wins; the case-insensitive fallback only
+// applies when it is unambiguous.
+func (s *AuthService) findByLogin(ctx context.Context, login string) (*models.User, error) {
+	login = strings.TrimSpace(login)
+
+	exact, fold := s.userRepo.GetByUsername, s.userRepo.GetByUsernameFold
+	if strings.Contains(login, "@") {
+		exact, fold = s.userRepo.GetByEmail, s.userRepo.GetByEmailFold
 	}
 
-	return s.sessionRepo.Revoke(ctx, refreshToken)
+	user, err := exact(ctx, login)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return fold(ctx, login)
+	}
+	return user, err
+}
+
+// Logout revokes the session behind refreshToken and, when accessToken is
+// given and still valid, blacklists it for the rest of its lifetime. An
+// empty or already-invalid access token has nothing left to blacklist.
+func (s *AuthService) Logout(ctx context.Context, refreshToken, accessToken string) error {
+	if accessToken != "" {
+		s.blacklistAccessToken(ctx, accessToken)
+	}
+
+	if err := s.sessionRepo.Revoke(ctx, refreshToken); err != nil {
+		return err
+	}
+	metrics.Logouts.WithLabelValues("session").Inc()
+	return nil
 }
 
-func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string, userAgent, ipAddress *string) (*dto.AuthResponse, error) {
-	_, err := s.sessionRepo.GetByRefreshToken(ctx, refreshToken)
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string, client ClientInfo) (resp *dto.AuthResponse, err error) {
+	defer func() { metrics.Refreshes.WithLabelValues(outcome(err)).Inc() }()
+
+	session, err := s.sessionRepo.GetByRefreshToken(ctx, refreshToken)
 	if err != nil {
 		if errors.Is(err, repository.ErrSessionNotFound) {
-			return nil, errors.New("invalid refresh token")
+			return nil, ErrInvalidRefreshToken
 		}
 		if errors.Is(err, repository.ErrSessionExpired) {
-			return nil, errors.New("refresh token expired")
+			return nil, ErrRefreshTokenExpired
 		}
 		if errors.Is(err, repository.ErrSessionRevoked) {
-			return nil, errors.New("session revoked")
+			return s.checkRotatedToken(ctx, refreshToken)
 		}
 		return nil, err
 	}
@@ -226,110 +446,504 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string, use
 	if err != nil {
 		return nil, err
 	}
+	// Sessions from before verification was required don't outlive it.
+	if s.requireVerified && !user.IsVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Keep the lifetime the session was issued with, so a remember-me
+	// session stays long-lived across rotations. Without sliding the new
+	// token expires when the old one would have.
+	refreshTTL := s.refreshTTL
+	if claims.ExpiresAt != nil && claims.IssuedAt != nil {
+		refreshTTL = claims.ExpiresAt.Sub(claims.IssuedAt.Time)
+	}
+	if !s.slidingSessions {
+		refreshTTL = time.Until(session.ExpiresAt)
+	}
+	if s.sessionTTL(refreshTTL, session.AuthenticatedAt) <= 0 {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	if !s.claimRefreshToken(ctx, claims) {
+		// A concurrent request is already rotating this token.
+		return nil, ErrRefreshRace
+	}
+
+	// The new session belongs to the same device, even if the client only
+	// sent its device ID at login.
+	if client.DeviceID == nil {
+		client.DeviceID = session.DeviceID
+	}
 
-	newAccessToken, accessExpiresAt, err := s.tokenManager.GenerateAccessToken(user.ID, user.Username, user.Email)
+	// From here on a failure must give the claim back, or the client could
+	// never retry with a token that was never rotated.
+	next, resp, err := s.newSession(user, client, refreshTTL, session.AuthenticatedAt)
 	if err != nil {
+		s.releaseRefreshToken(ctx, claims)
+		return nil, err
+	}
+	if err := s.sessionRepo.Rotate(ctx, refreshToken, next); err != nil {
+		s.releaseRefreshToken(ctx, claims)
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			// A concurrent request rotated it between our read and write.
+			return nil, ErrRefreshRace
+		}
 		return nil, err
 	}
 
-	newRefreshToken, refreshExpiresAt, err := s.tokenManager.GenerateRefreshToken(user.ID, user.Username, user.Email)
+	s.rememberRotation(ctx, refreshToken, resp)
+	return resp, nil
+}
+
+// checkRotatedToken classifies a refresh with a revoked token. A token that
+// was rotated moments ago is most likely a second tab refreshing at the same
+// time, so it gets the same pair the first refresh was issued; if that pair
+// isn't available the client is told to retry. Anything older is a replay
+// of a token that may have been stolen, and every session of the user is
+// revoked.
+func (s *AuthService) checkRotatedToken(ctx context.Context, refreshToken string) (*dto.AuthResponse, error) {
+	session, err := s.sessionRepo.FindByRefreshToken(ctx, refreshToken)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.sessionRepo.Revoke(ctx, refreshToken); err != nil {
-		return nil, err
+	if session.RotatedAt == nil {
+		return nil, ErrSessionRevoked
 	}
 
-	newSession := &repository.Session{
-		UserID:       user.ID,
-		RefreshToken: newRefreshToken,
-		AccessToken:  newAccessToken,
-		UserAgent:    userAgent,
-		IPAddress:    ipAddress,
-		ExpiresAt:    refreshExpiresAt,
+	if time.Since(*session.RotatedAt) <= s.refreshRaceWindow {
+		if resp := s.rotatedPair(ctx, refreshToken, session.UserID); resp != nil {
+			return resp, nil
+		}
+		return nil, ErrRefreshRace
 	}
 
-	if err := s.sessionRepo.Create(ctx, newSession); err != nil {
+	log.Printf("refresh token reuse for user %d (session %d), revoking all sessions", session.UserID, session.ID)
+	if err := s.sessionRepo.RevokeAllByUserID(ctx, session.UserID); err != nil {
 		return nil, err
 	}
+	metrics.Revocations.WithLabelValues("refresh_reuse").Inc()
+
+	return nil, ErrRefreshTokenReused
+}
+
+// claimRefreshToken records the refresh token's jti as used and reports
+// whether this call got there first. Tokens issued before jtis existed,
+// and requests made while Redis is down, fall back to the session row's
+// own rotation check.
+func (s *AuthService) claimRefreshToken(ctx context.Context, claims *jwt.Claims) bool {
+	if !s.singleUseRefresh || claims.ID == "" {
+		return true
+	}
+
+	ttl := time.Until(claims.ExpiresAt.Time)
+	claimed, err := s.redisClient.SetNX(ctx, "refresh_used:"+claims.ID, 1, ttl).Result()
+	if err != nil {
+		log.Printf("refresh token single-use check unavailable: %v", err)
+		return true
+	}
+	return claimed
+}
+
+// releaseRefreshToken undoes claimRefreshToken when the rotation failed, so
+// the client can retry with the same token.
+func (s *AuthService) releaseRefreshToken(ctx context.Context, claims *jwt.Claims) {
+	if !s.singleUseRefresh || claims.ID == "" {
+		return
+	}
+	if err := s.redisClient.Del(ctx, "refresh_used:"+claims.ID).Err(); err != nil {
+		log.Printf("failed to release refresh token claim: %v", err)
+	}
+}
+
+// rotation is the token pair a refresh token was rotated into, kept in
+// Redis for the grace period.
+type rotation struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+func rotationKey(refreshToken string) string {
+	return "refresh_grace:" + hashToken(refreshToken)
+}
+
+func (s *AuthService) rememberRotation(ctx context.Context, oldToken string, resp *dto.AuthResponse) {
+	if s.refreshRaceWindow <= 0 {
+		return
+	}
+
+	now := time.Now()
+	data, err := json.Marshal(rotation{
+		AccessToken:      resp.AccessToken,
+		RefreshToken:     resp.RefreshToken,
+		ExpiresAt:        now.Add(time.Duration(resp.ExpiresIn) * time.Second),
+		RefreshExpiresAt: now.Add(time.Duration(resp.RefreshExpiresIn) * time.Second),
+	})
+	if err != nil {
+		return
+	}
+
+	if err := s.redisClient.Set(ctx, rotationKey(oldToken), data, s.refreshRaceWindow).Err(); err != nil {
+		log.Printf("failed to store refresh grace pair: %v", err)
+	}
+}
+
+// rotatedPair returns the pair oldToken was rotated into, or nil once the
+// grace period is over or the pair can't be loaded.
+func (s *AuthService) rotatedPair(ctx context.Context, oldToken string, userID int64) *dto.AuthResponse {
+	data, err := s.redisClient.Get(ctx, rotationKey(oldToken)).Bytes()
+	if err != nil {
+		return nil
+	}
+
+	var r rotation
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil
+	}
 
 	return &dto.AuthResponse{
-		AccessToken:  newAccessToken,
-		RefreshToken: newRefreshToken,
-		ExpiresIn:    int64(accessExpiresAt.Sub(time.Now()).Seconds()),
-		User:         user,
+		AccessToken:      r.AccessToken,
+		RefreshToken:     r.RefreshToken,
+		ExpiresIn:        int64(time.Until(r.ExpiresAt).Seconds()),
+		RefreshExpiresIn: int64(time.Until(r.RefreshExpiresAt).Seconds()),
+		User:             user,
+	}
+}
+
+// createSession issues an access/refresh token pair for a user who just
+// authenticated and records the session backing the refresh token.
+func (s *AuthService) createSession(ctx context.Context, user *models.User, client ClientInfo, refreshTTL time.Duration) (*dto.AuthResponse, error) {
+	return s.issueSession(ctx, user, client, refreshTTL, time.Now())
+}
+
+// sessionTTL caps refreshTTL so the session ends at most sessionMaxLifetime
+// after authenticatedAt.
+func (s *AuthService) sessionTTL(refreshTTL time.Duration, authenticatedAt time.Time) time.Duration {
+	if s.sessionMaxLifetime <= 0 {
+		return refreshTTL
+	}
+	return min(refreshTTL, time.Until(authenticatedAt.Add(s.sessionMaxLifetime)))
+}
+
+// issueSession is createSession for a session whose user authenticated at
+// authenticatedAt.
+func (s *AuthService) issueSession(ctx context.Context, user *models.User, client ClientInfo, refreshTTL time.Duration, authenticatedAt time.Time) (*dto.AuthResponse, error) {
+	session, resp, err := s.newSession(user, client, refreshTTL, authenticatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// newSession mints the tokens of a session and returns the row to store
+// along with the response carrying them.
+func (s *AuthService) newSession(user *models.User, client ClientInfo, refreshTTL time.Duration, authenticatedAt time.Time) (*repository.Session, *dto.AuthResponse, error) {
+	refreshTTL = s.sessionTTL(refreshTTL, authenticatedAt)
+
+	accessToken, expiresAt, err := s.tokenManager.GenerateAccessToken(user.ID, user.Username, user.Email, user.IsVerified, entitlementsFor(user))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, refreshExpiresAt, err := s.tokenManager.GenerateRefreshToken(user.ID, user.Username, user.Email, refreshTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session := &repository.Session{
+		UserID:       user.ID,
+		RefreshToken: refreshToken,
+		AccessToken:  accessToken,
+		UserAgent:    client.UserAgent,
+		IPAddress:    client.IPAddress,
+		DeviceID:     client.deviceID(),
+		ExpiresAt:    refreshExpiresAt,
+
+		AuthenticatedAt: authenticatedAt,
+	}
+
+	return session, &dto.AuthResponse{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(time.Until(expiresAt).Seconds()),
+		RefreshExpiresIn: int64(time.Until(refreshExpiresAt).Seconds()),
+		User:             user,
 	}, nil
 }
 
 func (s *AuthService) LogoutAll(ctx context.Context, userID int64) error {
+	if err := s.blacklistAccessTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.sessionRepo.RevokeAllByUserID(ctx, userID); err != nil {
+		return err
+	}
+	metrics.Logouts.WithLabelValues("all").Inc()
+	return nil
+}
+
+// blacklistAccessTokens blacklists the access tokens of all active sessions
+// of userID for the rest of their lifetime.
+func (s *AuthService) blacklistAccessTokens(ctx context.Context, userID int64) error {
 	sessions, err := s.sessionRepo.GetAllByUserID(ctx, userID)
 	if err != nil {
 		return err
 	}
 
 	for _, sess := range sessions {
-		accessToken := sess.AccessToken
-		if accessToken == "" {
-			continue
+		if sess.AccessToken != "" {
+			s.blacklistAccessToken(ctx, sess.AccessToken)
 		}
+	}
 
-		claims, err := s.tokenManager.ValidateToken(accessToken)
-		if err == nil {
-			ttl := time.Until(claims.ExpiresAt.Time)
-			if ttl > 0 {
-				key := fmt.Sprintf("revoked:%s", accessToken)
-				_ = s.redisClient.Set(ctx, key, "revoked", ttl).Err()
-			}
-		}
+	return nil
+}
+
+// blacklistAccessToken revokes a still-valid access token for the rest of
+// its lifetime. Failures are logged and counted rather than returned: the
+// session itself is revoked in the database either way, so the token only
+// lives on until it expires.
+func (s *AuthService) blacklistAccessToken(ctx context.Context, accessToken string) {
+	claims, err := s.tokenManager.ValidateToken(accessToken)
+	if err != nil {
+		return
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return
 	}
 
-	return s.sessionRepo.RevokeAllByUserID(ctx, userID)
+	key := fmt.Sprintf("revoked:%s", accessToken)
+	if err := s.redisClient.Set(ctx, key, "revoked", ttl).Err(); err != nil {
+		metrics.BlacklistErrors.WithLabelValues("write", "dropped").Inc()
+		log.Printf("failed to blacklist access token for userID=%d: %v", claims.UserId, err)
+		return
+	}
+	log.Printf("access token blacklisted for userID=%d", claims.UserId)
 }
 
-func (s *AuthService) GetActiveSessions(ctx context.Context, userID int64, currentRefreshToken string) (*models.SessionListResponse, error) {
+// GetActiveSessions lists one entry per device, newest first. Sessions are
+// grouped by device ID, falling back to the user agent for clients that
+// don't send one.
+func (s *AuthService) GetActiveSessions(ctx context.Context, userID int64, currentRefreshToken string, limit, offset int) (*models.SessionListResponse, error) {
 	sessions, err := s.sessionRepo.GetAllByUserID(ctx, userID)
-	fmt.Println("check 1")
 	if err != nil {
 		return nil, err
 	}
-	fmt.Print("check 2")
 
-	sessionInfos := make([]*models.SessionInfo, 0, len(sessions))
+	devices := make([]*models.SessionInfo, 0, len(sessions))
+	byDevice := make(map[string]*models.SessionInfo, len(sessions))
 	for _, sess := range sessions {
-		sessionInfos = append(sessionInfos, &models.SessionInfo{
-			ID:        sess.ID,
-			UserAgent: sess.UserAgent,
-			IPAddress: sess.IPAddress,
-			CreatedAt: sess.CreatedAt,
-			ExpiresAt: sess.ExpiresAt,
-			IsCurrent: sess.RefreshToken == currentRefreshToken,
-		})
+		key := deviceKey(sess)
+		info, ok := byDevice[key]
+		if !ok {
+			info = &models.SessionInfo{
+				ID:        sess.ID,
+				DeviceID:  sess.DeviceID,
+				UserAgent: sess.UserAgent,
+				IPAddress: sess.IPAddress,
+				CreatedAt: sess.CreatedAt,
+				ExpiresAt: sess.ExpiresAt,
+			}
+			byDevice[key] = info
+			devices = append(devices, info)
+		}
+
+		info.SessionCount++
+		if currentRefreshToken != "" && sess.RefreshToken == currentRefreshToken {
+			info.IsCurrent = true
+		}
+	}
+
+	total := len(devices)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
 	}
 
 	return &models.SessionListResponse{
-		Sessions: sessionInfos,
-		Total:    len(sessionInfos),
+		Sessions: devices[offset:end],
+		Total:    total,
+		Limit:    limit,
+		Offset:   offset,
 	}, nil
 }
 
-func (s *AuthService) generateVerificationToken() (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+// ExportSessions calls fn for each session of userID created since since.
+func (s *AuthService) ExportSessions(ctx context.Context, userID int64, since time.Time, fn func(*repository.Session) error) error {
+	return s.sessionRepo.EachByUserID(ctx, userID, since, fn)
+}
+
+// GetCurrentSession describes the session that issued accessToken.
+func (s *AuthService) GetCurrentSession(ctx context.Context, userID int64, accessToken string) (*models.SessionInfo, error) {
+	sess, err := s.sessionRepo.GetActiveByAccessToken(ctx, userID, accessToken)
+	if err != nil {
+		return nil, err
 	}
-	return hex.EncodeToString(b), nil
+
+	return &models.SessionInfo{
+		ID:           sess.ID,
+		DeviceID:     sess.DeviceID,
+		UserAgent:    sess.UserAgent,
+		IPAddress:    sess.IPAddress,
+		CreatedAt:    sess.CreatedAt,
+		ExpiresAt:    sess.ExpiresAt,
+		IsCurrent:    true,
+		SessionCount: 1,
+	}, nil
+}
+
+// TrustCurrentDevice trusts the device of the session that issued
+// accessToken and returns it with a new secret, which replaces any earlier
+// one. The session must have been created with an X-Device-ID.
+func (s *AuthService) TrustCurrentDevice(ctx context.Context, userID int64, accessToken string, label *string) (*models.TrustedDevice, error) {
+	sess, err := s.sessionRepo.GetActiveByAccessToken(ctx, userID, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if sess.DeviceID == nil {
+		return nil, ErrDeviceIDRequired
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.trustedRepo.Trust(ctx, userID, *sess.DeviceID, hashToken(secret), label)
+	if err != nil {
+		return nil, err
+	}
+	device.Secret = secret
+	return device, nil
+}
+
+func (s *AuthService) ListTrustedDevices(ctx context.Context, userID int64) ([]*models.TrustedDevice, error) {
+	return s.trustedRepo.ListByUserID(ctx, userID)
+}
+
+func (s *AuthService) UntrustDevice(ctx context.Context, userID, id int64) error {
+	return s.trustedRepo.Untrust(ctx, userID, id)
+}
+
+func deviceKey(sess *repository.Session) string {
+	if sess.DeviceID != nil {
+		return "device:" + *sess.DeviceID
+	}
+	if sess.UserAgent != nil {
+		return "ua:" + *sess.UserAgent
+	}
+	return fmt.Sprintf("session:%d", sess.ID)
 }
 
-func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
-	ev, err := s.emailRepo.GetByToken(ctx, token)
+func (s *AuthService) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := s.generateVerificationToken()
 	if err != nil {
 		return err
 	}
 
-	if err := s.userRepo.MarkVerified(ctx, ev.UserID); err != nil {
+	ev := &models.EmailVerification{
+		UserID:    user.ID,
+		Token:     token,
+		ExpiresAt: time.Now().Add(verificationTTL),
+	}
+
+	if err := s.emailRepo.Create(ctx, ev); err != nil {
 		return err
 	}
 
-	return s.emailRepo.MarkVerified(ctx, ev.ID)
+	err = s.emailSender.SendVerificationEmail(user.Email, user.Username, token)
+	metrics.VerificationEmails.WithLabelValues(outcome(err)).Inc()
+	return err
+}
+
+// ResendVerification sends a fresh verification link to email if it belongs
+// to an unverified account. It returns nil for unknown, already-verified and
+// throttled addresses alike so callers can't use it to enumerate accounts.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+
+	key := "verify_resend:" + strings.ToLower(email)
+	allowed, err := s.redisClient.SetNX(ctx, key, 1, s.resendInterval).Result()
+	if err != nil {
+		log.Printf("resend verification throttle unavailable: %v", err)
+	} else if !allowed {
+		return nil
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		user, err = s.userRepo.GetByEmailFold(ctx, email)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if user.IsVerified {
+		return nil
+	}
+
+	return s.sendVerificationEmail(ctx, user)
+}
+
+func (s *AuthService) generateVerificationToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) (err error) {
+	defer func() { metrics.Verifications.WithLabelValues(outcome(err)).Inc() }()
+
+	_, err = s.emailRepo.Consume(ctx, token)
+	return err
+}
+
+// outcome maps a service error to the result label of the auth counters.
+func outcome(err error) string {
+	var fieldErrs validator.FieldErrors
+	switch {
+	case err == nil:
+		return metrics.ResultSuccess
+	case errors.Is(err, ErrInvalidCredentials):
+		return metrics.ResultInvalidCredentials
+	case errors.Is(err, ErrServiceBusy):
+		return metrics.ResultBusy
+	case errors.Is(err, ErrRefreshRace):
+		return metrics.ResultRace
+	case errors.Is(err, ErrRefreshTokenReused):
+		return metrics.ResultReuse
+	case errors.Is(err, repository.ErrVerificationExpired), errors.Is(err, ErrRefreshTokenExpired),
+		errors.Is(err, repository.ErrResetExpired):
+		return metrics.ResultExpired
+	case errors.Is(err, ErrAlreadyUserExists), errors.As(err, &fieldErrs),
+		errors.Is(err, ErrInvalidRefreshToken), errors.Is(err, ErrSessionRevoked),
+		errors.Is(err, repository.ErrVerificationNotFound), errors.Is(err, repository.ErrAlreadyVerified),
+		errors.Is(err, repository.ErrResetNotFound), errors.Is(err, repository.ErrResetUsed),
+		errors.Is(err, ErrEmailNotVerified):
+		return metrics.ResultInvalid
+	default:
+		return metrics.ResultFailure
+	}
 }
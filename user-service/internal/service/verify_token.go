@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/metrics"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/pkg/jwt"
+)
+
+var (
+	ErrVerifyTokenRateLimited = errors.New("too many token checks, try again later")
+	ErrBlacklistUnavailable   = errors.New("unable to check token revocation")
+)
+
+// Reasons an access token is reported invalid by VerifyToken.
+const (
+	TokenReasonInvalid = "invalid"
+	TokenReasonExpired = "expired"
+	TokenReasonRevoked = "revoked"
+)
+
+// VerifyToken tells a client whether its access token would be accepted,
+// applying the same signature, expiry and blacklist checks as
+// AuthMiddleware. Calls are limited per clientIP.
+func (s *AuthService) VerifyToken(ctx context.Context, token, clientIP string) (*dto.VerifyTokenResponse, error) {
+	if !s.allowVerifyToken(ctx, clientIP) {
+		return nil, ErrVerifyTokenRateLimited
+	}
+
+	claims, err := s.tokenManager.ValidateAccessToken(token)
+	if err != nil {
+		reason := TokenReasonInvalid
+		if errors.Is(err, jwt.ErrExpiredToken) || errors.Is(err, jwt.ErrTokenTooOld) {
+			reason = TokenReasonExpired
+		}
+		return &dto.VerifyTokenResponse{Reason: reason}, nil
+	}
+
+	exists, err := s.redisClient.Exists(ctx, "revoked:"+token).Result()
+	if err != nil {
+		log.Printf("token blacklist unavailable during verify-token: %v", err)
+		if !s.blacklistFailOpen {
+			metrics.BlacklistErrors.WithLabelValues("check", "rejected").Inc()
+			return nil, ErrBlacklistUnavailable
+		}
+		metrics.BlacklistErrors.WithLabelValues("check", "allowed").Inc()
+	} else if exists > 0 {
+		return &dto.VerifyTokenResponse{Reason: TokenReasonRevoked}, nil
+	}
+
+	return &dto.VerifyTokenResponse{
+		Valid:     true,
+		ExpiresAt: &claims.ExpiresAt.Time,
+		UserID:    claims.UserId,
+	}, nil
+}
+
+// allowVerifyToken counts a call from clientIP in the current window. If
+// Redis is unreachable calls are let through.
+func (s *AuthService) allowVerifyToken(ctx context.Context, clientIP string) bool {
+	if s.verifyTokenRateLimit <= 0 {
+		return true
+	}
+
+	key := "verify_token_rate:" + clientIP
+	pipe := s.redisClient.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, s.verifyTokenRateWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("verify-token rate limit unavailable: %v", err)
+		return true
+	}
+	return count.Val() <= s.verifyTokenRateLimit
+}
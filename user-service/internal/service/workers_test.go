@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/config"
+)
+
+func TestShutdownWaitsForInFlightEmail(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.LoginAlertsEnabled = true })
+	e.createUser(t, "alice")
+	e.sender.block = make(chan struct{})
+
+	// The login returns while its alert is still being sent.
+	e.login(t, "alice")
+
+	// main waits on the same group before closing the DB and Redis.
+	stopped := make(chan struct{})
+	go func() {
+		e.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("workers stopped with an email still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(e.sender.block)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers didn't stop after the email was sent")
+	}
+	if got := len(e.sender.emails("login_alert")); got != 1 {
+		t.Errorf("sent %d login alerts, want the in-flight one", got)
+	}
+}
@@ -0,0 +1,32 @@
+package validator
+
+import "strings"
+
+// EmailDomainAllowed reports whether email's domain matches allowlist. An
+// empty allowlist allows every domain. Entries match case-insensitively;
+// "example.com" matches only that domain and "*.example.com" matches any of
+// its subdomains.
+func EmailDomainAllowed(email string, allowlist []string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(domain, "."+suffix) {
+				return true
+			}
+		} else if domain == entry {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,53 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+)
+
+func TestEmailDomainAllowed(t *testing.T) {
+	allowlist := []string{"company.com", " *.Example.org "}
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"alice@company.com", true},
+		{"alice@COMPANY.com", true},
+		{"alice@eu.example.org", true},
+		{"alice@example.org", false},
+		{"alice@company.com.evil.net", false},
+		{"alice@notcompany.com", false},
+		{"alice@gmail.com", false},
+		{"no-at-sign", false},
+	}
+	for _, tt := range tests {
+		if got := EmailDomainAllowed(tt.email, allowlist); got != tt.want {
+			t.Errorf("EmailDomainAllowed(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+
+	if !EmailDomainAllowed("alice@gmail.com", nil) {
+		t.Error("an unset allowlist rejected an address")
+	}
+}
+
+func TestRegisterRejectsDisallowedDomain(t *testing.T) {
+	rules := RegistrationRules{EmailDomains: []string{"company.com"}}
+
+	req := &dto.RegisterUserRequest{Username: "alice", Email: "alice@gmail.com", Password: "battery-staple"}
+	if errs := ValidateRegisterRequest(req, rules); errs["email"] == "" {
+		t.Errorf("disallowed domain: errors = %v, want an email error", errs)
+	}
+
+	req = &dto.RegisterUserRequest{Username: "alice", Email: " alice@Company.com ", Password: "battery-staple"}
+	if errs := ValidateRegisterRequest(req, rules); errs != nil {
+		t.Errorf("allowed domain: %v", errs)
+	}
+
+	req = &dto.RegisterUserRequest{Username: "alice", Email: "alice@gmail.com", Password: "battery-staple"}
+	if errs := ValidateRegisterRequest(req, RegistrationRules{}); errs != nil {
+		t.Errorf("no allowlist: %v", errs)
+	}
+}
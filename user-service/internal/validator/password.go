@@ -0,0 +1,100 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the most bcrypt will hash; longer inputs are rejected.
+const bcryptMaxBytes = 72
+
+// PasswordPolicy describes which passwords are acceptable. The zero value
+// only enforces the bcrypt length limit.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// Describe renders the policy for error messages, e.g. "must be 8-32
+// characters long and contain an uppercase letter and a digit".
+func (p PasswordPolicy) Describe() string {
+	var length string
+	switch {
+	case p.MinLength > 0 && p.MaxLength > 0:
+		length = fmt.Sprintf("must be %d-%d characters long", p.MinLength, p.MaxLength)
+	case p.MinLength > 0:
+		length = fmt.Sprintf("must be at least %d characters long", p.MinLength)
+	case p.MaxLength > 0:
+		length = fmt.Sprintf("must be at most %d characters long", p.MaxLength)
+	default:
+		length = "must not be empty"
+	}
+
+	var classes []string
+	if p.RequireUpper {
+		classes = append(classes, "an uppercase letter")
+	}
+	if p.RequireLower {
+		classes = append(classes, "a lowercase letter")
+	}
+	if p.RequireDigit {
+		classes = append(classes, "a digit")
+	}
+	if p.RequireSymbol {
+		classes = append(classes, "a symbol")
+	}
+
+	switch len(classes) {
+	case 0:
+		return length
+	case 1:
+		return length + " and contain " + classes[0]
+	default:
+		return length + " and contain " + strings.Join(classes[:len(classes)-1], ", ") + " and " + classes[len(classes)-1]
+	}
+}
+
+// Password checks password against policy. The error message describes the
+// whole active policy rather than just the first rule that failed.
+func Password(password string, policy PasswordPolicy) error {
+	if len(password) > bcryptMaxBytes {
+		return fmt.Errorf("must be at most %d bytes long", bcryptMaxBytes)
+	}
+
+	length := utf8.RuneCountInString(password)
+	ok := length > 0 &&
+		(policy.MinLength <= 0 || length >= policy.MinLength) &&
+		(policy.MaxLength <= 0 || length <= policy.MaxLength)
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	ok = ok &&
+		(!policy.RequireUpper || hasUpper) &&
+		(!policy.RequireLower || hasLower) &&
+		(!policy.RequireDigit || hasDigit) &&
+		(!policy.RequireSymbol || hasSymbol)
+
+	if !ok {
+		return errors.New(policy.Describe())
+	}
+	return nil
+}
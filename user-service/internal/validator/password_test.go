@@ -0,0 +1,52 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicies(t *testing.T) {
+	symbols := PasswordPolicy{MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	lengthOnly := PasswordPolicy{MinLength: 15}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		ok       bool
+	}{
+		{"symbols: all classes", symbols, "Tr0ub4dor&3x", true},
+		{"symbols: no symbol", symbols, "Tr0ub4dor33x", false},
+		{"symbols: too short", symbols, "Tr0ub4&x", false},
+		{"length only: long lowercase", lengthOnly, "correct horse battery", true},
+		{"length only: short but complex", lengthOnly, "Tr0ub4dor&3", false},
+		{"zero policy: anything non-empty", PasswordPolicy{}, "x", true},
+		{"zero policy: empty", PasswordPolicy{}, "", false},
+		{"over bcrypt limit", lengthOnly, strings.Repeat("a", 73), false},
+	}
+	for _, tt := range tests {
+		if err := Password(tt.password, tt.policy); (err == nil) != tt.ok {
+			t.Errorf("%s: Password(%q) = %v, want ok %v", tt.name, tt.password, err, tt.ok)
+		}
+	}
+}
+
+func TestPasswordErrorDescribesPolicy(t *testing.T) {
+	tests := []struct {
+		policy PasswordPolicy
+		want   string
+	}{
+		{
+			PasswordPolicy{MinLength: 10, RequireUpper: true, RequireDigit: true, RequireSymbol: true},
+			"must be at least 10 characters long and contain an uppercase letter, a digit and a symbol",
+		},
+		{PasswordPolicy{MinLength: 15}, "must be at least 15 characters long"},
+		{PasswordPolicy{MinLength: 8, MaxLength: 64, RequireLower: true}, "must be 8-64 characters long and contain a lowercase letter"},
+	}
+	for _, tt := range tests {
+		err := Password("short", tt.policy)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Password with %+v = %v, want %q", tt.policy, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package validator
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/models"
+)
+
+// NormalizeStatus lowercases and trims status and reports whether the
+// result is one of models.UserStatuses.
+func NormalizeStatus(status string) (string, bool) {
+	normalized := strings.ToLower(strings.TrimSpace(status))
+	for _, allowed := range models.UserStatuses {
+		if normalized == allowed {
+			return normalized, true
+		}
+	}
+	return "", false
+}
+
+// ValidateUpdateUserRequest checks req and normalizes its fields in place.
+func ValidateUpdateUserRequest(req *dto.UpdateUserRequest) FieldErrors {
+	var errs FieldErrors
+
+	if req.Status != nil {
+		status, ok := NormalizeStatus(*req.Status)
+		if !ok {
+			errs = errs.Add("status", "must be one of: "+strings.Join(models.UserStatuses, ", "))
+		} else {
+			req.Status = &status
+		}
+	}
+	if req.EmailPreferences != nil && !slices.Contains(models.EmailPreferenceValues, *req.EmailPreferences) {
+		errs = errs.Add("email_preferences", "must be one of: "+strings.Join(models.EmailPreferenceValues, ", "))
+	}
+
+	return errs
+}
+
+// RegistrationRules are the deployment-specific checks applied on sign-up.
+type RegistrationRules struct {
+	Password PasswordPolicy
+	// EmailDomains restricts sign-up to these domains; empty allows any.
+	EmailDomains []string
+}
+
+// ValidateRegisterRequest checks the parts of req that binding tags can't
+// express and trims incidental whitespace in place.
+func ValidateRegisterRequest(req *dto.RegisterUserRequest, rules RegistrationRules) FieldErrors {
+	var errs FieldErrors
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+
+	if !EmailDomainAllowed(req.Email, rules.EmailDomains) {
+		errs = errs.Add("email", "domain is not allowed to register")
+	}
+
+	if err := Password(req.Password, rules.Password); err != nil {
+		errs = errs.Add("password", err.Error())
+	}
+
+	return errs
+}
@@ -0,0 +1,41 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/zhanserikAmangeldi/apex-be/user-service/internal/dto"
+)
+
+func TestValidateUpdateUserStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+		ok     bool
+	}{
+		{"away", "away", true},
+		{"Online", "online", true},
+		{" BUSY ", "busy", true},
+		{"sleeping", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		status := tt.status
+		req := &dto.UpdateUserRequest{Status: &status}
+		errs := ValidateUpdateUserRequest(req)
+
+		if !tt.ok {
+			if _, ok := errs["status"]; !ok {
+				t.Errorf("status %q accepted, want a status field error", tt.status)
+			}
+			continue
+		}
+		if errs != nil {
+			t.Errorf("status %q: %v", tt.status, errs)
+			continue
+		}
+		if *req.Status != tt.want {
+			t.Errorf("status %q normalized to %q, want %q", tt.status, *req.Status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package validator
+
+import (
+	"sort"
+	"strings"
+)
+
+// FieldErrors maps a request field name to a human-readable problem with it.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+": "+e[field])
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Add records message for field, allocating the map on first use.
+func (e FieldErrors) Add(field, message string) FieldErrors {
+	if e == nil {
+		e = FieldErrors{}
+	}
+	e[field] = message
+	return e
+}
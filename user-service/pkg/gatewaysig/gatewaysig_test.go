@@ -0,0 +1,80 @@
+package gatewaysig
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("gateway-signing-key")
+
+func signedHeader(now time.Time) http.Header {
+	h := http.Header{}
+	h.Set("X-User-Id", "42")
+	h.Set("X-User-Username", "alice")
+	h.Set("X-User-Email", "alice@example.com")
+	h.Set("Authorization", "Bearer not-covered")
+	Sign(h, testKey, now)
+	return h
+}
+
+func TestVerifyValidSignature(t *testing.T) {
+	now := time.Now()
+	h := signedHeader(now)
+
+	if err := Verify(h, testKey, time.Minute, now); err != nil {
+		t.Fatalf("Verify = %v", err)
+	}
+	// Headers outside X-User-* aren't covered.
+	h.Set("Authorization", "Bearer other")
+	if err := Verify(h, testKey, time.Minute, now.Add(30*time.Second)); err != nil {
+		t.Errorf("Verify after changing an unsigned header = %v", err)
+	}
+}
+
+func TestVerifyTamperedSignature(t *testing.T) {
+	now := time.Now()
+	tamper := map[string]func(http.Header){
+		"changed user id":  func(h http.Header) { h.Set("X-User-Id", "1") },
+		"added header":     func(h http.Header) { h.Set("X-User-Role", "admin") },
+		"removed header":   func(h http.Header) { h.Del("X-User-Email") },
+		"second value":     func(h http.Header) { h.Add("X-User-Id", "1") },
+		"changed time":     func(h http.Header) { h.Set(TimestampHeader, "1") },
+		"garbage":          func(h http.Header) { h.Set(SignatureHeader, "zz") },
+		"other signature":  func(h http.Header) { h.Set(SignatureHeader, signedHeader(now.Add(time.Second)).Get(SignatureHeader)) },
+		"truncated digest": func(h http.Header) { h.Set(SignatureHeader, h.Get(SignatureHeader)[:10]) },
+	}
+	for name, fn := range tamper {
+		h := signedHeader(now)
+		fn(h)
+		if err := Verify(h, testKey, time.Minute, now); err == nil {
+			t.Errorf("%s: Verify accepted the headers", name)
+		}
+	}
+
+	if err := Verify(signedHeader(now), []byte("other-key"), time.Minute, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong key: Verify = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyStaleSignature(t *testing.T) {
+	now := time.Now()
+	for _, signedAt := range []time.Time{now.Add(-2 * time.Minute), now.Add(2 * time.Minute)} {
+		if err := Verify(signedHeader(signedAt), testKey, time.Minute, now); !errors.Is(err, ErrStaleSignature) {
+			t.Errorf("signed %s from now: Verify = %v, want ErrStaleSignature", signedAt.Sub(now), err)
+		}
+	}
+}
+
+func TestVerifyMissingSignature(t *testing.T) {
+	now := time.Now()
+	h := signedHeader(now)
+	h.Del(SignatureHeader)
+	if err := Verify(h, testKey, time.Minute, now); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("no signature: Verify = %v, want ErrMissingSignature", err)
+	}
+	if err := Verify(signedHeader(now), nil, time.Minute, now); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("no key configured: Verify = %v, want ErrMissingSignature", err)
+	}
+}
@@ -1,8 +1,11 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -10,30 +13,73 @@ import (
 var (
 	ErrInvalidToken = errors.New("invalid token")
 	ErrExpiredToken = errors.New("expired token")
+	ErrTokenTooOld  = errors.New("token exceeds max age")
+	ErrMissingClaim = errors.New("token is missing a required claim")
+	ErrClaimTooLong = errors.New("token claim exceeds maximum length")
 )
 
+// Usernames and emails are carried in every token, and the gateway forwards
+// them as X-User-* headers. The caps match the users table columns and keep
+// both the token and each forwarded header far below the usual 8KB proxy
+// header limits, whatever the schema allows in the future.
+const (
+	MaxUsernameLength = 50
+	MaxEmailLength    = 255
+)
+
+// CheckClaimLengths reports whether username and email fit in a token.
+// Username is counted in characters and email in bytes, like the columns.
+func CheckClaimLengths(username, email string) error {
+	if utf8.RuneCountInString(username) > MaxUsernameLength || len(email) > MaxEmailLength {
+		return ErrClaimTooLong
+	}
+	return nil
+}
+
+// Entitlements are embedded in access tokens so other services can enforce
+// plan limits without a lookup. Keep this set small; every field is carried
+// on every request.
+type Entitlements struct {
+	Plan         string `json:"plan,omitempty"`
+	MaxDocuments int    `json:"max_documents,omitempty"`
+}
+
 type Claims struct {
-	UserId   int64  `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UserId       int64         `json:"user_id"`
+	Username     string        `json:"username"`
+	Email        string        `json:"email"`
+	Entitlements *Entitlements `json:"ent,omitempty"`
+	// EmailVerified is only set on access tokens; absent means unverified
+	// or unknown.
+	EmailVerified bool `json:"email_verified,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type TokenManager struct {
 	secretKey string
+
+	// accessMaxAge, if positive, rejects access tokens issued longer ago
+	// than this even if they haven't expired yet.
+	accessMaxAge time.Duration
 }
 
-func NewTokenManager(secretKey string) *TokenManager {
-	return &TokenManager{secretKey: secretKey}
+func NewTokenManager(secretKey string, accessMaxAge time.Duration) *TokenManager {
+	return &TokenManager{secretKey: secretKey, accessMaxAge: accessMaxAge}
 }
 
-func (tm *TokenManager) GenerateAccessToken(userId int64, username, email string) (string, time.Time, error) {
+func (tm *TokenManager) GenerateAccessToken(userId int64, username, email string, emailVerified bool, entitlements *Entitlements) (string, time.Time, error) {
+	if err := CheckClaimLengths(username, email); err != nil {
+		return "", time.Time{}, err
+	}
+
 	expiresAt := time.Now().Add(time.Minute * 15)
 
 	claims := Claims{
-		UserId:   userId,
-		Username: username,
-		Email:    email,
+		UserId:        userId,
+		Username:      username,
+		Email:         email,
+		Entitlements:  entitlements,
+		EmailVerified: emailVerified,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -50,14 +96,26 @@ func (tm *TokenManager) GenerateAccessToken(userId int64, username, email string
 	return tokenString, expiresAt, nil
 }
 
-func (tm *TokenManager) GenerateRefreshToken(userID int64, username, email string) (string, time.Time, error) {
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+func (tm *TokenManager) GenerateRefreshToken(userID int64, username, email string, ttl time.Duration) (string, time.Time, error) {
+	if err := CheckClaimLengths(username, email); err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+
+	// The jti lets a refresh token be marked as used, and keeps two tokens
+	// issued to the same user in the same second distinct.
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", time.Time{}, err
+	}
 
 	claims := Claims{
 		UserId:   userID,
 		Username: username,
 		Email:    email,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(id),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -78,12 +136,15 @@ func (tm *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
 			return nil, ErrInvalidToken
 		}
 		return []byte(tm.secretKey), nil
-	})
+	}, jwt.WithExpirationRequired(), jwt.WithIssuedAt())
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			return nil, ErrExpiredToken
 		}
+		if errors.Is(err, jwt.ErrTokenRequiredClaimMissing) {
+			return nil, ErrMissingClaim
+		}
 		return nil, ErrInvalidToken
 	}
 
@@ -92,5 +153,30 @@ func (tm *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, ErrInvalidToken
 	}
 
+	// A signed token is only as good as its issuer; don't trust one that
+	// doesn't identify a user.
+	if claims.UserId <= 0 || claims.IssuedAt == nil {
+		return nil, ErrMissingClaim
+	}
+	if err := CheckClaimLengths(claims.Username, claims.Email); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// ValidateAccessToken is ValidateToken plus the max age check on iat.
+func (tm *TokenManager) ValidateAccessToken(tokenString string) (*Claims, error) {
+	claims, err := tm.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if tm.accessMaxAge > 0 {
+		if claims.IssuedAt == nil || time.Since(claims.IssuedAt.Time) > tm.accessMaxAge {
+			return nil, ErrTokenTooOld
+		}
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,148 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxClaims returns a username and email at their maximum lengths. The
+// username uses two-byte characters, since it is capped in characters.
+func maxClaims() (string, string) {
+	username := strings.Repeat("ж", MaxUsernameLength)
+	email := strings.Repeat("a", MaxEmailLength-len("@example.com")) + "@example.com"
+	return username, email
+}
+
+func TestMaxLengthClaimsRoundTrip(t *testing.T) {
+	tm := NewTokenManager("test-secret", 0)
+	username, email := maxClaims()
+
+	access, _, err := tm.GenerateAccessToken(1, username, email, true, &Entitlements{Plan: "pro", MaxDocuments: 100})
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	refresh, _, err := tm.GenerateRefreshToken(1, username, email, time.Hour)
+	if err != nil {
+		t.Fatalf("refresh token: %v", err)
+	}
+
+	for name, token := range map[string]string{"access": access, "refresh": refresh} {
+		claims, err := tm.ValidateToken(token)
+		if err != nil {
+			t.Fatalf("%s token: %v", name, err)
+		}
+		if claims.Username != username || claims.Email != email {
+			t.Fatalf("%s token claims didn't round-trip", name)
+		}
+	}
+}
+
+func TestClaimsOverMaxLengthRejected(t *testing.T) {
+	tm := NewTokenManager("test-secret", 0)
+	username, email := maxClaims()
+
+	if _, _, err := tm.GenerateAccessToken(1, username+"ж", email, true, nil); !errors.Is(err, ErrClaimTooLong) {
+		t.Fatalf("long username: got %v, want ErrClaimTooLong", err)
+	}
+	if _, _, err := tm.GenerateRefreshToken(1, username, "a"+email, time.Hour); !errors.Is(err, ErrClaimTooLong) {
+		t.Fatalf("long email: got %v, want ErrClaimTooLong", err)
+	}
+}
+
+func TestEntitlementsRoundTrip(t *testing.T) {
+	tm := NewTokenManager("test-secret", 0)
+
+	access, _, err := tm.GenerateAccessToken(1, "alice", "alice@example.com", true, &Entitlements{Plan: "pro", MaxDocuments: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := tm.ValidateAccessToken(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Entitlements == nil || *claims.Entitlements != (Entitlements{Plan: "pro", MaxDocuments: 1000}) {
+		t.Errorf("entitlements = %+v, want pro with 1000 documents", claims.Entitlements)
+	}
+
+	access, _, err = tm.GenerateAccessToken(1, "alice", "alice@example.com", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = tm.ValidateAccessToken(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Entitlements != nil {
+		t.Errorf("token issued without entitlements carries %+v", claims.Entitlements)
+	}
+}
+
+// sign signs claims with the test secret, bypassing the generators' checks.
+func sign(t *testing.T, claims Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// issued returns claims for user 1 issued ago and expiring in.
+func issued(ago, in time.Duration) Claims {
+	return Claims{
+		UserId: 1,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-ago)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(in)),
+		},
+	}
+}
+
+func TestAccessTokenMaxAge(t *testing.T) {
+	tm := NewTokenManager("test-secret", 5*time.Minute)
+
+	if _, err := tm.ValidateAccessToken(sign(t, issued(time.Minute, 14*time.Minute))); err != nil {
+		t.Errorf("token within max age: %v", err)
+	}
+	old := sign(t, issued(10*time.Minute, 5*time.Minute))
+	if _, err := tm.ValidateAccessToken(old); !errors.Is(err, ErrTokenTooOld) {
+		t.Errorf("token beyond max age = %v, want ErrTokenTooOld", err)
+	}
+	// The max age only applies to access tokens.
+	if _, err := tm.ValidateToken(old); err != nil {
+		t.Errorf("ValidateToken applied the access max age: %v", err)
+	}
+
+	// Off by default: only exp counts.
+	if _, err := NewTokenManager("test-secret", 0).ValidateAccessToken(old); err != nil {
+		t.Errorf("without a max age: %v", err)
+	}
+}
+
+func TestRequiredClaims(t *testing.T) {
+	tm := NewTokenManager("test-secret", 5*time.Minute)
+
+	if _, err := tm.ValidateToken(sign(t, issued(0, time.Minute))); err != nil {
+		t.Fatalf("complete token: %v", err)
+	}
+
+	cases := map[string]func(*Claims){
+		"zero user id":     func(c *Claims) { c.UserId = 0 },
+		"negative user id": func(c *Claims) { c.UserId = -1 },
+		"no expiry":        func(c *Claims) { c.ExpiresAt = nil },
+		"no issue time":    func(c *Claims) { c.IssuedAt = nil },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := issued(0, time.Minute)
+			mutate(&claims)
+			if _, err := tm.ValidateToken(sign(t, claims)); !errors.Is(err, ErrMissingClaim) {
+				t.Errorf("got %v, want ErrMissingClaim", err)
+			}
+		})
+	}
+}